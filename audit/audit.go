@@ -0,0 +1,109 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/koh-yoshimoto/mysql-mcp-server/sqlparse"
+)
+
+// Outcomes recorded for tool calls.
+const (
+	OutcomeSuccess  = "success"
+	OutcomeError    = "error"
+	OutcomeRejected = "rejected"
+	// OutcomePending is recorded for a write just before it commits, or
+	// before it runs when it cannot run in a transaction. The entry that
+	// follows it records whether it succeeded.
+	OutcomePending = "pending"
+)
+
+// Entry is one line of the audit trail.
+type Entry struct {
+	Timestamp     time.Time   `json:"timestamp"`
+	Tool          string      `json:"tool"`
+	Action        string      `json:"action"`
+	Connection    string      `json:"connection"`
+	SQL           string      `json:"sql"`
+	Fingerprint   string      `json:"fingerprint"`
+	ConfirmToken  string      `json:"confirm_token,omitempty"`
+	EstimatedRows *int64      `json:"estimated_rows,omitempty"`
+	ActualRows    *int64      `json:"actual_rows,omitempty"`
+	DurationMs    int64       `json:"duration_ms"`
+	Outcome       string      `json:"outcome"`
+	Error         string      `json:"error,omitempty"`
+	Cached        bool        `json:"cached,omitempty"`
+	Client        *ClientInfo `json:"client,omitempty"`
+}
+
+// ClientInfo identifies the MCP client, as reported in initialize.
+type ClientInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// Sink persists audit entries. Write must not return before the entry is
+// durably stored.
+type Sink interface {
+	Write(entry *Entry) error
+	Close() error
+}
+
+// Logger fans entries out to every configured sink.
+type Logger struct {
+	mu    sync.Mutex
+	sinks []Sink
+}
+
+func NewLogger(sinks ...Sink) *Logger {
+	return &Logger{sinks: sinks}
+}
+
+// Log stamps the entry, normalizes its SQL and writes it to every sink.
+// It returns the first error encountered, after attempting all sinks.
+func (l *Logger) Log(entry Entry) error {
+	if l == nil {
+		return nil
+	}
+
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now().UTC()
+	}
+	entry.Fingerprint = Fingerprint(entry.SQL)
+	entry.SQL = sqlparse.Normalize(entry.SQL)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var firstErr error
+	for _, sink := range l.sinks {
+		if err := sink.Write(&entry); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to write audit entry: %w", err)
+		}
+	}
+	return firstErr
+}
+
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+
+	var firstErr error
+	for _, sink := range l.sinks {
+		if err := sink.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Fingerprint returns a short digest of the statement's shape, so entries
+// for the same statement with different values can be grouped.
+func Fingerprint(sql string) string {
+	hash := sha256.Sum256([]byte(sqlparse.Fingerprint(sql)))
+	return hex.EncodeToString(hash[:])[:16]
+}
@@ -0,0 +1,68 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileSinkRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	sink, err := NewFileSink(path, 300, 2)
+	if err != nil {
+		t.Fatalf("NewFileSink failed: %v", err)
+	}
+	logger := NewLogger(sink)
+	defer logger.Close()
+
+	for i := 0; i < 10; i++ {
+		if err := logger.Log(Entry{Tool: "query", Action: "query", SQL: "SELECT * FROM users WHERE id = 1", Outcome: OutcomeSuccess}); err != nil {
+			t.Fatalf("Log failed: %v", err)
+		}
+	}
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		if _, err := os.Stat(name); err != nil {
+			t.Errorf("Expected %s to exist: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("Only maxFiles rotated copies should be kept")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("Audit line is not valid JSON: %v", err)
+		}
+		if entry.Timestamp.IsZero() || entry.Fingerprint == "" {
+			t.Errorf("Entry should be stamped and fingerprinted: %+v", entry)
+		}
+	}
+}
+
+func TestFingerprintGroupsValues(t *testing.T) {
+	a := Fingerprint("DELETE FROM orders WHERE id = 1")
+	b := Fingerprint("delete from orders where id = 2")
+	c := Fingerprint("DELETE FROM orders WHERE user_id = 1")
+
+	if a != b {
+		t.Error("Statements differing only in values should share a fingerprint")
+	}
+	if a == c {
+		t.Error("Statements with different shapes should not share a fingerprint")
+	}
+	if len(a) != 16 {
+		t.Errorf("Fingerprint length = %d, want 16", len(a))
+	}
+}
@@ -0,0 +1,95 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TableSink inserts entries into a MySQL table, creating it if needed.
+type TableSink struct {
+	db    *sql.DB
+	table string
+}
+
+func NewTableSink(db *sql.DB, table string) (*TableSink, error) {
+	sink := &TableSink{
+		db:    db,
+		table: quoteTableName(table),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	logged_at DATETIME(6) NOT NULL,
+	tool VARCHAR(32) NOT NULL,
+	action VARCHAR(32) NOT NULL,
+	connection VARCHAR(255) NOT NULL,
+	sql_text MEDIUMTEXT NOT NULL,
+	fingerprint CHAR(16) NOT NULL,
+	confirm_token VARCHAR(128) NULL,
+	estimated_rows BIGINT NULL,
+	actual_rows BIGINT NULL,
+	duration_ms BIGINT NOT NULL,
+	outcome VARCHAR(16) NOT NULL,
+	error TEXT NULL,
+	cached BOOLEAN NOT NULL DEFAULT FALSE,
+	client_name VARCHAR(255) NULL,
+	client_version VARCHAR(64) NULL,
+	INDEX idx_logged_at (logged_at),
+	INDEX idx_fingerprint (fingerprint)
+) ENGINE=InnoDB`, sink.table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create audit table: %w", err)
+	}
+
+	return sink, nil
+}
+
+func (t *TableSink) Write(entry *Entry) error {
+	var clientName, clientVersion interface{}
+	if entry.Client != nil {
+		clientName = entry.Client.Name
+		clientVersion = entry.Client.Version
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := t.db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s
+	(logged_at, tool, action, connection, sql_text, fingerprint, confirm_token, estimated_rows, actual_rows,
+	 duration_ms, outcome, error, cached, client_name, client_version)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, t.table),
+		entry.Timestamp, entry.Tool, entry.Action, entry.Connection, entry.SQL, entry.Fingerprint,
+		nullString(entry.ConfirmToken), entry.EstimatedRows, entry.ActualRows,
+		entry.DurationMs, entry.Outcome, nullString(entry.Error), entry.Cached, clientName, clientVersion)
+	if err != nil {
+		return fmt.Errorf("failed to insert audit entry: %w", err)
+	}
+	return nil
+}
+
+// Close is a no-op; the database handle belongs to the caller.
+func (t *TableSink) Close() error {
+	return nil
+}
+
+// quoteTableName quotes a table name that may be qualified with a schema.
+func quoteTableName(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = "`" + strings.ReplaceAll(strings.Trim(part, "`"), "`", "``") + "`"
+	}
+	return strings.Join(parts, ".")
+}
+
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,129 @@
+// Package backup stores snapshots of rows taken before they are changed, so
+// an UPDATE or DELETE can be undone.
+package backup
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/koh-yoshimoto/mysql-mcp-server/sqlparse"
+)
+
+// ErrNotFound is returned by Store.Load for unknown snapshot ids.
+var ErrNotFound = errors.New("snapshot not found")
+
+var idRegex = regexp.MustCompile(`^[0-9A-Za-z-]{1,64}$`)
+
+// Snapshot holds the rows a statement affected, as they were before it ran.
+// Values are stored as SQL literals so they restore exactly.
+type Snapshot struct {
+	ID         string     `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Connection string     `json:"connection"`
+	SQL        string     `json:"sql"`
+	Operation  string     `json:"operation"`
+	Table      string     `json:"table"`
+	Key        []string   `json:"key"`
+	Columns    []string   `json:"columns"`
+	Rows       [][]string `json:"rows"`
+}
+
+// Store persists snapshots.
+type Store interface {
+	Save(snapshot *Snapshot) error
+	Load(id string) (*Snapshot, error)
+}
+
+// NewSnapshot builds a snapshot of rows from table, leaving out the skip
+// columns (such as generated columns, which cannot be written). It assigns a
+// new id; the caller fills in the statement details.
+func NewSnapshot(table string, key []string, rows []map[string]interface{}, skip []string) *Snapshot {
+	skipped := make(map[string]bool, len(skip))
+	for _, column := range skip {
+		skipped[column] = true
+	}
+
+	snapshot := &Snapshot{
+		ID:        newID(),
+		CreatedAt: time.Now(),
+		Table:     table,
+		Key:       key,
+	}
+
+	if len(rows) > 0 {
+		for column := range rows[0] {
+			if !skipped[column] {
+				snapshot.Columns = append(snapshot.Columns, column)
+			}
+		}
+		sort.Strings(snapshot.Columns)
+	}
+
+	for _, row := range rows {
+		values := make([]string, len(snapshot.Columns))
+		for i, column := range snapshot.Columns {
+			values[i] = sqlparse.Literal(row[column])
+		}
+		snapshot.Rows = append(snapshot.Rows, values)
+	}
+
+	return snapshot
+}
+
+// RestoreSQL returns a statement that writes the snapshot rows back: deleted
+// rows are re-inserted and updated rows get their old values again. Rows are
+// matched on the table's primary and unique keys.
+func (s *Snapshot) RestoreSQL() string {
+	if len(s.Rows) == 0 {
+		return ""
+	}
+
+	columns := make([]string, len(s.Columns))
+	for i, column := range s.Columns {
+		columns[i] = sqlparse.QuoteIdent(column)
+	}
+
+	tuples := make([]string, len(s.Rows))
+	for i, row := range s.Rows {
+		tuples[i] = "(" + strings.Join(row, ", ") + ")"
+	}
+
+	isKey := make(map[string]bool, len(s.Key))
+	for _, column := range s.Key {
+		isKey[column] = true
+	}
+	var updates []string
+	for i, column := range s.Columns {
+		if !isKey[column] {
+			updates = append(updates, fmt.Sprintf("%s = VALUES(%s)", columns[i], columns[i]))
+		}
+	}
+
+	// A table made only of key columns has nothing to update
+	if len(updates) == 0 {
+		return fmt.Sprintf("INSERT IGNORE INTO %s (%s) VALUES %s",
+			s.Table, strings.Join(columns, ", "), strings.Join(tuples, ", "))
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES %s ON DUPLICATE KEY UPDATE %s",
+		s.Table, strings.Join(columns, ", "), strings.Join(tuples, ", "), strings.Join(updates, ", "))
+}
+
+// ValidID reports whether id has the form of a snapshot id, which makes it
+// safe to use as a file name.
+func ValidID(id string) bool {
+	return idRegex.MatchString(id)
+}
+
+func newID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return time.Now().UTC().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,70 @@
+package backup
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRestoreSQL(t *testing.T) {
+	rows := []map[string]interface{}{
+		{"id": int64(1), "name": "O'Brien", "total": nil, "full_name": "x"},
+		{"id": int64(2), "name": "Smith", "total": "12.50", "full_name": "y"},
+	}
+	snapshot := NewSnapshot("`shop`.`customers`", []string{"id"}, rows, []string{"full_name"})
+
+	expected := "INSERT INTO `shop`.`customers` (`id`, `name`, `total`) VALUES (1, 'O''Brien', NULL), (2, 'Smith', '12.50') " +
+		"ON DUPLICATE KEY UPDATE `name` = VALUES(`name`), `total` = VALUES(`total`)"
+	if sql := snapshot.RestoreSQL(); sql != expected {
+		t.Errorf("RestoreSQL() =\n%s\nwant\n%s", sql, expected)
+	}
+
+	keyOnly := NewSnapshot("tags", []string{"post_id", "tag"}, []map[string]interface{}{{"post_id": int64(1), "tag": "go"}}, nil)
+	if sql := keyOnly.RestoreSQL(); sql != "INSERT IGNORE INTO tags (`post_id`, `tag`) VALUES (1, 'go')" {
+		t.Errorf("RestoreSQL() for key-only table = %s", sql)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "backups")
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+
+	snapshot := NewSnapshot("orders", []string{"id"}, []map[string]interface{}{
+		{"id": int64(9007199254740993), "created_at": time.Date(2024, 1, 2, 3, 4, 5, 600000000, time.UTC), "data": "\xff\x00"},
+	}, nil)
+	snapshot.SQL = "DELETE FROM orders WHERE id = 9007199254740993"
+	if err := store.Save(snapshot); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, snapshot.ID+".json"))
+	if err != nil {
+		t.Fatalf("Snapshot file missing: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Snapshot file should be private, got %v", info.Mode().Perm())
+	}
+
+	loaded, err := store.Load(snapshot.ID)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded.RestoreSQL() != snapshot.RestoreSQL() {
+		t.Errorf("Loaded snapshot restores differently:\n%s\n%s", loaded.RestoreSQL(), snapshot.RestoreSQL())
+	}
+	expected := "(9007199254740993, '2024-01-02 03:04:05.6', X'ff00')"
+	if got := "(" + loaded.Rows[0][2] + ", " + loaded.Rows[0][0] + ", " + loaded.Rows[0][1] + ")"; got != expected {
+		t.Errorf("Values did not survive the round trip: %s, want %s", got, expected)
+	}
+
+	for _, id := range []string{"missing", "../backups/" + snapshot.ID, ""} {
+		if _, err := store.Load(id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Load(%q) should return ErrNotFound, got %v", id, err)
+		}
+	}
+}
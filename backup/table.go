@@ -0,0 +1,85 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/koh-yoshimoto/mysql-mcp-server/sqlparse"
+)
+
+// TableStore keeps snapshots in a MySQL table, creating it if needed.
+type TableStore struct {
+	db    *sql.DB
+	table string
+}
+
+func NewTableStore(db *sql.DB, table string) (*TableStore, error) {
+	schema, name := sqlparse.SplitTableName(table)
+	quoted := sqlparse.QuoteIdent(name)
+	if schema != "" {
+		quoted = sqlparse.QuoteIdent(schema) + "." + quoted
+	}
+	store := &TableStore{db: db, table: quoted}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id VARCHAR(64) PRIMARY KEY,
+	created_at DATETIME(6) NOT NULL,
+	connection VARCHAR(255) NOT NULL,
+	operation VARCHAR(16) NOT NULL,
+	table_name VARCHAR(255) NOT NULL,
+	sql_text MEDIUMTEXT NOT NULL,
+	snapshot LONGTEXT NOT NULL,
+	INDEX idx_created_at (created_at)
+) ENGINE=InnoDB`, store.table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup table: %w", err)
+	}
+
+	return store, nil
+}
+
+func (t *TableStore) Save(snapshot *Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err = t.db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s
+	(id, created_at, connection, operation, table_name, sql_text, snapshot)
+	VALUES (?, ?, ?, ?, ?, ?, ?)`, t.table),
+		snapshot.ID, snapshot.CreatedAt, snapshot.Connection, snapshot.Operation, snapshot.Table, snapshot.SQL, data)
+	if err != nil {
+		return fmt.Errorf("failed to insert snapshot: %w", err)
+	}
+	return nil
+}
+
+func (t *TableStore) Load(id string) (*Snapshot, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var data []byte
+	err := t.db.QueryRowContext(ctx, fmt.Sprintf("SELECT snapshot FROM %s WHERE id = ?", t.table), id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+	return &snapshot, nil
+}
@@ -0,0 +1,483 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/koh-yoshimoto/mysql-mcp-server/audit"
+	"github.com/koh-yoshimoto/mysql-mcp-server/mysql"
+	"github.com/tidwall/gjson"
+)
+
+// maxBatchStatements caps the number of statements in one execute call.
+const maxBatchStatements = 100
+
+// parseStatements reads the statements argument of the execute tool.
+func parseStatements(args json.RawMessage) ([]string, error) {
+	value := gjson.GetBytes(args, "statements")
+	if !value.IsArray() {
+		return nil, fmt.Errorf("statements must be an array of SQL strings")
+	}
+
+	var statements []string
+	for i, item := range value.Array() {
+		if item.Type != gjson.String || strings.TrimSpace(item.String()) == "" {
+			return nil, fmt.Errorf("statement %d must be a non-empty SQL string", i+1)
+		}
+		statements = append(statements, item.String())
+	}
+
+	if len(statements) == 0 {
+		return nil, fmt.Errorf("statements must not be empty")
+	}
+	if len(statements) > maxBatchStatements {
+		return nil, fmt.Errorf("at most %d statements can be executed together", maxBatchStatements)
+	}
+	return statements, nil
+}
+
+// batchKey is the text a batch's confirm token is bound to. It encodes the
+// statement boundaries, so statements cannot be merged or split after the
+// dry run.
+func batchKey(statements []string) string {
+	key, _ := json.Marshal(statements)
+	return string(key)
+}
+
+// checkBatch rejects statements that cannot be part of an atomic batch or
+// that the guardrails refuse.
+func (s *MCPServer) checkBatch(statements []string) error {
+	for i, statement := range statements {
+		if isSelectQuery(statement) {
+			return fmt.Errorf("statement %d is a SELECT query; use the 'query' tool for SELECT statements", i+1)
+		}
+		if detectQueryOperation(statement) == "CALL" {
+			return fmt.Errorf("statement %d is a CALL statement; use the 'call' tool for stored procedures", i+1)
+		}
+		if !s.currentReadClient().CanUseTransaction(statement) {
+			return fmt.Errorf("statement %d (%s) cannot run in a transaction; execute it on its own",
+				i+1, detectQueryOperation(statement))
+		}
+		if err := s.guardrails.CheckStatement(statement); err != nil {
+			return fmt.Errorf("statement %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// handleExecuteBatch runs the execute tool for a list of statements. They are
+// dry-run together in one rolled-back transaction, confirmed with a single
+// token, and executed in one transaction: either all of them are applied or
+// none is.
+func (s *MCPServer) handleExecuteBatch(id interface{}, args json.RawMessage, statements []string) *Response {
+	auditSQL := strings.Join(statements, ";\n")
+
+	if err := s.checkBatch(statements); err != nil {
+		s.logAudit(audit.Entry{Tool: "execute", Action: "dry_run", SQL: auditSQL, Outcome: audit.OutcomeRejected, Error: err.Error()})
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: fmt.Sprintf("Refusing to run these statements: %v.", err),
+			},
+		}
+	}
+
+	dryRun := true
+	if v := gjson.GetBytes(args, "dry_run"); v.Exists() {
+		dryRun = v.Bool()
+	}
+	if !dryRun {
+		return s.executeBatch(id, args, statements)
+	}
+
+	ctx, cancel, timeout := s.callContext(args)
+	defer cancel()
+
+	start := time.Now()
+	counts, err := s.currentWriteClient().ExecuteBatchInTransaction(ctx, statements)
+	if err != nil {
+		s.logAudit(audit.Entry{Tool: "execute", Action: "dry_run", SQL: auditSQL, Outcome: audit.OutcomeError,
+			Error: err.Error(), DurationMs: time.Since(start).Milliseconds()})
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32603,
+				Message: errorMessage("Failed to analyze statements", err, timeout),
+			},
+		}
+	}
+
+	var total int64
+	for i, count := range counts {
+		if err := s.guardrails.CheckAffectedRows(detectQueryOperation(statements[i]), count); err != nil {
+			s.logAudit(audit.Entry{Tool: "execute", Action: "dry_run", SQL: auditSQL, Outcome: audit.OutcomeRejected,
+				EstimatedRows: int64Ptr(count), Error: err.Error(), DurationMs: time.Since(start).Milliseconds()})
+			return &Response{
+				JSONRPC: "2.0",
+				ID:      id,
+				Error: &Error{
+					Code:    -32602,
+					Message: fmt.Sprintf("Refusing to run these statements: statement %d: %v.", i+1, err),
+				},
+			}
+		}
+		total += count
+	}
+	requiresOverride := s.guardrails.RequiresOverride(total)
+
+	policy := s.evaluateBatchPolicy(statements, counts)
+	if policy.Outcome == policyDeny {
+		message := policy.Describe()
+		s.logAudit(audit.Entry{Tool: "execute", Action: "dry_run", SQL: auditSQL, Outcome: audit.OutcomeRejected,
+			EstimatedRows: int64Ptr(total), Error: message, DurationMs: time.Since(start).Milliseconds()})
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: fmt.Sprintf("Refusing to run these statements. %s", message),
+			},
+		}
+	}
+
+	s.confirmations.Cleanup()
+	token := s.confirmations.Issue(&ExecuteConfirmation{
+		SQL:          batchKey(statements),
+		AffectedRows: total,
+		Counts:       counts,
+		Operation:    "BATCH",
+		Connection:   s.tokenConnection(),
+		Policy:       policy,
+	})
+
+	s.logAudit(audit.Entry{Tool: "execute", Action: "dry_run", SQL: auditSQL, Outcome: audit.OutcomeSuccess,
+		ConfirmToken: token, EstimatedRows: int64Ptr(total), DurationMs: time.Since(start).Milliseconds()})
+
+	var summary strings.Builder
+	details := make([]map[string]interface{}, len(statements))
+	for i, statement := range statements {
+		operation := detectQueryOperation(statement)
+		fmt.Fprintf(&summary, "%d. %s: %d rows - %s\n", i+1, operation, counts[i], statement)
+		details[i] = map[string]interface{}{
+			"sql":           statement,
+			"operation":     operation,
+			"affected_rows": counts[i],
+		}
+	}
+
+	contentMessages := []map[string]interface{}{
+		{
+			"type": "text",
+			"text": fmt.Sprintf("🔍 DRY RUN RESULT - %d statements in one transaction", len(statements)),
+		},
+		{
+			"type": "text",
+			"text": strings.TrimRight(summary.String(), "\n"),
+		},
+		{
+			"type": "text",
+			"text": fmt.Sprintf("📊 Affected rows: %d in total (exact count using transaction rollback)", total),
+		},
+		{
+			"type": "text",
+			"text": policy.Describe(),
+		},
+	}
+
+	confirmationQuestion := fmt.Sprintf("Do you want to proceed with these %d statements that will affect %d rows in total?", len(statements), total)
+	aiInstruction := fmt.Sprintf(`IMPORTANT: Before executing these statements, you MUST:
+1. Show the user this dry-run result: each statement with its affected rows, %d rows in total
+2. Ask the user explicitly: "%s"
+3. Only proceed with execution if the user clearly confirms (yes, proceed, confirm, etc.)
+4. If the user declines or is unsure, do not execute the statements`, total, confirmationQuestion)
+	if !policy.RequiresConfirmation() {
+		aiInstruction = fmt.Sprintf(`The approval policy allows executing these statements affecting %d rows in total without asking the user.
+Tell the user what you are executing`, total)
+	}
+	if policy.Outcome == policyConfirmTwice {
+		aiInstruction += "\n- The approval policy requires two confirmations: executing with this token returns a second token. Ask the user again before using it"
+	}
+	if policy.Message != "" {
+		aiInstruction += fmt.Sprintf("\n- Show the user the approval policy's message: %s", policy.Message)
+	}
+
+	if requiresOverride {
+		contentMessages = append(contentMessages, map[string]interface{}{
+			"type": "text",
+			"text": fmt.Sprintf("⚠️  WARNING: These statements will affect %d rows, above the large-operation threshold of %d rows. "+
+				"Executing them requires allow_large_operation=true in addition to the confirm token.", total, s.guardrails.LargeOperationRows),
+		})
+		aiInstruction += fmt.Sprintf("\n- This operation exceeds the large-operation threshold (%d rows). Only pass allow_large_operation=true if the user explicitly accepts affecting %d rows",
+			s.guardrails.LargeOperationRows, total)
+	}
+
+	contentMessages = append(contentMessages,
+		map[string]interface{}{
+			"type": "text",
+			"text": "💡 To execute these statements after user confirmation:",
+		},
+		map[string]interface{}{
+			"type": "text",
+			"text": fmt.Sprintf("Use the execute tool with the same statements, dry_run=false and confirm_token='%s' (single use, valid for %s). "+
+				"They are applied all together or not at all.", token, s.confirmations.TTL()),
+		},
+	)
+
+	result := map[string]interface{}{
+		"content":                    contentMessages,
+		"statements":                 details,
+		"affected_rows":              total,
+		"operation":                  "BATCH",
+		"confirm_token":              token,
+		"ai_instruction":             aiInstruction,
+		"requires_user_confirmation": policy.RequiresConfirmation(),
+		"confirmation_prompt":        confirmationQuestion,
+		"is_exact_count":             true,
+		"requires_override":          requiresOverride,
+		"policy":                     policy.data(),
+	}
+	reportRetries(ctx, result)
+	return &Response{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result:  result,
+	}
+}
+
+// executeBatch executes confirmed statements atomically.
+func (s *MCPServer) executeBatch(id interface{}, args json.RawMessage, statements []string) *Response {
+	auditSQL := strings.Join(statements, ";\n")
+	confirmToken := gjson.GetBytes(args, "confirm_token").String()
+	if confirmToken == "" {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: "confirm_token is required when dry_run=false",
+			},
+		}
+	}
+
+	confirmation, err := s.confirmations.Validate(confirmToken, batchKey(statements), s.tokenConnection())
+	if err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: err.Error(),
+			},
+		}
+	}
+
+	// Every statement of a batch runs in the transaction, so the row count
+	// can always be verified
+	verify, err := s.parseRowCheck(args, statements[0], confirmation.AffectedRows)
+	if err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: err.Error(),
+			},
+		}
+	}
+
+	if s.guardrails.RequiresOverride(confirmation.AffectedRows) && !gjson.GetBytes(args, "allow_large_operation").Bool() {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code: -32602,
+				Message: fmt.Sprintf("These statements affect %d rows, above the large-operation threshold of %d rows. "+
+					"Confirm the row count with the user and run again with allow_large_operation=true.",
+					confirmation.AffectedRows, s.guardrails.LargeOperationRows),
+			},
+		}
+	}
+
+	ctx, cancel, timeout := s.callContext(args)
+	defer cancel()
+
+	// The token only authorizes what the user saw: the statements are
+	// rolled back and a fresh dry run returned when they affect a different
+	// number of rows
+	if err := s.confirmations.Redeem(confirmToken); err != nil {
+		s.logAudit(audit.Entry{Tool: "execute", Action: "execute", SQL: auditSQL, Outcome: audit.OutcomeRejected,
+			ConfirmToken: confirmToken, EstimatedRows: int64Ptr(confirmation.AffectedRows), Error: err.Error()})
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: err.Error(),
+			},
+		}
+	}
+	counts := confirmation.Counts
+
+	policy := s.evaluateBatchPolicy(statements, counts)
+	if err := checkPolicyAtExecute(confirmation.Policy, policy); err != nil {
+		s.logAudit(audit.Entry{Tool: "execute", Action: "execute", SQL: auditSQL, Outcome: audit.OutcomeRejected,
+			ConfirmToken: confirmToken, EstimatedRows: int64Ptr(confirmation.AffectedRows), Error: err.Error()})
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: fmt.Sprintf("Refusing to run these statements: %v.", err),
+			},
+		}
+	}
+	if policy.Outcome == policyConfirmTwice && !confirmation.SecondConfirmation {
+		return s.secondConfirmation(id, "execute", confirmation, fmt.Sprintf("these %d statements", len(statements)))
+	}
+
+	batch := make([]mysql.BatchStatement, len(statements))
+	plans := make([]*backupPlan, len(statements))
+	var backupNotes []string
+	for i, statement := range statements {
+		batch[i].SQL = statement
+		var note string
+		plans[i], note = s.planBackup(ctx, statement, counts[i])
+		if plans[i] != nil {
+			batch[i].Capture = plans[i].capture
+		} else if note != "" {
+			backupNotes = append(backupNotes, fmt.Sprintf("statement %d: %s", i+1, note))
+		}
+	}
+
+	start := time.Now()
+	entry := audit.Entry{Tool: "execute", Action: "execute", SQL: auditSQL, ConfirmToken: confirmToken,
+		EstimatedRows: int64Ptr(confirmation.AffectedRows)}
+	results, err := s.currentWriteClient().ExecuteBatch(ctx, batch, func(results []sql.Result, captured []*mysql.ResultSet) error {
+		var rowsAffected int64
+		for _, result := range results {
+			n, _ := result.RowsAffected()
+			rowsAffected += n
+		}
+		if verify != nil {
+			if err := verify.check(rowsAffected); err != nil {
+				return err
+			}
+		}
+		for i, plan := range plans {
+			if plan == nil {
+				continue
+			}
+			if err := plan.save(s.backups, s.connection, captured[i]); err != nil {
+				return fmt.Errorf("failed to back up the rows of statement %d: %w", i+1, err)
+			}
+		}
+
+		pending := entry
+		pending.Outcome = audit.OutcomePending
+		pending.ActualRows = int64Ptr(rowsAffected)
+		pending.DurationMs = time.Since(start).Milliseconds()
+		return s.recordAudit(pending)
+	})
+
+	var mismatch *rowMismatchError
+	if errors.As(err, &mismatch) {
+		s.logAudit(audit.Entry{Tool: "execute", Action: "execute", SQL: auditSQL, Outcome: audit.OutcomeRejected,
+			ConfirmToken: confirmToken, EstimatedRows: int64Ptr(confirmation.AffectedRows),
+			ActualRows: int64Ptr(mismatch.actual), Error: mismatch.Error(), DurationMs: time.Since(start).Milliseconds()})
+		return s.redoDryRun(id, args, mismatch)
+	}
+	if err != nil {
+		s.logAudit(audit.Entry{Tool: "execute", Action: "execute", SQL: auditSQL, Outcome: audit.OutcomeError,
+			ConfirmToken: confirmToken, EstimatedRows: int64Ptr(confirmation.AffectedRows),
+			Error: err.Error(), DurationMs: time.Since(start).Milliseconds()})
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32603,
+				Message: errorMessage("Execution failed, no statement was applied", err, timeout),
+			},
+		}
+	}
+
+	var total int64
+	for _, result := range results {
+		rowsAffected, _ := result.RowsAffected()
+		total += rowsAffected
+	}
+	entry.Outcome = audit.OutcomeSuccess
+	entry.ActualRows = int64Ptr(total)
+	entry.DurationMs = time.Since(start).Milliseconds()
+	auditWarning := s.recordOutcome(entry)
+
+	var summary strings.Builder
+	details := make([]map[string]interface{}, len(statements))
+	var snapshotIDs []string
+	for i, result := range results {
+		rowsAffected, _ := result.RowsAffected()
+		operation := detectQueryOperation(statements[i])
+		fmt.Fprintf(&summary, "%d. %s: %d rows\n", i+1, operation, rowsAffected)
+		details[i] = map[string]interface{}{
+			"sql":           statements[i],
+			"operation":     operation,
+			"rows_affected": rowsAffected,
+		}
+		if plans[i] != nil && plans[i].saved != nil {
+			details[i]["snapshot_id"] = plans[i].saved.ID
+			snapshotIDs = append(snapshotIDs, plans[i].saved.ID)
+		}
+	}
+
+	contentMessages := []map[string]interface{}{
+		{
+			"type": "text",
+			"text": fmt.Sprintf("✅ %d statements committed in one transaction", len(statements)),
+		},
+		{
+			"type": "text",
+			"text": strings.TrimRight(summary.String(), "\n"),
+		},
+		{
+			"type": "text",
+			"text": fmt.Sprintf("📊 Rows affected: %d in total", total),
+		},
+	}
+	if len(snapshotIDs) > 0 {
+		contentMessages = append(contentMessages, map[string]interface{}{
+			"type": "text",
+			"text": fmt.Sprintf("💾 Backups saved as snapshots %s. To undo, restore them with the undo tool in reverse order.",
+				strings.Join(snapshotIDs, ", ")),
+		})
+	}
+	if len(backupNotes) > 0 {
+		contentMessages = append(contentMessages, map[string]interface{}{
+			"type": "text",
+			"text": fmt.Sprintf("⚠️  No backup was taken for %s", strings.Join(backupNotes, "; ")),
+		})
+	}
+	if auditWarning != nil {
+		contentMessages = append(contentMessages, auditWarning)
+	}
+
+	result := map[string]interface{}{
+		"content":        contentMessages,
+		"success":        true,
+		"operation":      "BATCH",
+		"statements":     details,
+		"rows_affected":  total,
+		"estimated_rows": confirmation.AffectedRows,
+	}
+	reportRetries(ctx, result)
+	return &Response{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result:  result,
+	}
+}
@@ -3,6 +3,8 @@ package cache
 import (
 	"sync"
 	"time"
+
+	"github.com/koh-yoshimoto/mysql-mcp-server/mysql"
 )
 
 type QueryCache struct {
@@ -13,7 +15,7 @@ type QueryCache struct {
 }
 
 type CacheEntry struct {
-	Result    []map[string]interface{}
+	Result    *mysql.ResultSet
 	Timestamp time.Time
 }
 
@@ -30,7 +32,7 @@ func NewQueryCache(ttl time.Duration, maxEntries int) *QueryCache {
 	return cache
 }
 
-func (c *QueryCache) Get(query string) ([]map[string]interface{}, bool) {
+func (c *QueryCache) Get(query string) (*mysql.ResultSet, bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	
@@ -42,7 +44,7 @@ func (c *QueryCache) Get(query string) ([]map[string]interface{}, bool) {
 	return entry.Result, true
 }
 
-func (c *QueryCache) Set(query string, result []map[string]interface{}) {
+func (c *QueryCache) Set(query string, result *mysql.ResultSet) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	
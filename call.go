@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/koh-yoshimoto/mysql-mcp-server/audit"
+	"github.com/koh-yoshimoto/mysql-mcp-server/mysql"
+	"github.com/koh-yoshimoto/mysql-mcp-server/sqlparse"
+	"github.com/tidwall/gjson"
+)
+
+// callUnsafeClauses end the transaction a procedure runs in when it is dry
+// run, or make its effects impossible to judge from its body, so procedures
+// containing them are not run by the dry run.
+var callUnsafeClauses = []string{
+	"COMMIT", "ROLLBACK", "START TRANSACTION", "SET autocommit", "XA",
+	"CREATE", "DROP", "ALTER", "TRUNCATE", "RENAME", "GRANT", "REVOKE",
+	"LOCK TABLES", "UNLOCK TABLES", "FLUSH", "ANALYZE", "OPTIMIZE", "REPAIR",
+	"PREPARE", "EXECUTE", "CALL",
+}
+
+// callRollbackProblem explains why a procedure cannot be dry run in a
+// rolled-back transaction, or returns an empty string if it can.
+func (s *MCPServer) callRollbackProblem(ctx context.Context, call *sqlparse.Call) (string, error) {
+	schema, name := sqlparse.SplitTableName(call.Procedure)
+	body, found, err := s.currentReadClient().GetRoutineDefinition(ctx, schema, name, "PROCEDURE")
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("procedure %s does not exist", call.Procedure)
+	}
+	if strings.TrimSpace(body) == "" {
+		return "its body is not visible to this account, so it cannot be checked for statements that commit", nil
+	}
+	if match := sqlparse.FindClause(body, callUnsafeClauses); match != nil {
+		return fmt.Sprintf("its body contains %s, which would commit or escape the transaction", match.Name), nil
+	}
+	return "", nil
+}
+
+// handleCallTool runs the call tool: a CALL statement with the same dry run
+// and confirmation flow as execute. The dry run calls the procedure in a
+// rolled-back transaction when its body allows it and returns every result
+// set and the OUT parameters passed as user variables.
+func (s *MCPServer) handleCallTool(id interface{}, args json.RawMessage) *Response {
+	query := gjson.GetBytes(args, "sql").String()
+	call, err := sqlparse.ParseCall(query)
+	if err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: fmt.Sprintf("sql must be a single CALL statement: %v", err),
+			},
+		}
+	}
+
+	params, err := parseParams(args)
+	if err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: err.Error(),
+			},
+		}
+	}
+	statement, err := bindParams(query, params)
+	if err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: err.Error(),
+			},
+		}
+	}
+
+	dryRun := true
+	if value := gjson.GetBytes(args, "dry_run"); value.Exists() {
+		dryRun = value.Bool()
+	}
+	confirmToken := gjson.GetBytes(args, "confirm_token").String()
+
+	ctx, cancel, timeout := s.callContext(args)
+	defer cancel()
+
+	if !dryRun {
+		if confirmToken == "" {
+			return &Response{
+				JSONRPC: "2.0",
+				ID:      id,
+				Error: &Error{
+					Code:    -32602,
+					Message: "confirm_token is required when dry_run=false",
+				},
+			}
+		}
+		confirmation, err := s.confirmations.Validate(confirmToken, statementKey(query, params), s.tokenConnection())
+		if err == nil {
+			err = checkPolicyAtExecute(confirmation.Policy, s.evaluatePolicy(statement, -1))
+		}
+		if err == nil {
+			err = s.confirmations.Redeem(confirmToken)
+		}
+		if err != nil {
+			s.logAudit(audit.Entry{Tool: "call", Action: "execute", SQL: statement, Outcome: audit.OutcomeRejected,
+				ConfirmToken: confirmToken, Error: err.Error()})
+			return &Response{
+				JSONRPC: "2.0",
+				ID:      id,
+				Error: &Error{
+					Code:    -32602,
+					Message: err.Error(),
+				},
+			}
+		}
+		if confirmation.Policy.Outcome == policyConfirmTwice && !confirmation.SecondConfirmation {
+			return s.secondConfirmation(id, "call", confirmation, "this CALL")
+		}
+
+		start := time.Now()
+		entry := audit.Entry{Tool: "call", Action: "execute", SQL: statement, ConfirmToken: confirmToken}
+		result, err := s.currentWriteClient().Call(ctx, query, &mysql.CallOptions{
+			Variables: call.Variables,
+			BeforeCommit: func(*mysql.CallResult) error {
+				pending := entry
+				pending.Outcome = audit.OutcomePending
+				pending.DurationMs = time.Since(start).Milliseconds()
+				return s.recordAudit(pending)
+			},
+		}, params...)
+		if err != nil {
+			entry.Outcome = audit.OutcomeError
+			entry.Error = err.Error()
+			entry.DurationMs = time.Since(start).Milliseconds()
+			s.logAudit(entry)
+			return &Response{
+				JSONRPC: "2.0",
+				ID:      id,
+				Error: &Error{
+					Code:    -32603,
+					Message: errorMessage("Call failed", err, timeout),
+				},
+			}
+		}
+
+		entry.Outcome = audit.OutcomeSuccess
+		entry.DurationMs = time.Since(start).Milliseconds()
+		auditWarning := s.recordOutcome(entry)
+
+		contentMessages := []map[string]interface{}{
+			{
+				"type": "text",
+				"text": fmt.Sprintf("✅ CALL %s completed successfully", call.Procedure),
+			},
+		}
+		if auditWarning != nil {
+			contentMessages = append(contentMessages, auditWarning)
+		}
+		callResult := map[string]interface{}{
+			"success":   true,
+			"operation": "CALL",
+		}
+		callResult["content"] = append(contentMessages, s.renderCallResult(result, callResult)...)
+		reportRetries(ctx, callResult)
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Result:  callResult,
+		}
+	}
+
+	start := time.Now()
+	policy := s.evaluatePolicy(statement, -1)
+	if policy.Outcome == policyDeny {
+		message := policy.Describe()
+		s.logAudit(audit.Entry{Tool: "call", Action: "dry_run", SQL: statement, Outcome: audit.OutcomeRejected, Error: message})
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: fmt.Sprintf("Refusing to run this statement. %s", message),
+			},
+		}
+	}
+
+	problem, err := s.callRollbackProblem(ctx, call)
+	var result *mysql.CallResult
+	if err == nil && problem == "" {
+		result, err = s.currentWriteClient().Call(ctx, query, &mysql.CallOptions{Variables: call.Variables, Rollback: true}, params...)
+	}
+	if err != nil {
+		s.logAudit(audit.Entry{Tool: "call", Action: "dry_run", SQL: statement, Outcome: audit.OutcomeError,
+			Error: err.Error(), DurationMs: time.Since(start).Milliseconds()})
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32603,
+				Message: errorMessage("Failed to dry run the call", err, timeout),
+			},
+		}
+	}
+
+	s.confirmations.Cleanup()
+	token := s.confirmations.Issue(&ExecuteConfirmation{
+		SQL:          statementKey(query, params),
+		AffectedRows: -1,
+		Operation:    "CALL",
+		Connection:   s.tokenConnection(),
+		Policy:       policy,
+	})
+	s.logAudit(audit.Entry{Tool: "call", Action: "dry_run", SQL: statement, Outcome: audit.OutcomeSuccess,
+		ConfirmToken: token, DurationMs: time.Since(start).Milliseconds()})
+
+	contentMessages := []map[string]interface{}{
+		{
+			"type": "text",
+			"text": fmt.Sprintf("🔍 DRY RUN RESULT - Operation: CALL %s", call.Procedure),
+		},
+		{
+			"type": "text",
+			"text": policy.Describe(),
+		},
+	}
+	callResult := map[string]interface{}{
+		"operation":                  "CALL",
+		"confirm_token":              token,
+		"requires_user_confirmation": policy.RequiresConfirmation(),
+		"policy":                     policy.data(),
+		"rolled_back":                result != nil,
+	}
+
+	if result != nil {
+		contentMessages = append(contentMessages, map[string]interface{}{
+			"type": "text",
+			"text": "↩️  The procedure ran in a transaction that was rolled back. This is what it returned:",
+		})
+		contentMessages = append(contentMessages, s.renderCallResult(result, callResult)...)
+	} else {
+		contentMessages = append(contentMessages, map[string]interface{}{
+			"type": "text",
+			"text": fmt.Sprintf("⚠️  The procedure was not run for the dry run: %s. Its effects cannot be previewed.", problem),
+		})
+		callResult["not_run_reason"] = problem
+	}
+
+	contentMessages = append(contentMessages,
+		map[string]interface{}{
+			"type": "text",
+			"text": "💡 To call the procedure after user confirmation:",
+		},
+		map[string]interface{}{
+			"type": "text",
+			"text": fmt.Sprintf("Use the call tool with dry_run=false and confirm_token='%s' (single use, valid for %s)", token, s.confirmations.TTL()),
+		},
+	)
+	callResult["content"] = contentMessages
+
+	instruction := fmt.Sprintf(`IMPORTANT: Before calling this procedure, you MUST:
+1. Show the user what the dry run returned, or that it could not be run
+2. Ask the user explicitly: "Do you want to call %s?"
+3. Only proceed if the user clearly confirms`, call.Procedure)
+	if !policy.RequiresConfirmation() {
+		instruction = fmt.Sprintf("The approval policy allows calling %s without asking the user. Tell the user what you are calling", call.Procedure)
+	}
+	if policy.Outcome == policyConfirmTwice {
+		instruction += "\n- The approval policy requires two confirmations: calling with this token returns a second token. Ask the user again before using it"
+	}
+	callResult["ai_instruction"] = instruction
+
+	reportRetries(ctx, callResult)
+	return &Response{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result:  callResult,
+	}
+}
+
+// renderCallResult describes the result sets and OUT parameters of a call as
+// text and adds them to data.
+func (s *MCPServer) renderCallResult(result *mysql.CallResult, data map[string]interface{}) []map[string]interface{} {
+	var contentMessages []map[string]interface{}
+	if len(result.ResultSets) == 0 {
+		contentMessages = append(contentMessages, map[string]interface{}{
+			"type": "text",
+			"text": "The procedure returned no result sets.",
+		})
+	}
+	for i, set := range result.ResultSets {
+		contentMessages = append(contentMessages, map[string]interface{}{
+			"type": "text",
+			"text": fmt.Sprintf("Result set %d (%d rows):\n%s", i+1, set.Len(), s.formatResults(set, "table")),
+		})
+	}
+	data["result_sets"] = result.ResultSets
+
+	if result.Variables.Len() > 0 {
+		contentMessages = append(contentMessages, map[string]interface{}{
+			"type": "text",
+			"text": "📤 OUT parameters:\n" + s.formatResults(result.Variables, "table"),
+		})
+		data["out_params"] = result.Variables.Maps()[0]
+	}
+	return contentMessages
+}
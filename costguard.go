@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/koh-yoshimoto/mysql-mcp-server/mysql"
+	"github.com/tidwall/gjson"
+)
+
+// Cost guard modes.
+const (
+	costGuardOff   = "off"
+	costGuardWarn  = "warn"
+	costGuardBlock = "block"
+)
+
+// CostGuard inspects the plan of a query before it runs and flags full scans
+// of large tables, large row examinations and cartesian joins.
+type CostGuard struct {
+	// Mode is off, warn (run the query and report the findings) or block
+	// (refuse the query)
+	Mode string
+	// MaxScanRows flags full scans of tables with more rows (0 disables it)
+	MaxScanRows int64
+	// MaxExaminedRows flags plans that examine more rows in total (0 disables it)
+	MaxExaminedRows int64
+}
+
+func defaultCostGuard() CostGuard {
+	return CostGuard{
+		Mode:            costGuardOff,
+		MaxScanRows:     100000,
+		MaxExaminedRows: 1000000,
+	}
+}
+
+// loadCostGuard reads MYSQL_COST_GUARD, MYSQL_COST_GUARD_SCAN_ROWS and
+// MYSQL_COST_GUARD_EXAMINED_ROWS, keeping the defaults for unset or invalid
+// values.
+func loadCostGuard() CostGuard {
+	g := defaultCostGuard()
+
+	switch mode := strings.ToLower(os.Getenv("MYSQL_COST_GUARD")); mode {
+	case costGuardOff, costGuardWarn, costGuardBlock:
+		g.Mode = mode
+	}
+	if v, err := strconv.ParseInt(os.Getenv("MYSQL_COST_GUARD_SCAN_ROWS"), 10, 64); err == nil && v >= 0 {
+		g.MaxScanRows = v
+	}
+	if v, err := strconv.ParseInt(os.Getenv("MYSQL_COST_GUARD_EXAMINED_ROWS"), 10, 64); err == nil && v >= 0 {
+		g.MaxExaminedRows = v
+	}
+
+	return g
+}
+
+// Enabled reports whether queries are checked at all.
+func (g CostGuard) Enabled() bool {
+	return g.Mode == costGuardWarn || g.Mode == costGuardBlock
+}
+
+// planCost summarizes an EXPLAIN FORMAT=JSON plan.
+type planCost struct {
+	ExaminedRows float64
+	LargeScans   []string // tables scanned in full above the row limit
+	Cartesian    []string // tables joined without any join condition
+}
+
+// Check analyzes an EXPLAIN FORMAT=JSON plan and returns the findings that
+// exceed the limits.
+func (g CostGuard) Check(plan string) []string {
+	cost := analyzePlan(plan, g.MaxScanRows)
+
+	var findings []string
+	for _, scan := range cost.LargeScans {
+		findings = append(findings, fmt.Sprintf("full table scan of %s", scan))
+	}
+	if g.MaxExaminedRows > 0 && cost.ExaminedRows > float64(g.MaxExaminedRows) {
+		findings = append(findings, fmt.Sprintf("the plan examines about %.0f rows, more than the limit of %d",
+			cost.ExaminedRows, g.MaxExaminedRows))
+	}
+	for _, table := range cost.Cartesian {
+		findings = append(findings, fmt.Sprintf("cartesian join: %s is joined without a join condition", table))
+	}
+	return findings
+}
+
+// analyzePlan walks the query blocks of a plan, including unions, subqueries
+// and derived tables. In a nested loop each table is scanned once for every
+// row produced by the tables before it.
+func analyzePlan(plan string, maxScanRows int64) *planCost {
+	cost := &planCost{}
+
+	visit := func(table gjson.Result, prefixRows float64, joined bool) {
+		name := table.Get("table_name").String()
+		examined := table.Get("rows_examined_per_scan").Float()
+		if !table.Get("rows_examined_per_scan").Exists() {
+			// MariaDB reports the estimate as rows
+			examined = table.Get("rows").Float()
+		}
+		cost.ExaminedRows += prefixRows * examined
+
+		accessType := table.Get("access_type").String()
+		if (accessType == "ALL" || accessType == "index") && maxScanRows > 0 && examined > float64(maxScanRows) {
+			cost.LargeScans = append(cost.LargeScans, fmt.Sprintf("%s (about %.0f rows)", name, examined))
+		}
+
+		if joined && table.Get("using_join_buffer").Exists() && !table.Get("attached_condition").Exists() {
+			cost.Cartesian = append(cost.Cartesian, name)
+		}
+	}
+
+	var walk func(node gjson.Result)
+	walk = func(node gjson.Result) {
+		node.ForEach(func(key, value gjson.Result) bool {
+			switch {
+			case key.String() == "nested_loop" && value.IsArray():
+				prefixRows := 1.0
+				for i, item := range value.Array() {
+					table := item.Get("table")
+					visit(table, prefixRows, i > 0)
+					if produced := table.Get("rows_produced_per_join").Float(); produced > 0 {
+						prefixRows = produced
+					}
+					walk(table)
+				}
+			case key.String() == "table" && value.IsObject():
+				visit(value, 1, false)
+				walk(value)
+			case value.IsObject() || value.IsArray():
+				walk(value)
+			}
+			return true
+		})
+	}
+	walk(gjson.Parse(plan))
+
+	return cost
+}
+
+// checkQueryCost runs EXPLAIN FORMAT=JSON for a query and returns the cost
+// guard's findings. Plans that cannot be obtained are not held against the
+// query.
+func (s *MCPServer) checkQueryCost(ctx context.Context, query string, params []interface{}) []string {
+	if !s.costGuard.Enabled() {
+		return nil
+	}
+	server := s.currentReadClient().Server()
+	if !server.Capabilities().HasExplainFormat(mysql.ExplainJSON) {
+		log.Printf("Cost guard skipped: %s has no EXPLAIN FORMAT=JSON", server)
+		return nil
+	}
+
+	results, err := s.currentReadClient().Query(ctx, "EXPLAIN FORMAT=JSON "+query, params...)
+	if err != nil || results.Len() == 0 {
+		log.Printf("Cost guard could not explain the query: %v", err)
+		return nil
+	}
+	plan, _ := results.Get(0, "EXPLAIN").(string)
+	return s.costGuard.Check(plan)
+}
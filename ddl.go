@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/koh-yoshimoto/mysql-mcp-server/mysql"
+	"github.com/koh-yoshimoto/mysql-mcp-server/sqlparse"
+)
+
+// DDLReport is the outcome of validating a DDL statement before it is
+// confirmed.
+type DDLReport struct {
+	Kind       string
+	Table      string
+	Exists     bool
+	Validated  bool   // the statement was applied to a shadow table
+	Error      string // error the statement failed with, on the shadow table or up front
+	Note       string
+	Diff       []string
+	Shadow     *mysql.ShadowResult
+	Dependents []mysql.Dependent
+	Online     *OnlineReport
+}
+
+// validateDDL checks a DDL statement: ALTER TABLE, CREATE/DROP INDEX and
+// CREATE TABLE are applied to a shadow table in mysql.ShadowSchema, and
+// objects depending on the table are listed. It returns nil for statements
+// it does not recognize.
+func (s *MCPServer) validateDDL(ctx context.Context, query string) *DDLReport {
+	ddl := sqlparse.ParseDDL(query)
+	if ddl == nil {
+		return nil
+	}
+
+	report := &DDLReport{Kind: ddl.Kind, Table: ddl.Table}
+	schema, name := sqlparse.SplitTableName(ddl.Table)
+
+	exists, err := s.currentReadClient().TableExists(ctx, schema, name)
+	if err != nil {
+		report.Note = fmt.Sprintf("Validation unavailable: %v", err)
+		return report
+	}
+	report.Exists = exists
+
+	var like string
+	switch ddl.Kind {
+	case "ALTER TABLE", "CREATE INDEX", "DROP INDEX":
+		if !exists {
+			report.Error = fmt.Sprintf("Table %s does not exist", ddl.Table)
+			return report
+		}
+		if ddl.Renames {
+			report.Note = "Statements that rename the table are not applied to a shadow table"
+			break
+		}
+		like = ddl.Table
+		report.Validated = true
+
+	case "CREATE TABLE":
+		if exists && !strings.Contains(strings.ToUpper(query), "IF NOT EXISTS") {
+			report.Error = fmt.Sprintf("Table %s already exists", ddl.Table)
+			return report
+		}
+		if ddl.CopiesData {
+			report.Note = "CREATE TABLE ... SELECT copies data and is not applied to a shadow table"
+			break
+		}
+		report.Validated = true
+
+	default:
+		if !exists {
+			report.Error = fmt.Sprintf("Table %s does not exist", ddl.Table)
+			return report
+		}
+	}
+
+	// The shadow copy stands in for the statement's table only, so the
+	// statement would still change the others it names, such as the table
+	// EXCHANGE PARTITION swaps rows with
+	if report.Validated && len(ddl.References) > 0 {
+		report.Validated = false
+		report.Note = fmt.Sprintf("Statements that name other tables (%s) are not applied to a shadow table, as they would change those tables too",
+			strings.Join(ddl.References, ", "))
+	}
+
+	if report.Validated {
+		shadow, err := s.shadowClient().ShadowDDL(ctx, like, name, func(shadow string) string {
+			return ddl.WithTable(query, shadow)
+		})
+		if err != nil {
+			report.Validated = false
+			report.Note = fmt.Sprintf("Shadow validation unavailable: %v", err)
+		} else {
+			report.Shadow = shadow
+			switch {
+			case shadow.Err != nil && ddl.ForeignKeys:
+				// The shadow table has no foreign keys to drop
+				report.Validated = false
+				report.Note = fmt.Sprintf("Shadow validation could not check this statement, as foreign keys are not copied to the shadow table: %v", shadow.Err)
+			case shadow.Err != nil:
+				report.Error = shadow.Err.Error()
+			default:
+				if ddl.ForeignKeys {
+					report.Note = "Foreign keys are not copied to the shadow table, so their part of the statement was not checked"
+				}
+				report.Diff = diffLines(splitLines(shadow.Before), splitLines(shadow.After))
+				if ddl.Kind != "CREATE TABLE" {
+					report.Online = s.analyzeOnline(ctx, ddl, query)
+				}
+			}
+		}
+	}
+
+	if exists {
+		dependents, err := s.currentReadClient().GetDependents(ctx, schema, name)
+		if err != nil {
+			report.Note = strings.TrimSpace(report.Note + fmt.Sprintf(" Dependent objects unavailable: %v", err))
+		}
+		report.Dependents = dependents
+	}
+
+	return report
+}
+
+// Failed reports whether the statement is known to fail.
+func (r *DDLReport) Failed() bool {
+	return r.Error != ""
+}
+
+// Render describes the report as text for the dry-run response and as
+// structured data for the result.
+func (r *DDLReport) Render() (string, map[string]interface{}) {
+	var text strings.Builder
+	data := map[string]interface{}{
+		"kind":      r.Kind,
+		"table":     r.Table,
+		"exists":    r.Exists,
+		"validated": r.Validated,
+		"valid":     !r.Failed(),
+	}
+
+	switch {
+	case r.Failed() && r.Validated:
+		fmt.Fprintf(&text, "❌ Shadow validation: the statement FAILED on an empty copy of %s in %s: %s\n",
+			r.Table, mysql.ShadowSchema, r.Error)
+		data["error"] = r.Error
+	case r.Failed():
+		fmt.Fprintf(&text, "❌ The statement would fail: %s\n", r.Error)
+		data["error"] = r.Error
+	case r.Validated:
+		fmt.Fprintf(&text, "🧪 Shadow validation: the statement succeeded on an empty copy of %s in %s\n", r.Table, mysql.ShadowSchema)
+		if len(r.Diff) == 0 {
+			text.WriteString("The table definition does not change\n")
+		} else {
+			text.WriteString("Table definition changes:\n")
+			for _, line := range r.Diff {
+				text.WriteString(line + "\n")
+			}
+		}
+		data["definition_before"] = r.Shadow.Before
+		data["definition_after"] = r.Shadow.After
+		data["diff"] = r.Diff
+	}
+
+	if r.Note != "" {
+		text.WriteString(r.Note + "\n")
+		data["note"] = r.Note
+	}
+
+	if r.Online != nil {
+		onlineText, onlineData := r.Online.Render()
+		text.WriteString(onlineText + "\n")
+		data["online"] = onlineData
+	}
+
+	if len(r.Dependents) > 0 {
+		dependents := make([]map[string]interface{}, len(r.Dependents))
+		fmt.Fprintf(&text, "🔗 Dependent objects (%d):\n", len(r.Dependents))
+		for i, dependent := range r.Dependents {
+			line := fmt.Sprintf("- %s %s.%s", dependent.Type, dependent.Schema, dependent.Name)
+			if dependent.Detail != "" {
+				line += " (" + dependent.Detail + ")"
+			}
+			text.WriteString(line + "\n")
+			dependents[i] = map[string]interface{}{
+				"type":   dependent.Type,
+				"schema": dependent.Schema,
+				"name":   dependent.Name,
+				"detail": dependent.Detail,
+			}
+		}
+		data["dependents"] = dependents
+	} else if r.Exists {
+		text.WriteString("🔗 No dependent foreign keys, views, triggers or routines found\n")
+	}
+
+	return strings.TrimRight(text.String(), "\n"), data
+}
+
+// splitLines splits a table definition into lines without indentation and
+// trailing commas, so adding a last column does not change the line before.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(strings.TrimSpace(line), ",")
+	}
+	return lines
+}
+
+// diffLines returns the lines removed from a ("- ") and added in b ("+ "),
+// in order, based on their longest common subsequence.
+func diffLines(a, b []string) []string {
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diff []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			diff = append(diff, "- "+a[i])
+			i++
+		default:
+			diff = append(diff, "+ "+b[j])
+			j++
+		}
+	}
+	return diff
+}
@@ -1,34 +1,12 @@
 package format
 
 import (
-	"encoding/csv"
 	"strings"
 )
 
-func FormatCSV(results []map[string]interface{}) string {
-	if len(results) == 0 {
-		return ""
-	}
-	
+// FormatCSV renders rows whose values are in the order of headers.
+func FormatCSV(headers []string, rows [][]interface{}) string {
 	var output strings.Builder
-	writer := csv.NewWriter(&output)
-	
-	// Extract headers
-	headers := make([]string, 0)
-	for key := range results[0] {
-		headers = append(headers, key)
-	}
-	writer.Write(headers)
-	
-	// Write rows
-	for _, row := range results {
-		record := make([]string, len(headers))
-		for i, header := range headers {
-			record[i] = formatValue(row[header])
-		}
-		writer.Write(record)
-	}
-	
-	writer.Flush()
+	writeAll(NewCSVWriter(&output), headers, rows)
 	return output.String()
-}
\ No newline at end of file
+}
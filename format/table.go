@@ -2,7 +2,9 @@ package format
 
 import (
 	"fmt"
+	"io"
 	"strings"
+	"unicode/utf8"
 )
 
 type TableFormatter struct {
@@ -11,36 +13,28 @@ type TableFormatter struct {
 	widths  []int
 }
 
-func NewTableFormatter(results []map[string]interface{}) *TableFormatter {
-	if len(results) == 0 {
+// NewTableFormatter lays out rows whose values are in the order of headers.
+func NewTableFormatter(headers []string, rows [][]interface{}) *TableFormatter {
+	if len(rows) == 0 {
 		return &TableFormatter{}
 	}
-	
-	headers := make([]string, 0)
-	headerMap := make(map[string]int)
-	
-	// Extract headers maintaining order
-	for key := range results[0] {
-		headers = append(headers, key)
-		headerMap[key] = len(headers) - 1
-	}
-	
+
 	formatter := &TableFormatter{
 		headers: headers,
 		widths:  make([]int, len(headers)),
-		rows:    make([][]string, 0, len(results)),
+		rows:    make([][]string, 0, len(rows)),
 	}
-	
+
 	// Initialize widths with header lengths
 	for i, header := range headers {
 		formatter.widths[i] = len(header)
 	}
-	
+
 	// Process rows
-	for _, row := range results {
+	for _, row := range rows {
 		rowData := make([]string, len(headers))
-		for i, header := range headers {
-			value := formatValue(row[header])
+		for i, v := range row {
+			value := formatValue(v)
 			rowData[i] = value
 			if len(value) > formatter.widths[i] {
 				formatter.widths[i] = len(value)
@@ -48,7 +42,7 @@ func NewTableFormatter(results []map[string]interface{}) *TableFormatter {
 		}
 		formatter.rows = append(formatter.rows, rowData)
 	}
-	
+
 	return formatter
 }
 
@@ -56,61 +50,139 @@ func (f *TableFormatter) Render() string {
 	if len(f.headers) == 0 {
 		return "No results"
 	}
-	
+
 	var output strings.Builder
-	
-	// Top border
-	output.WriteString("┌")
-	for i, width := range f.widths {
-		output.WriteString(strings.Repeat("─", width+2))
-		if i < len(f.widths)-1 {
-			output.WriteString("┬")
-		}
+	output.WriteString(tableHead(f.headers, f.widths))
+	for _, row := range f.rows {
+		output.WriteString(tableRow(row, f.widths))
 	}
-	output.WriteString("┐\n")
-	
-	// Headers
-	output.WriteString("│")
-	for i, header := range f.headers {
-		output.WriteString(fmt.Sprintf(" %-*s │", f.widths[i], header))
+	output.WriteString(tableBorder(f.widths, "└", "┴", "┘"))
+
+	return output.String()
+}
+
+// TableWriter streams rows as a table. Column widths are taken from the
+// first rows, up to the sample size, which are held back until the widths
+// are known; longer values in later rows are cut off with "…". A result that
+// fits in the sample looks the same as with TableFormatter.
+type TableWriter struct {
+	w       io.Writer
+	sample  int
+	headers []string
+	widths  []int
+	pending [][]string
+	started bool
+}
+
+func NewTableWriter(w io.Writer, sample int) *TableWriter {
+	return &TableWriter{w: w, sample: sample}
+}
+
+func (t *TableWriter) WriteHeader(headers []string) error {
+	t.headers = headers
+	t.widths = make([]int, len(headers))
+	for i, header := range headers {
+		t.widths[i] = len(header)
 	}
-	output.WriteString("\n")
-	
-	// Header separator
-	output.WriteString("├")
-	for i, width := range f.widths {
-		output.WriteString(strings.Repeat("─", width+2))
-		if i < len(f.widths)-1 {
-			output.WriteString("┼")
+	return nil
+}
+
+func (t *TableWriter) WriteRow(row []interface{}) error {
+	values := make([]string, len(row))
+	for i, v := range row {
+		values[i] = formatValue(v)
+	}
+
+	if !t.started {
+		if len(t.pending) < t.sample {
+			for i, value := range values {
+				if len(value) > t.widths[i] {
+					t.widths[i] = len(value)
+				}
+			}
+			t.pending = append(t.pending, values)
+			return nil
+		}
+		if err := t.start(); err != nil {
+			return err
 		}
 	}
-	output.WriteString("┤\n")
-	
-	// Rows
-	for _, row := range f.rows {
-		output.WriteString("│")
-		for i, value := range row {
-			output.WriteString(fmt.Sprintf(" %-*s │", f.widths[i], value))
+
+	for i, value := range values {
+		values[i] = truncate(value, t.widths[i])
+	}
+	_, err := io.WriteString(t.w, tableRow(values, t.widths))
+	return err
+}
+
+func (t *TableWriter) Flush() error {
+	if !t.started && len(t.pending) == 0 {
+		_, err := io.WriteString(t.w, "No results")
+		return err
+	}
+	if !t.started {
+		if err := t.start(); err != nil {
+			return err
 		}
-		output.WriteString("\n")
 	}
-	
-	// Bottom border
-	output.WriteString("└")
-	for i, width := range f.widths {
+	_, err := io.WriteString(t.w, tableBorder(t.widths, "└", "┴", "┘"))
+	return err
+}
+
+// start writes the header and the rows held back for sizing the columns.
+func (t *TableWriter) start() error {
+	t.started = true
+
+	var output strings.Builder
+	output.WriteString(tableHead(t.headers, t.widths))
+	for _, row := range t.pending {
+		output.WriteString(tableRow(row, t.widths))
+	}
+	t.pending = nil
+
+	_, err := io.WriteString(t.w, output.String())
+	return err
+}
+
+func tableHead(headers []string, widths []int) string {
+	return tableBorder(widths, "┌", "┬", "┐") + "\n" +
+		tableRow(headers, widths) +
+		tableBorder(widths, "├", "┼", "┤") + "\n"
+}
+
+func tableBorder(widths []int, left, middle, right string) string {
+	var output strings.Builder
+	output.WriteString(left)
+	for i, width := range widths {
 		output.WriteString(strings.Repeat("─", width+2))
-		if i < len(f.widths)-1 {
-			output.WriteString("┴")
+		if i < len(widths)-1 {
+			output.WriteString(middle)
 		}
 	}
-	output.WriteString("┘")
-	
+	output.WriteString(right)
+	return output.String()
+}
+
+func tableRow(values []string, widths []int) string {
+	var output strings.Builder
+	output.WriteString("│")
+	for i, value := range values {
+		output.WriteString(fmt.Sprintf(" %-*s │", widths[i], value))
+	}
+	output.WriteString("\n")
 	return output.String()
 }
 
+func truncate(value string, width int) string {
+	if utf8.RuneCountInString(value) <= width || width < 1 {
+		return value
+	}
+	return string([]rune(value)[:width-1]) + "…"
+}
+
 func formatValue(v interface{}) string {
 	if v == nil {
 		return "NULL"
 	}
 	return fmt.Sprintf("%v", v)
-}
\ No newline at end of file
+}
@@ -0,0 +1,106 @@
+package format
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+)
+
+// RowWriter formats a result one row at a time as it is read, so results of
+// any size are written without holding them in memory. The header is written
+// with the first row; a result without rows produces the same output as the
+// Format functions do for it.
+type RowWriter interface {
+	WriteHeader(headers []string) error
+	WriteRow(row []interface{}) error
+	// Flush completes the output
+	Flush() error
+}
+
+// CSVWriter streams rows as CSV.
+type CSVWriter struct {
+	writer  *csv.Writer
+	headers []string
+	rows    int
+}
+
+func NewCSVWriter(w io.Writer) *CSVWriter {
+	return &CSVWriter{writer: csv.NewWriter(w)}
+}
+
+func (c *CSVWriter) WriteHeader(headers []string) error {
+	c.headers = headers
+	return nil
+}
+
+func (c *CSVWriter) WriteRow(row []interface{}) error {
+	if c.rows == 0 {
+		if err := c.writer.Write(c.headers); err != nil {
+			return err
+		}
+	}
+	c.rows++
+
+	record := make([]string, len(row))
+	for i, value := range row {
+		record[i] = formatValue(value)
+	}
+	return c.writer.Write(record)
+}
+
+func (c *CSVWriter) Flush() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+// MarkdownWriter streams rows as a Markdown table.
+type MarkdownWriter struct {
+	w       io.Writer
+	headers []string
+	rows    int
+}
+
+func NewMarkdownWriter(w io.Writer) *MarkdownWriter {
+	return &MarkdownWriter{w: w}
+}
+
+func (m *MarkdownWriter) WriteHeader(headers []string) error {
+	m.headers = headers
+	return nil
+}
+
+func (m *MarkdownWriter) WriteRow(row []interface{}) error {
+	var output strings.Builder
+	if m.rows == 0 {
+		output.WriteString("| " + strings.Join(m.headers, " | ") + " |\n")
+		output.WriteString("|" + strings.Repeat(" --- |", len(m.headers)) + "\n")
+	}
+	m.rows++
+
+	values := make([]string, len(row))
+	for i, value := range row {
+		values[i] = formatValue(value)
+	}
+	output.WriteString("| " + strings.Join(values, " | ") + " |\n")
+
+	_, err := io.WriteString(m.w, output.String())
+	return err
+}
+
+func (m *MarkdownWriter) Flush() error {
+	if m.rows == 0 {
+		_, err := io.WriteString(m.w, "No results")
+		return err
+	}
+	return nil
+}
+
+// writeAll formats rows held in memory; writing to a strings.Builder cannot
+// fail.
+func writeAll(w RowWriter, headers []string, rows [][]interface{}) {
+	w.WriteHeader(headers)
+	for _, row := range rows {
+		w.WriteRow(row)
+	}
+	w.Flush()
+}
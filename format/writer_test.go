@@ -0,0 +1,59 @@
+package format
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTableWriterMatchesFormatter(t *testing.T) {
+	headers := []string{"id", "name"}
+	rows := [][]interface{}{{int64(1), "alice"}, {int64(22), nil}}
+
+	var output strings.Builder
+	writer := NewTableWriter(&output, 10)
+	writer.WriteHeader(headers)
+	for _, row := range rows {
+		writer.WriteRow(row)
+	}
+	writer.Flush()
+
+	if expected := NewTableFormatter(headers, rows).Render(); output.String() != expected {
+		t.Errorf("TableWriter output:\n%s\nwant:\n%s", output.String(), expected)
+	}
+}
+
+func TestTableWriterTruncatesAfterSample(t *testing.T) {
+	var output strings.Builder
+	writer := NewTableWriter(&output, 1)
+	writer.WriteHeader([]string{"name"})
+	writer.WriteRow([]interface{}{"bob"})
+	writer.WriteRow([]interface{}{"christina"})
+	writer.Flush()
+
+	lines := strings.Split(output.String(), "\n")
+	if len(lines) != 6 || lines[4] != "│ chr… │" {
+		t.Errorf("Rows after the sample should be cut to the column width, got:\n%s", output.String())
+	}
+}
+
+func TestWritersWithoutRows(t *testing.T) {
+	tests := []struct {
+		name     string
+		writer   func(*strings.Builder) RowWriter
+		expected string
+	}{
+		{"csv", func(b *strings.Builder) RowWriter { return NewCSVWriter(b) }, ""},
+		{"markdown", func(b *strings.Builder) RowWriter { return NewMarkdownWriter(b) }, "No results"},
+		{"table", func(b *strings.Builder) RowWriter { return NewTableWriter(b, 10) }, "No results"},
+	}
+
+	for _, tt := range tests {
+		var output strings.Builder
+		writer := tt.writer(&output)
+		writer.WriteHeader([]string{"id"})
+		writer.Flush()
+		if output.String() != tt.expected {
+			t.Errorf("%s without rows = %q, want %q", tt.name, output.String(), tt.expected)
+		}
+	}
+}
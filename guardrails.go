@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/koh-yoshimoto/mysql-mcp-server/sqlparse"
+)
+
+// Guardrails bound what a single execute call may change.
+type Guardrails struct {
+	// RequireWhere rejects UPDATE and DELETE statements without a WHERE
+	// clause, or with one that is always true
+	RequireWhere bool
+	// MaxAffectedRows rejects statements whose dry run affects more rows (0 disables it)
+	MaxAffectedRows int64
+	// LargeOperationRows is the row count above which execution also needs
+	// allow_large_operation=true (0 disables it)
+	LargeOperationRows int64
+	// DeniedFunctions and DeniedClauses are rejected in read queries
+	DeniedFunctions []string
+	DeniedClauses   []string
+}
+
+// deniedReasons explains the default denylist entries.
+var deniedReasons = map[string]string{
+	"LOAD_FILE":                         "it reads files from the database server",
+	"SLEEP":                             "it holds a connection without doing any work",
+	"BENCHMARK":                         "it burns server CPU by design",
+	"GET_LOCK":                          "it takes a named lock that outlives the query",
+	"RELEASE_LOCK":                      "it releases named locks held by the session",
+	"RELEASE_ALL_LOCKS":                 "it releases named locks held by the session",
+	"MASTER_POS_WAIT":                   "it blocks until a replica catches up",
+	"SOURCE_POS_WAIT":                   "it blocks until a replica catches up",
+	"WAIT_FOR_EXECUTED_GTID_SET":        "it blocks until a replica catches up",
+	"WAIT_UNTIL_SQL_THREAD_AFTER_GTIDS": "it blocks until a replica catches up",
+	"SYS_EXEC":                          "it runs shell commands on the database server",
+	"SYS_EVAL":                          "it runs shell commands on the database server",
+	"INTO OUTFILE":                      "it writes a file on the database server",
+	"INTO DUMPFILE":                     "it writes a file on the database server",
+	"FOR UPDATE":                        "it locks the rows it reads",
+	"FOR SHARE":                         "it locks the rows it reads",
+	"LOCK IN SHARE MODE":                "it locks the rows it reads",
+}
+
+func defaultGuardrails() Guardrails {
+	return Guardrails{
+		RequireWhere:       true,
+		LargeOperationRows: 1000,
+		DeniedFunctions: []string{"LOAD_FILE", "SLEEP", "BENCHMARK", "GET_LOCK", "RELEASE_LOCK", "RELEASE_ALL_LOCKS",
+			"MASTER_POS_WAIT", "SOURCE_POS_WAIT", "WAIT_FOR_EXECUTED_GTID_SET", "WAIT_UNTIL_SQL_THREAD_AFTER_GTIDS",
+			"SYS_EXEC", "SYS_EVAL"},
+		DeniedClauses: []string{"INTO OUTFILE", "INTO DUMPFILE", "FOR UPDATE", "FOR SHARE", "LOCK IN SHARE MODE"},
+	}
+}
+
+// loadGuardrails reads MYSQL_REQUIRE_WHERE, MYSQL_MAX_AFFECTED_ROWS,
+// MYSQL_LARGE_OPERATION_ROWS, MYSQL_DENY_FUNCTIONS and MYSQL_DENY_CLAUSES,
+// keeping the defaults for unset or invalid values. The denylists are
+// comma-separated and replace the defaults; set them empty to allow everything.
+func loadGuardrails() Guardrails {
+	g := defaultGuardrails()
+
+	if v, err := strconv.ParseBool(os.Getenv("MYSQL_REQUIRE_WHERE")); err == nil {
+		g.RequireWhere = v
+	}
+	if v, err := strconv.ParseInt(os.Getenv("MYSQL_MAX_AFFECTED_ROWS"), 10, 64); err == nil && v >= 0 {
+		g.MaxAffectedRows = v
+	}
+	if v, err := strconv.ParseInt(os.Getenv("MYSQL_LARGE_OPERATION_ROWS"), 10, 64); err == nil && v >= 0 {
+		g.LargeOperationRows = v
+	}
+	if v, ok := os.LookupEnv("MYSQL_DENY_FUNCTIONS"); ok {
+		g.DeniedFunctions = splitList(v)
+	}
+	if v, ok := os.LookupEnv("MYSQL_DENY_CLAUSES"); ok {
+		g.DeniedClauses = splitList(v)
+	}
+
+	return g
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, strings.ToUpper(item))
+		}
+	}
+	return items
+}
+
+// CheckRead rejects read queries that call a denied function or use a denied
+// clause, as these have side effects or expose the server.
+func (g Guardrails) CheckRead(sql string) error {
+	if match := sqlparse.FindFunction(sql, g.DeniedFunctions); match != nil {
+		return fmt.Errorf("%s() is not allowed in read queries: %s", match.Name, deniedReason(match.Name))
+	}
+	if match := sqlparse.FindClause(sql, g.DeniedClauses); match != nil {
+		return fmt.Errorf("%s is not allowed in read queries: %s", match.Name, deniedReason(match.Name))
+	}
+	return nil
+}
+
+func deniedReason(name string) string {
+	if reason, ok := deniedReasons[name]; ok {
+		return reason
+	}
+	return "it is on the denylist configured with MYSQL_DENY_FUNCTIONS or MYSQL_DENY_CLAUSES"
+}
+
+// CheckStatement rejects UPDATE and DELETE statements that are not
+// restricted by a meaningful WHERE clause.
+func (g Guardrails) CheckStatement(sql string) error {
+	if !g.RequireWhere {
+		return nil
+	}
+
+	operation := detectQueryOperation(sql)
+	if operation != "UPDATE" && operation != "DELETE" {
+		return nil
+	}
+
+	dml, err := sqlparse.ParseDML(sql)
+	if err != nil {
+		return fmt.Errorf("could not parse %s statement: %v", operation, err)
+	}
+
+	if !dml.HasWhere() {
+		return fmt.Errorf("%s without a WHERE clause would affect every row of the table. "+
+			"Add a WHERE clause that selects only the rows to change", operation)
+	}
+	if sqlparse.IsTautology(dml.Where) {
+		return fmt.Errorf("%s with an always-true WHERE clause (%s) would affect every row of the table. "+
+			"Add a WHERE clause that selects only the rows to change", operation, dml.Where)
+	}
+
+	return nil
+}
+
+// CheckAffectedRows rejects statements over the hard row limit.
+func (g Guardrails) CheckAffectedRows(operation string, affectedRows int64) error {
+	if g.MaxAffectedRows > 0 && affectedRows > g.MaxAffectedRows {
+		return fmt.Errorf("%s would affect %d rows, more than the limit of %d rows. "+
+			"Split the operation into smaller batches", operation, affectedRows, g.MaxAffectedRows)
+	}
+	return nil
+}
+
+// RequiresOverride reports whether executing a statement affecting this
+// many rows needs allow_large_operation=true.
+func (g Guardrails) RequiresOverride(affectedRows int64) bool {
+	return g.LargeOperationRows > 0 && affectedRows > g.LargeOperationRows
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/koh-yoshimoto/mysql-mcp-server/sqlparse"
+)
+
+// upsertSplit divides the rows of INSERT ... ON DUPLICATE KEY UPDATE into
+// inserted, updated and unchanged rows.
+type upsertSplit struct {
+	Inserted  int64
+	Updated   int64
+	Unchanged int64
+	// Exact is false when the split assumes that no duplicate row was left
+	// unchanged
+	Exact bool
+}
+
+// splitUpsert splits the affected rows of INSERT ... ON DUPLICATE KEY UPDATE
+// of n rows. MySQL counts 1 for every inserted row, 2 for every updated row
+// and 0 for every duplicate already holding the new values, so a single row
+// splits exactly. More rows are split assuming none was left unchanged, which
+// needs a count between n and 2n. It returns nil when there is no split.
+//
+// The counts assume the driver reports changed rows, as the DSN of NewClient
+// does. With clientFoundRows=true a duplicate left unchanged would count 1,
+// like an inserted row.
+func splitUpsert(n int, affected int64) *upsertSplit {
+	rows := int64(n)
+	switch {
+	case n == 1 && affected >= 0 && affected <= 2:
+		return &upsertSplit{
+			Inserted:  boolCount(affected == 1),
+			Updated:   boolCount(affected == 2),
+			Unchanged: boolCount(affected == 0),
+			Exact:     true,
+		}
+	case n > 1 && affected >= rows && affected <= 2*rows:
+		return &upsertSplit{Inserted: 2*rows - affected, Updated: affected - rows, Exact: affected == 2*rows}
+	}
+	return nil
+}
+
+func boolCount(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// autoIncrement is how the table of an INSERT generates ids: the name of its
+// AUTO_INCREMENT column and @@auto_increment_increment, the step between ids.
+type autoIncrement struct {
+	Column    string
+	Increment int64
+}
+
+// lookupAutoIncrement finds the AUTO_INCREMENT column of the table a
+// multi-row INSERT ran against, given the increment of the connection it ran
+// on. Other statements need neither, and get only the increment.
+func (s *MCPServer) lookupAutoIncrement(ctx context.Context, query string, increment int64) autoIncrement {
+	ids := autoIncrement{Increment: increment}
+	insert := sqlparse.ParseInsert(query)
+	if insert == nil || insert.Rows < 2 || insert.Columns == nil || increment == 0 {
+		return ids
+	}
+	pk, err := s.lookupPrimaryKey(ctx, sqlparse.InsertTarget(query))
+	if err == nil && pk.AutoIncrement && len(pk.Columns) == 1 {
+		ids.Column = pk.Columns[0]
+	}
+	return ids
+}
+
+// generatesAll reports whether every row of insert had its id generated in
+// the column: the statement lists its columns and leaves that one out.
+func (ids autoIncrement) generatesAll(insert *sqlparse.Insert) bool {
+	if ids.Column == "" || ids.Increment <= 0 || insert.Columns == nil {
+		return false
+	}
+	for _, column := range insert.Columns {
+		if strings.EqualFold(column, ids.Column) {
+			return false
+		}
+	}
+	return true
+}
+
+// reportInsert adds the generated AUTO_INCREMENT ids of an INSERT or REPLACE
+// to its execute result, and for ON DUPLICATE KEY UPDATE how the affected rows
+// split into inserted and updated ones. Other statements are left alone.
+func reportInsert(query string, result sql.Result, rowsAffected int64, ids autoIncrement, executeResult map[string]interface{}) {
+	insert := sqlparse.ParseInsert(query)
+	if insert == nil {
+		return
+	}
+
+	var messages []map[string]interface{}
+	lastInsertID, err := result.LastInsertId()
+	if err == nil && lastInsertID > 0 {
+		executeResult["last_insert_id"] = lastInsertID
+		text := fmt.Sprintf("🆔 Last insert id: %d", lastInsertID)
+		// InnoDB allocates ids one increment apart to the rows of a plain
+		// multi-row INSERT ... VALUES, and LAST_INSERT_ID() is the first of
+		// them. Rows giving their own ids break the sequence.
+		if insert.Rows > 1 && !insert.Replace && !insert.OnDuplicateKeyUpdate && rowsAffected == int64(insert.Rows) && ids.generatesAll(insert) {
+			last := lastInsertID + (rowsAffected-1)*ids.Increment
+			executeResult["generated_ids"] = map[string]interface{}{"first": lastInsertID, "last": last, "step": ids.Increment}
+			text = fmt.Sprintf("🆔 Generated ids: %d to %d (%d rows)", lastInsertID, last, rowsAffected)
+			if ids.Increment > 1 {
+				text += fmt.Sprintf(", %d apart", ids.Increment)
+			}
+		} else if insert.Rows != 1 {
+			text += " (the first id generated by this statement)"
+		}
+		messages = append(messages, map[string]interface{}{"type": "text", "text": text})
+	}
+
+	if insert.OnDuplicateKeyUpdate {
+		var text string
+		if split := splitUpsert(insert.Rows, rowsAffected); split != nil {
+			executeResult["inserted_rows"] = split.Inserted
+			executeResult["updated_rows"] = split.Updated
+			executeResult["unchanged_rows"] = split.Unchanged
+			text = fmt.Sprintf("🔀 ON DUPLICATE KEY UPDATE: %d inserted, %d updated", split.Inserted, split.Updated)
+			if split.Unchanged > 0 {
+				text += fmt.Sprintf(", %d unchanged", split.Unchanged)
+			}
+			if !split.Exact {
+				text += " (assuming no duplicate row already held the new values)"
+			}
+		} else {
+			text = fmt.Sprintf("🔀 ON DUPLICATE KEY UPDATE counts 1 affected row per inserted row and 2 per updated row; the %d rows affected cannot be split exactly",
+				rowsAffected)
+		}
+		messages = append(messages, map[string]interface{}{"type": "text", "text": text})
+	}
+
+	content, _ := executeResult["content"].([]map[string]interface{})
+	executeResult["content"] = append(content, messages...)
+}
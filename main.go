@@ -2,9 +2,10 @@ package main
 
 import (
 	"bufio"
-	"crypto/md5"
-	"encoding/hex"
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -12,11 +13,15 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/koh-yoshimoto/mysql-mcp-server/audit"
+	"github.com/koh-yoshimoto/mysql-mcp-server/backup"
 	"github.com/koh-yoshimoto/mysql-mcp-server/cache"
 	"github.com/koh-yoshimoto/mysql-mcp-server/format"
 	"github.com/koh-yoshimoto/mysql-mcp-server/mysql"
+	"github.com/koh-yoshimoto/mysql-mcp-server/sqlparse"
 	"github.com/tidwall/gjson"
 )
 
@@ -42,9 +47,33 @@ type Error struct {
 type MCPServer struct {
 	reader        *bufio.Reader
 	writer        io.Writer
-	mysqlClient   *mysql.Client
 	queryCache    *cache.QueryCache
-	confirmTokens map[string]*ExecuteConfirmation
+	confirmations *ConfirmationStore
+	queryTimeout  time.Duration
+	maxRows       int
+	auditLog      *audit.Logger
+	clientInfo    *audit.ClientInfo
+	connection    string
+	guardrails    Guardrails
+	costGuard     CostGuard
+	policy        *Policy
+	backups       backup.Store
+	backupMaxRows int64
+
+	// readClient serves the read tools and writeClient dry-runs and executes
+	// statements, each with its own account and connection pool
+	readClient        *mysql.Client
+	writeClient       *mysql.Client
+	writeAfterConfirm bool
+
+	// session holds the connections opened by session_open, if any, which
+	// all tools use instead of the pools. sessionMu is held during tool calls so
+	// the idle timeout cannot close it under one.
+	session            *session
+	sessionMu          sync.Mutex
+	sessionIdleTimeout time.Duration
+	// sessionNotice tells the next tool call why the session ended
+	sessionNotice string
 }
 
 type ExecuteConfirmation struct {
@@ -52,15 +81,156 @@ type ExecuteConfirmation struct {
 	AffectedRows int64
 	Operation    string
 	Table        string
+	Connection   string
 	CreatedAt    time.Time
+	ExpiresAt    time.Time
+	// Counts are the rows each statement of a batch affected
+	Counts []int64
+	// Policy is the approval policy's decision at the dry run
+	Policy PolicyDecision
+	// SecondConfirmation marks the token issued after the first of two
+	// confirmations
+	SecondConfirmation bool
 }
 
 func NewMCPServer() *MCPServer {
 	return &MCPServer{
 		reader:        bufio.NewReader(os.Stdin),
 		writer:        os.Stdout,
-		confirmTokens: make(map[string]*ExecuteConfirmation),
+		confirmations: NewConfirmationStore(randomBytes(32), defaultConfirmTokenTTL),
+		queryTimeout:  defaultQueryTimeout,
+		guardrails:    defaultGuardrails(),
+		costGuard:     defaultCostGuard(),
+		policy:        defaultPolicy(),
+
+		sessionIdleTimeout: defaultSessionIdleTimeout,
+	}
+}
+
+// rowCheck compares the rows a statement actually affects with the count the
+// user confirmed.
+type rowCheck struct {
+	expected  int64
+	tolerance int64
+}
+
+type rowMismatchError struct {
+	rowCheck
+	actual int64
+}
+
+func (e *rowMismatchError) Error() string {
+	return fmt.Sprintf("the statement affected %d rows instead of the %d rows that were confirmed (tolerance: %d)",
+		e.actual, e.expected, e.tolerance)
+}
+
+func (c *rowCheck) check(actual int64) error {
+	diff := actual - c.expected
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff > c.tolerance {
+		return &rowMismatchError{rowCheck: *c, actual: actual}
+	}
+	return nil
+}
+
+// parseRowCheck returns the row count check for a confirmed statement. Every
+// statement that runs in a transaction is checked against the confirmed row
+// count, as that is what binds the token to the change the user saw; it
+// returns nil only for statements that cannot be rolled back, and an error
+// when row_tolerance is given for one of those.
+func (s *MCPServer) parseRowCheck(args json.RawMessage, sql string, expected int64) (*rowCheck, error) {
+	if !s.currentReadClient().CanUseTransaction(sql) || expected < 0 {
+		if gjson.GetBytes(args, "row_tolerance").Exists() {
+			return nil, fmt.Errorf("row_tolerance is not supported for %s statements, which cannot be rolled back", detectQueryOperation(sql))
+		}
+		return nil, nil
+	}
+
+	tolerance := gjson.GetBytes(args, "row_tolerance").Int()
+	if tolerance < 0 {
+		return nil, fmt.Errorf("row_tolerance must not be negative")
+	}
+	return &rowCheck{expected: expected, tolerance: tolerance}, nil
+}
+
+// redoDryRun answers an execution that was rolled back because its row count
+// diverged with a fresh dry run of the same statement.
+func (s *MCPServer) redoDryRun(id interface{}, args json.RawMessage, mismatch *rowMismatchError) *Response {
+	dryRunArgs := map[string]interface{}{}
+	json.Unmarshal(args, &dryRunArgs)
+	delete(dryRunArgs, "confirm_token")
+	dryRunArgs["dry_run"] = true
+	encoded, _ := json.Marshal(dryRunArgs)
+
+	response := s.handleExecuteTool(id, encoded)
+	notice := fmt.Sprintf("↩️  ROLLED BACK - Nothing was changed: %v.", mismatch)
+	if response.Error != nil {
+		response.Error.Message = notice + " The new dry run failed: " + response.Error.Message
+		return response
+	}
+
+	result := response.Result.(map[string]interface{})
+	contentMessages := []map[string]interface{}{
+		{
+			"type": "text",
+			"text": notice + " The data changed since the dry run; confirm the new result below with the user.",
+		},
+	}
+	if content, ok := result["content"].([]map[string]interface{}); ok {
+		contentMessages = append(contentMessages, content...)
+	}
+	result["content"] = contentMessages
+	result["rolled_back"] = true
+	result["success"] = false
+	result["actual_rows"] = mismatch.actual
+	result["confirmed_rows"] = mismatch.expected
+	return response
+}
+
+// defaultQueryTimeout applies to tool calls that do not pass timeout_ms,
+// unless overridden with MYSQL_QUERY_TIMEOUT_MS (0 disables it).
+const defaultQueryTimeout = 30 * time.Second
+
+// defaultBinaryMaxBytes is how much of a binary value is shown unless
+// overridden with MYSQL_BINARY_MAX_BYTES (0 shows every byte).
+const defaultBinaryMaxBytes = 1024
+
+// loadBinaryOptions reads how binary values are rendered from the
+// environment.
+func loadBinaryOptions() mysql.BinaryOptions {
+	options := mysql.BinaryOptions{Encoding: mysql.EncodingHex, MaxBytes: defaultBinaryMaxBytes}
+	switch encoding := strings.ToLower(os.Getenv("MYSQL_BINARY_ENCODING")); encoding {
+	case mysql.EncodingHex, mysql.EncodingBase64:
+		options.Encoding = encoding
+	}
+	if v, err := strconv.ParseBool(os.Getenv("MYSQL_BINARY_UUID")); err == nil {
+		options.UUID = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("MYSQL_BINARY_MAX_BYTES")); err == nil && v >= 0 {
+		options.MaxBytes = v
+	}
+	return options
+}
+
+// Defaults of MYSQL_RETRY_ATTEMPTS and MYSQL_RETRY_BACKOFF_MS.
+const (
+	defaultRetryAttempts = 3
+	defaultRetryBackoff  = 100 * time.Millisecond
+)
+
+// loadRetryPolicy reads how transient errors are retried from the
+// environment.
+func loadRetryPolicy() mysql.RetryPolicy {
+	policy := mysql.RetryPolicy{MaxAttempts: defaultRetryAttempts, Backoff: defaultRetryBackoff}
+	if v, err := strconv.Atoi(os.Getenv("MYSQL_RETRY_ATTEMPTS")); err == nil && v >= 1 {
+		policy.MaxAttempts = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("MYSQL_RETRY_BACKOFF_MS")); err == nil && v >= 0 {
+		policy.Backoff = time.Duration(v) * time.Millisecond
 	}
+	return policy
 }
 
 func (s *MCPServer) InitMySQL() error {
@@ -83,12 +253,126 @@ func (s *MCPServer) InitMySQL() error {
 		}
 	}
 
-	client, err := mysql.NewClient(config)
+	if timeoutStr := os.Getenv("MYSQL_QUERY_TIMEOUT_MS"); timeoutStr != "" {
+		timeoutMs, err := strconv.Atoi(timeoutStr)
+		if err == nil && timeoutMs >= 0 {
+			s.queryTimeout = time.Duration(timeoutMs) * time.Millisecond
+		}
+	}
+
+	if maxRows, err := strconv.Atoi(os.Getenv("MYSQL_MAX_RESULT_ROWS")); err == nil && maxRows >= 0 {
+		s.maxRows = maxRows
+	}
+
+	config.Binary = loadBinaryOptions()
+	config.Retry = loadRetryPolicy()
+
+	s.guardrails = loadGuardrails()
+	s.costGuard = loadCostGuard()
+	s.confirmations = loadConfirmationStore()
+	s.sessionIdleTimeout = loadSessionIdleTimeout()
+	policy, err := loadPolicy()
+	if err != nil {
+		return err
+	}
+	s.policy = policy
+
+	if v, err := strconv.ParseBool(os.Getenv("MYSQL_WRITE_AFTER_CONFIRM")); err == nil {
+		s.writeAfterConfirm = v
+	}
+
+	// The write account defaults to the read account, but even then the read
+	// pool only runs read-only transactions
+	writeConfig := *config
+	if user := os.Getenv("MYSQL_WRITE_USER"); user != "" {
+		writeConfig.User = user
+		writeConfig.Password = os.Getenv("MYSQL_WRITE_PASSWORD")
+	}
+	config.ReadOnly = true
+
+	readClient, err := mysql.NewClient(config)
 	if err != nil {
 		return fmt.Errorf("failed to create MySQL client: %w", err)
 	}
+	writeClient, err := mysql.NewClient(&writeConfig)
+	if err != nil {
+		readClient.Close()
+		return fmt.Errorf("failed to create MySQL client for the write account: %w", err)
+	}
 
-	s.mysqlClient = client
+	s.readClient = readClient
+	s.writeClient = writeClient
+	s.connection = fmt.Sprintf("%s@%s:%d/%s", config.User, config.Host, config.Port, config.Database)
+
+	if err := s.initAudit(); err != nil {
+		s.closeClients()
+		return err
+	}
+	if err := s.initBackup(); err != nil {
+		s.auditLog.Close()
+		s.closeClients()
+		return err
+	}
+	return nil
+}
+
+func (s *MCPServer) closeClients() {
+	if s.readClient != nil {
+		s.readClient.Close()
+	}
+	if s.writeClient != nil {
+		s.writeClient.Close()
+	}
+	s.readClient, s.writeClient = nil, nil
+}
+
+// shadowClient returns the client DDL is tried on shadow tables with: the
+// write account, unless MYSQL_WRITE_AFTER_CONFIRM reserves it for confirmed
+// statements. Rolled-back dry runs always use the write account, as they need
+// its privileges and their row counts must match the confirmed execution.
+func (s *MCPServer) shadowClient() *mysql.Client {
+	if s.writeAfterConfirm {
+		return s.currentReadClient()
+	}
+	return s.currentWriteClient()
+}
+
+// initAudit sets up the audit trail from MYSQL_AUDIT_LOG (a JSON Lines file,
+// rotated by MYSQL_AUDIT_LOG_MAX_SIZE_MB and MYSQL_AUDIT_LOG_MAX_FILES) and
+// MYSQL_AUDIT_TABLE. Auditing is disabled when neither is set.
+func (s *MCPServer) initAudit() error {
+	var sinks []audit.Sink
+
+	if path := os.Getenv("MYSQL_AUDIT_LOG"); path != "" {
+		maxSizeMB, maxFiles := 100, 10
+		if v, err := strconv.Atoi(os.Getenv("MYSQL_AUDIT_LOG_MAX_SIZE_MB")); err == nil && v >= 0 {
+			maxSizeMB = v
+		}
+		if v, err := strconv.Atoi(os.Getenv("MYSQL_AUDIT_LOG_MAX_FILES")); err == nil && v >= 0 {
+			maxFiles = v
+		}
+
+		sink, err := audit.NewFileSink(path, int64(maxSizeMB)*1024*1024, maxFiles)
+		if err != nil {
+			return fmt.Errorf("failed to initialize audit log: %w", err)
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if table := os.Getenv("MYSQL_AUDIT_TABLE"); table != "" {
+		sink, err := audit.NewTableSink(s.writeClient.DB(), table)
+		if err != nil {
+			for _, sink := range sinks {
+				sink.Close()
+			}
+			return fmt.Errorf("failed to initialize audit table: %w", err)
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if len(sinks) > 0 {
+		s.auditLog = audit.NewLogger(sinks...)
+	}
 	return nil
 }
 
@@ -108,9 +392,11 @@ func (s *MCPServer) Start() {
 	}
 
 	defer func() {
-		if s.mysqlClient != nil {
-			s.mysqlClient.Close()
-		}
+		s.sessionMu.Lock()
+		s.closeSession("")
+		s.sessionMu.Unlock()
+		s.auditLog.Close()
+		s.closeClients()
 	}()
 
 	scanner := bufio.NewScanner(s.reader)
@@ -159,6 +445,13 @@ func (s *MCPServer) handleRequest(req *Request) *Response {
 }
 
 func (s *MCPServer) handleInitialize(req *Request) *Response {
+	if clientInfo := gjson.GetBytes(req.Params, "clientInfo"); clientInfo.Exists() {
+		s.clientInfo = &audit.ClientInfo{
+			Name:    clientInfo.Get("name").String(),
+			Version: clientInfo.Get("version").String(),
+		}
+	}
+
 	return &Response{
 		JSONRPC: "2.0",
 		ID:      req.ID,
@@ -175,17 +468,66 @@ func (s *MCPServer) handleInitialize(req *Request) *Response {
 	}
 }
 
+// explainTool describes the explain tool, offering only the plan formats and
+// the analyze option the server supports.
+func explainTool(capabilities mysql.Capabilities) map[string]interface{} {
+	description := "Analyze the execution plan of a MySQL query to understand performance."
+	properties := map[string]interface{}{
+		"query": map[string]interface{}{
+			"type":        "string",
+			"description": "The SQL query to analyze",
+		},
+		"params": paramsSchema,
+		"timeout_ms": map[string]interface{}{
+			"type":        "integer",
+			"description": "Maximum execution time in milliseconds. Defaults to the server's configured timeout.",
+		},
+	}
+
+	if capabilities.ExplainAnalyze != "" {
+		description += fmt.Sprintf(" Use analyze=true to get actual execution statistics (%s).", capabilities.ExplainAnalyze)
+		properties["analyze"] = map[string]interface{}{
+			"type":        "boolean",
+			"description": fmt.Sprintf("If true, runs %s to get actual execution statistics. Note: This will execute the query.", capabilities.ExplainAnalyze),
+			"default":     false,
+		}
+	}
+
+	if len(capabilities.ExplainFormats) > 1 {
+		formatDescription := "Format of the plan: traditional is a table, json and tree are single documents (default: traditional)."
+		if len(capabilities.AnalyzeFormats) > 0 {
+			formatDescription += fmt.Sprintf(" With analyze=true: %s (default: %s).",
+				strings.Join(capabilities.AnalyzeFormats, ", "), capabilities.AnalyzeFormats[0])
+		}
+		properties["format"] = map[string]interface{}{
+			"type":        "string",
+			"enum":        capabilities.ExplainFormats,
+			"description": formatDescription,
+		}
+	}
+
+	return map[string]interface{}{
+		"name":        "explain",
+		"description": description,
+		"inputSchema": map[string]interface{}{
+			"type":       "object",
+			"properties": properties,
+			"required":   []string{"query"},
+		},
+	}
+}
+
 func (s *MCPServer) handleToolsList(req *Request) *Response {
 	tools := []map[string]interface{}{
 		{
 			"name":        "query",
-			"description": "Execute SELECT queries to retrieve data from MySQL database. For INSERT, UPDATE, DELETE operations, use the 'execute' tool instead.",
+			"description": "Execute SELECT queries to retrieve data from MySQL database. For INSERT, UPDATE, DELETE operations, use the 'execute' tool instead. In a session opened with 'session_open', it also runs SET, USE and CREATE or DROP TEMPORARY TABLE.",
 			"inputSchema": map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
 					"query": map[string]interface{}{
 						"type":        "string",
-						"description": "SELECT statement only. Example: SELECT * FROM users WHERE age > 18",
+						"description": "SELECT statement only, or in a session also SET, USE and CREATE or DROP TEMPORARY TABLE. Example: SELECT * FROM users WHERE age > 18",
 					},
 					"format": map[string]interface{}{
 						"type":        "string",
@@ -193,6 +535,15 @@ func (s *MCPServer) handleToolsList(req *Request) *Response {
 						"default":     "table",
 						"description": "Output format for results",
 					},
+					"params": paramsSchema,
+					"max_rows": map[string]interface{}{
+						"type":        "integer",
+						"description": "Stop after this many rows. Defaults to the server's configured limit.",
+					},
+					"timeout_ms": map[string]interface{}{
+						"type":        "integer",
+						"description": "Maximum execution time in milliseconds. Defaults to the server's configured timeout.",
+					},
 				},
 				"required": []string{"query"},
 			},
@@ -207,6 +558,12 @@ func (s *MCPServer) handleToolsList(req *Request) *Response {
 						"type":        "string",
 						"description": "INSERT, UPDATE, or DELETE statement. Example: UPDATE users SET status='active' WHERE id=123",
 					},
+					"params": paramsSchema,
+					"statements": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"description": "Instead of sql: INSERT, UPDATE or DELETE statements to run in order in one transaction, all or nothing. The dry run reports the affected rows of each statement and returns one confirm_token for all of them.",
+					},
 					"dry_run": map[string]interface{}{
 						"type":        "boolean",
 						"description": "If true, previews the operation without executing. ALWAYS use true first and ask user for confirmation before setting to false.",
@@ -216,8 +573,21 @@ func (s *MCPServer) handleToolsList(req *Request) *Response {
 						"type":        "string",
 						"description": "Token from dry-run response. Required when dry_run=false. Only use after user explicitly confirms the operation.",
 					},
+					"allow_large_operation": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Required (true) to execute operations the dry run reports as above the large-operation threshold. Only set after the user explicitly accepts the row count.",
+						"default":     false,
+					},
+					"row_tolerance": map[string]interface{}{
+						"type":        "integer",
+						"description": "The number of rows the actual count may differ from the confirmed count by before the statement is rolled back and a fresh dry run returned (default: 0). Not available for DDL statements, whose row counts are not re-checked",
+						"default":     0,
+					},
+					"timeout_ms": map[string]interface{}{
+						"type":        "integer",
+						"description": "Maximum execution time in milliseconds, also used as the lock wait limit. Defaults to the server's configured timeout.",
+					},
 				},
-				"required":             []string{"sql"},
 				"additionalProperties": false,
 			},
 		},
@@ -244,22 +614,123 @@ func (s *MCPServer) handleToolsList(req *Request) *Response {
 			},
 		},
 		{
-			"name":        "explain",
-			"description": "Analyze the execution plan of a MySQL query to understand performance. Use analyze=true to get actual execution statistics (EXPLAIN ANALYZE).",
+			"name":        "routines",
+			"description": "List the stored procedures, functions, triggers and events of the database",
 			"inputSchema": map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
-					"query": map[string]interface{}{
+					"type": map[string]interface{}{
 						"type":        "string",
-						"description": "The SQL query to analyze",
+						"enum":        objectTypeArgs,
+						"description": "Only list objects of this type",
 					},
-					"analyze": map[string]interface{}{
+					"schema": map[string]interface{}{
+						"type":        "string",
+						"description": "The schema to list. Defaults to the current database.",
+					},
+				},
+			},
+		},
+		{
+			"name":        "definition",
+			"description": "Show the full definition (SHOW CREATE) of a stored procedure, function, trigger or event",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"type": map[string]interface{}{
+						"type":        "string",
+						"enum":        objectTypeArgs,
+						"description": "The type of the object",
+					},
+					"name": map[string]interface{}{
+						"type":        "string",
+						"description": "The name of the object, optionally qualified with its schema",
+					},
+				},
+				"required": []string{"type", "name"},
+			},
+		},
+		explainTool(s.readClient.Server().Capabilities()),
+		{
+			"name":        "undo",
+			"description": "Restore the rows backed up before an UPDATE or DELETE, using the snapshot_id from the execute response. Works like execute: run with dry_run=true first, show the results to the user, and only execute with dry_run=false and the confirm_token after explicit confirmation.",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"snapshot_id": map[string]interface{}{
+						"type":        "string",
+						"description": "Snapshot id reported by the execute tool",
+					},
+					"dry_run": map[string]interface{}{
 						"type":        "boolean",
-						"description": "If true, runs EXPLAIN ANALYZE to get actual execution statistics. Note: This will execute the query.",
+						"description": "If true, previews the restore without executing. ALWAYS use true first and ask user for confirmation before setting to false.",
+						"default":     true,
+					},
+					"confirm_token": map[string]interface{}{
+						"type":        "string",
+						"description": "Token from the dry-run response. Required when dry_run=false.",
+					},
+					"allow_large_operation": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Required (true) to restore more rows than the large-operation threshold.",
 						"default":     false,
 					},
+					"timeout_ms": map[string]interface{}{
+						"type":        "integer",
+						"description": "Maximum execution time in milliseconds. Defaults to the server's configured timeout.",
+					},
 				},
-				"required": []string{"query"},
+				"required":             []string{"snapshot_id"},
+				"additionalProperties": false,
+			},
+		},
+		{
+			"name":        "call",
+			"description": "Call a stored procedure with CALL. Returns every result set and the OUT parameters passed as user variables (@name). IMPORTANT: Always run with dry_run=true first, show the results to the user, and ask for explicit confirmation before calling with dry_run=false.",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"sql": map[string]interface{}{
+						"type":        "string",
+						"description": "A single CALL statement. Pass OUT and INOUT parameters as user variables. Example: CALL close_month(?, @total)",
+					},
+					"params": paramsSchema,
+					"dry_run": map[string]interface{}{
+						"type":        "boolean",
+						"description": "If true, calls the procedure in a rolled-back transaction where possible. ALWAYS use true first and ask user for confirmation before setting to false.",
+						"default":     true,
+					},
+					"confirm_token": map[string]interface{}{
+						"type":        "string",
+						"description": "Token from the dry-run response. Required when dry_run=false.",
+					},
+					"timeout_ms": map[string]interface{}{
+						"type":        "integer",
+						"description": "Maximum execution time in milliseconds. Defaults to the server's configured timeout.",
+					},
+				},
+				"required": []string{"sql"},
+			},
+		},
+		{
+			"name":        "session_open",
+			"description": "Pin this MCP session to one dedicated connection, so that user variables, SET SESSION settings, temporary tables and USE carry over between tool calls. The read tools run on that connection until session_close, or until it has been idle for the timeout; 'execute' and 'call' run on a second connection of the write account that only follows USE. Use it to build temporary tables and query them across several 'query' calls.",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"idle_timeout_seconds": map[string]interface{}{
+						"type":        "integer",
+						"description": "Close the session after this many seconds without a tool call. Defaults to the server's configured idle timeout, which it cannot exceed.",
+					},
+				},
+			},
+		},
+		{
+			"name":        "session_close",
+			"description": "Close the session opened with session_open, discarding its variables, settings and temporary tables.",
+			"inputSchema": map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
 			},
 		},
 	}
@@ -274,7 +745,7 @@ func (s *MCPServer) handleToolsList(req *Request) *Response {
 }
 
 func (s *MCPServer) handleToolsCall(req *Request) *Response {
-	if s.mysqlClient == nil {
+	if s.readClient == nil {
 		return &Response{
 			JSONRPC: "2.0",
 			ID:      req.ID,
@@ -301,24 +772,44 @@ func (s *MCPServer) handleToolsCall(req *Request) *Response {
 		}
 	}
 
-	switch params.Name {
+	s.sessionMu.Lock()
+	defer s.sessionMu.Unlock()
+	response := s.callTool(req.ID, params.Name, params.Arguments)
+	s.afterToolCall(response)
+	return response
+}
+
+func (s *MCPServer) callTool(id interface{}, name string, arguments json.RawMessage) *Response {
+	switch name {
 	case "query":
-		return s.handleQueryTool(req.ID, params.Arguments)
+		return s.handleQueryTool(id, arguments)
 	case "execute":
-		return s.handleExecuteTool(req.ID, params.Arguments)
+		return s.handleExecuteTool(id, arguments)
 	case "schema":
-		return s.handleSchemaTool(req.ID, params.Arguments)
+		return s.handleSchemaTool(id, arguments)
 	case "tables":
-		return s.handleTablesTool(req.ID)
+		return s.handleTablesTool(id)
 	case "explain":
-		return s.handleExplainTool(req.ID, params.Arguments)
+		return s.handleExplainTool(id, arguments)
+	case "undo":
+		return s.handleUndoTool(id, arguments)
+	case "call":
+		return s.handleCallTool(id, arguments)
+	case "routines":
+		return s.handleRoutinesTool(id, arguments)
+	case "definition":
+		return s.handleDefinitionTool(id, arguments)
+	case "session_open":
+		return s.handleSessionOpenTool(id, arguments)
+	case "session_close":
+		return s.handleSessionCloseTool(id)
 	default:
 		return &Response{
 			JSONRPC: "2.0",
-			ID:      req.ID,
+			ID:      id,
 			Error: &Error{
 				Code:    -32602,
-				Message: fmt.Sprintf("Unknown tool: %s", params.Name),
+				Message: fmt.Sprintf("Unknown tool: %s", name),
 			},
 		}
 	}
@@ -334,11 +825,12 @@ func isSelectQuery(query string) bool {
 	return selectRegex.MatchString(trimmed)
 }
 
-// detectQueryOperation detects the SQL operation type
+// detectQueryOperation detects the SQL operation type. Statements led by a
+// WITH clause are classified by the statement it belongs to.
 func detectQueryOperation(query string) string {
-	trimmed := strings.TrimSpace(strings.ToUpper(query))
+	trimmed := strings.TrimSpace(strings.ToUpper(sqlparse.SkipWith(query)))
 
-	operations := []string{"INSERT", "UPDATE", "DELETE", "CREATE", "DROP", "ALTER", "TRUNCATE", "REPLACE"}
+	operations := []string{"INSERT", "UPDATE", "DELETE", "CREATE", "DROP", "ALTER", "TRUNCATE", "REPLACE", "CALL"}
 	for _, op := range operations {
 		if strings.HasPrefix(trimmed, op) {
 			return op
@@ -346,7 +838,7 @@ func detectQueryOperation(query string) string {
 	}
 
 	// Handle queries with comments
-	operationRegex := regexp.MustCompile(`^\s*(--.*\n|/\*.*?\*/)*\s*(INSERT|UPDATE|DELETE|CREATE|DROP|ALTER|TRUNCATE|REPLACE)`)
+	operationRegex := regexp.MustCompile(`^\s*(--.*\n|/\*.*?\*/)*\s*(INSERT|UPDATE|DELETE|CREATE|DROP|ALTER|TRUNCATE|REPLACE|CALL)`)
 	matches := operationRegex.FindStringSubmatch(trimmed)
 	if len(matches) > 2 {
 		return matches[2]
@@ -355,13 +847,6 @@ func detectQueryOperation(query string) string {
 	return "UNKNOWN"
 }
 
-// generateConfirmToken generates a unique token for execute confirmation
-func generateConfirmToken(sql string, affectedRows int64) string {
-	data := fmt.Sprintf("%s_%d_%d", sql, affectedRows, time.Now().UnixNano())
-	hash := md5.Sum([]byte(data))
-	return hex.EncodeToString(hash[:])[:12]
-}
-
 // convertToInt64 converts various types to int64
 func convertToInt64(v interface{}) (int64, error) {
 	switch val := v.(type) {
@@ -388,6 +873,8 @@ func convertToInt64(v interface{}) (int64, error) {
 			return 0, fmt.Errorf("cannot convert string '%s' to int64: %w", val, err)
 		}
 		return result, nil
+	case json.Number:
+		return val.Int64()
 	case []byte:
 		return convertToInt64(string(val))
 	default:
@@ -395,6 +882,113 @@ func convertToInt64(v interface{}) (int64, error) {
 	}
 }
 
+// callContext returns the context a tool call runs under, bounded by the
+// timeout_ms argument or the server's default timeout. It records the
+// retries of transient errors for reportRetries.
+func (s *MCPServer) callContext(args json.RawMessage) (context.Context, context.CancelFunc, time.Duration) {
+	timeout := s.queryTimeout
+	if ms := gjson.GetBytes(args, "timeout_ms").Int(); ms > 0 {
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+
+	base := mysql.TrackRetries(context.Background())
+	if timeout <= 0 {
+		ctx, cancel := context.WithCancel(base)
+		return ctx, cancel, 0
+	}
+	ctx, cancel := context.WithTimeout(base, timeout)
+	return ctx, cancel, timeout
+}
+
+// recordAudit appends an entry to the audit trail, if one is configured.
+func (s *MCPServer) recordAudit(entry audit.Entry) error {
+	entry.Connection = s.connection
+	entry.Client = s.clientInfo
+	return s.auditLog.Log(entry)
+}
+
+// logAudit records a call that did not modify data. A failure to write the
+// entry is logged but does not fail the call.
+func (s *MCPServer) logAudit(entry audit.Entry) {
+	if err := s.recordAudit(entry); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
+
+// executeHooks returns the hooks for mysql.Client.Execute. When verify is set
+// the affected row count is checked first, and when plan is set the affected
+// rows are captured and backed up; then the write is recorded as pending. If
+// any step fails the statement is rolled back. Statements that cannot run in a
+// transaction are backed up and recorded before they run instead, and not run
+// if that fails. The caller records the final outcome once Execute returns.
+func (s *MCPServer) executeHooks(entry audit.Entry, start time.Time, plan *backupPlan, verify *rowCheck) *mysql.ExecuteHooks {
+	hooks := &mysql.ExecuteHooks{}
+	if plan != nil {
+		hooks.Capture = plan.capture
+	}
+	pending := func(captured *mysql.ResultSet, actualRows *int64) error {
+		if plan != nil {
+			if err := plan.save(s.backups, s.connection, captured); err != nil {
+				return fmt.Errorf("failed to back up the affected rows: %w", err)
+			}
+		}
+
+		entry.Outcome = audit.OutcomePending
+		entry.ActualRows = actualRows
+		entry.DurationMs = time.Since(start).Milliseconds()
+		return s.recordAudit(entry)
+	}
+	hooks.BeforeCommit = func(result sql.Result, captured *mysql.ResultSet) error {
+		rowsAffected, _ := result.RowsAffected()
+		if verify != nil {
+			if err := verify.check(rowsAffected); err != nil {
+				return err
+			}
+		}
+		return pending(captured, int64Ptr(rowsAffected))
+	}
+	hooks.BeforeExec = func(captured *mysql.ResultSet) error {
+		return pending(captured, nil)
+	}
+	return hooks
+}
+
+// recordOutcome records the outcome of a write that has taken effect. The
+// write cannot be undone any more, so a failure to record it does not fail
+// the call: it returns a warning for the response instead, or nil.
+func (s *MCPServer) recordOutcome(entry audit.Entry) map[string]interface{} {
+	if err := s.recordAudit(entry); err != nil {
+		log.Printf("Warning: %v", err)
+		return map[string]interface{}{
+			"type": "text",
+			"text": fmt.Sprintf("⚠️  The change was applied, but its outcome could not be written to the audit log: %v. "+
+				"Its pending entry remains the last record of it.", err),
+		}
+	}
+	return nil
+}
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
+
+// errorMessage formats a failed database call for the client, explaining
+// timeouts instead of passing through the raw driver error. A zero timeout
+// means the call had no time limit, so the server's own limit was hit.
+func errorMessage(prefix string, err error, timeout time.Duration) string {
+	if errors.Is(err, mysql.ErrTimeout) && timeout <= 0 {
+		return fmt.Sprintf("%s: the server stopped the statement because it exceeded a server-side limit such as max_execution_time or innodb_lock_wait_timeout (%v). "+
+			"Use the 'explain' tool to inspect its execution plan and narrow the query, or retry once conflicting transactions have finished.",
+			prefix, err)
+	}
+	if errors.Is(err, mysql.ErrTimeout) {
+		return fmt.Sprintf("%s: the query was cut off after %dms because it exceeded its time limit. "+
+			"Use the 'explain' tool to inspect its execution plan and narrow the query, or retry with a larger timeout_ms.",
+			prefix, timeout.Milliseconds())
+	}
+	return fmt.Sprintf("%s: %v", prefix, err)
+}
+
 func (s *MCPServer) handleQueryTool(id interface{}, args json.RawMessage) *Response {
 	query := gjson.GetBytes(args, "query").String()
 	if query == "" {
@@ -408,15 +1002,65 @@ func (s *MCPServer) handleQueryTool(id interface{}, args json.RawMessage) *Respo
 		}
 	}
 
+	params, err := parseParams(args)
+	if err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: err.Error(),
+			},
+		}
+	}
+	statement, err := bindParams(query, params)
+	if err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: err.Error(),
+			},
+		}
+	}
+
+	// In a session, the query tool also changes the session's state
+	sessionStatement := sqlparse.IsSessionStatement(query)
+	if sessionStatement && s.session != nil {
+		return s.handleSessionStatement(id, args, query, statement, params)
+	}
+
 	// Validate that this is a SELECT query
 	if !isSelectQuery(query) {
 		operation := detectQueryOperation(query)
+		s.logAudit(audit.Entry{Tool: "query", Action: "query", SQL: statement, Outcome: audit.OutcomeRejected,
+			Error: "not a SELECT statement"})
+		message := fmt.Sprintf("This tool only supports SELECT queries. For %s operations, please use the 'execute' tool instead. Use the 'execute' tool with dry_run=true first to preview changes before executing data modification queries.", operation)
+		if operation == "CALL" {
+			message = "This tool only supports SELECT queries. To call a stored procedure, use the 'call' tool with dry_run=true first."
+		}
+		if sessionStatement {
+			message = "SET, USE and temporary tables only last as long as their connection, and tool calls share a pool of connections. Open a session with the 'session_open' tool first, then run this statement with the 'query' tool."
+		}
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: message,
+			},
+		}
+	}
+
+	if err := s.guardrails.CheckRead(query); err != nil {
+		s.logAudit(audit.Entry{Tool: "query", Action: "query", SQL: statement, Outcome: audit.OutcomeRejected, Error: err.Error()})
 		return &Response{
 			JSONRPC: "2.0",
 			ID:      id,
 			Error: &Error{
 				Code:    -32602,
-				Message: fmt.Sprintf("This tool only supports SELECT queries. For %s operations, please use the 'execute' tool instead. Use the 'execute' tool with dry_run=true first to preview changes before executing data modification queries.", operation),
+				Message: fmt.Sprintf("Refusing to run this query: %v.", err),
 			},
 		}
 	}
@@ -427,73 +1071,138 @@ func (s *MCPServer) handleQueryTool(id interface{}, args json.RawMessage) *Respo
 		outputFormat = "table"
 	}
 
+	// The server's limit can only be lowered per call
+	maxRows := s.maxRows
+	if n := int(gjson.GetBytes(args, "max_rows").Int()); n > 0 && (maxRows == 0 || n < maxRows) {
+		maxRows = n
+	}
+
+	ctx, cancel, timeout := s.callContext(args)
+	defer cancel()
+
 	start := time.Now()
 
 	// Check cache first if available
-	if s.queryCache != nil {
-		if cachedResults, found := s.queryCache.Get(query); found {
-			log.Printf("Cache hit for query: %s", query)
+	// Results in a session may depend on its state, so they are not cached
+	if s.queryCache != nil && s.session == nil {
+		if cachedResults, found := s.queryCache.Get(statementKey(query, params)); found {
+			log.Printf("Cache hit for query: %s", statement)
 			executionTime := time.Since(start)
+			results, truncated := limitResults(cachedResults, maxRows)
+			s.logAudit(audit.Entry{Tool: "query", Action: "query", SQL: statement, Outcome: audit.OutcomeSuccess,
+				ActualRows: int64Ptr(int64(results.Len())), DurationMs: executionTime.Milliseconds(), Cached: true})
 
-			formattedOutput := s.formatResults(cachedResults, outputFormat)
+			formattedOutput := s.formatResults(results, outputFormat)
 
+			contentMessages := []map[string]interface{}{
+				{
+					"type": "text",
+					"text": fmt.Sprintf("Query executed in %dms (cached). %s",
+						executionTime.Milliseconds(), rowsReturned(results.Len(), truncated)),
+				},
+				{
+					"type": "text",
+					"text": formattedOutput,
+				},
+			}
+			result := map[string]interface{}{
+				"columns": results.Columns,
+			}
+			if truncated {
+				result["truncated"] = true
+			}
+			if message := warningsMessage(results.Warnings); message != nil {
+				contentMessages = append(contentMessages, message)
+				result["warnings"] = results.Warnings
+			}
+			result["content"] = contentMessages
 			return &Response{
 				JSONRPC: "2.0",
 				ID:      id,
-				Result: map[string]interface{}{
-					"content": []map[string]interface{}{
-						{
-							"type": "text",
-							"text": fmt.Sprintf("Query executed in %dms (cached). %d rows returned.",
-								executionTime.Milliseconds(), len(cachedResults)),
-						},
-						{
-							"type": "text",
-							"text": formattedOutput,
-						},
-					},
-				},
+				Result:  result,
 			}
 		}
 	}
 
-	results, err := s.mysqlClient.Query(query)
+	costWarnings := s.checkQueryCost(ctx, query, params)
+	if len(costWarnings) > 0 && s.costGuard.Mode == costGuardBlock {
+		message := fmt.Sprintf("Refusing to run this query because its plan is too expensive: %s. "+
+			"Narrow it down with conditions on indexed columns or join conditions, and use the 'explain' tool to check the plan.",
+			strings.Join(costWarnings, "; "))
+		s.logAudit(audit.Entry{Tool: "query", Action: "query", SQL: statement, Outcome: audit.OutcomeRejected, Error: message})
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: message,
+			},
+		}
+	}
+
+	output, err := s.streamQuery(ctx, query, params, outputFormat, maxRows)
 	if err != nil {
+		s.logAudit(audit.Entry{Tool: "query", Action: "query", SQL: statement, Outcome: audit.OutcomeError,
+			Error: err.Error(), DurationMs: time.Since(start).Milliseconds()})
 		return &Response{
 			JSONRPC: "2.0",
 			ID:      id,
 			Error: &Error{
 				Code:    -32603,
-				Message: fmt.Sprintf("Query failed: %v", err),
+				Message: errorMessage("Query failed", err, timeout),
 			},
 		}
 	}
 
 	executionTime := time.Since(start)
+	s.logAudit(audit.Entry{Tool: "query", Action: "query", SQL: statement, Outcome: audit.OutcomeSuccess,
+		ActualRows: int64Ptr(int64(output.Rows)), DurationMs: executionTime.Milliseconds()})
+
+	// Cache the results if cache is available; truncated results are not
+	// complete and large ones were not kept, so they are not cached
+	if s.queryCache != nil && s.session == nil && output.Results != nil && !output.Truncated {
+		s.queryCache.Set(statementKey(query, params), output.Results)
+	}
 
-	// Cache the results if cache is available
-	if s.queryCache != nil {
-		s.queryCache.Set(query, results)
+	contentMessages := []map[string]interface{}{
+		{
+			"type": "text",
+			"text": fmt.Sprintf("Query executed in %dms. %s",
+				executionTime.Milliseconds(), rowsReturned(output.Rows, output.Truncated)),
+		},
+		{
+			"type": "text",
+			"text": output.Text,
+		},
+	}
+	if message := warningsMessage(output.Warnings); message != nil {
+		contentMessages = append(contentMessages, message)
+	}
+	result := map[string]interface{}{
+		"content": contentMessages,
+		"columns": output.Columns,
+	}
+	if output.Truncated {
+		result["truncated"] = true
+	}
+	if len(output.Warnings) > 0 {
+		result["warnings"] = output.Warnings
 	}
 
-	formattedOutput := s.formatResults(results, outputFormat)
+	if len(costWarnings) > 0 {
+		result["content"] = append(contentMessages, map[string]interface{}{
+			"type": "text",
+			"text": fmt.Sprintf("⚠️  Cost guard: this query is expensive: %s. Consider narrowing it down before running it again.",
+				strings.Join(costWarnings, "; ")),
+		})
+		result["cost_warnings"] = costWarnings
+	}
 
+	reportRetries(ctx, result)
 	return &Response{
 		JSONRPC: "2.0",
 		ID:      id,
-		Result: map[string]interface{}{
-			"content": []map[string]interface{}{
-				{
-					"type": "text",
-					"text": fmt.Sprintf("Query executed in %dms. %d rows returned.",
-						executionTime.Milliseconds(), len(results)),
-				},
-				{
-					"type": "text",
-					"text": formattedOutput,
-				},
-			},
-		},
+		Result:  result,
 	}
 }
 
@@ -510,7 +1219,10 @@ func (s *MCPServer) handleSchemaTool(id interface{}, args json.RawMessage) *Resp
 		}
 	}
 
-	schema, err := s.mysqlClient.GetTableSchema(table)
+	ctx, cancel, _ := s.callContext(args)
+	defer cancel()
+
+	schema, err := s.currentReadClient().GetTableSchema(ctx, table)
 	if err != nil {
 		return &Response{
 			JSONRPC: "2.0",
@@ -541,7 +1253,10 @@ func (s *MCPServer) handleSchemaTool(id interface{}, args json.RawMessage) *Resp
 }
 
 func (s *MCPServer) handleTablesTool(id interface{}) *Response {
-	tables, err := s.mysqlClient.GetTables()
+	ctx, cancel, _ := s.callContext(nil)
+	defer cancel()
+
+	tables, err := s.currentReadClient().GetTables(ctx)
 	if err != nil {
 		return &Response{
 			JSONRPC: "2.0",
@@ -589,8 +1304,47 @@ func (s *MCPServer) handleExplainTool(id interface{}, args json.RawMessage) *Res
 		}
 	}
 
+	params, err := parseParams(args)
+	if err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: err.Error(),
+			},
+		}
+	}
+	statement, err := bindParams(query, params)
+	if err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: err.Error(),
+			},
+		}
+	}
+
 	// Get analyze option
 	analyze := gjson.GetBytes(args, "analyze").Bool()
+	auditAction := "explain"
+	if analyze {
+		auditAction = "explain_analyze"
+	}
+
+	if err := s.guardrails.CheckRead(query); err != nil {
+		s.logAudit(audit.Entry{Tool: "explain", Action: auditAction, SQL: statement, Outcome: audit.OutcomeRejected, Error: err.Error()})
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: fmt.Sprintf("Refusing to explain this query: %v.", err),
+			},
+		}
+	}
 
 	// Validate that this is a SELECT query when using EXPLAIN ANALYZE
 	if analyze && !isSelectQuery(query) {
@@ -625,7 +1379,10 @@ func (s *MCPServer) handleExplainTool(id interface{}, args json.RawMessage) *Res
 		errorMessage += "EXPLAIN ANALYZE actually executes the query, so for safety it's restricted to SELECT queries only. "
 		errorMessage += suggestion + ". "
 		errorMessage += "Alternative: Use EXPLAIN (without ANALYZE) to see the execution plan without running the query."
-		
+
+		s.logAudit(audit.Entry{Tool: "explain", Action: auditAction, SQL: statement, Outcome: audit.OutcomeRejected,
+			Error: "EXPLAIN ANALYZE requires a SELECT statement"})
+
 		return &Response{
 			JSONRPC: "2.0",
 			ID:      id,
@@ -636,33 +1393,56 @@ func (s *MCPServer) handleExplainTool(id interface{}, args json.RawMessage) *Res
 		}
 	}
 
-	// Prepare EXPLAIN query
-	explainPrefix := "EXPLAIN"
-	if analyze {
-		explainPrefix = "EXPLAIN ANALYZE"
+	// Prepare the EXPLAIN query in the syntax of the server
+	explainFormat := strings.ToLower(gjson.GetBytes(args, "format").String())
+	explainPrefix, err := s.currentReadClient().Server().ExplainStatement(analyze, explainFormat)
+	if err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: err.Error(),
+			},
+		}
 	}
 	explainQuery := explainPrefix + " " + query
 
+	ctx, cancel, timeout := s.callContext(args)
+	defer cancel()
+
 	// Execute the EXPLAIN query
-	results, err := s.mysqlClient.Query(explainQuery)
+	start := time.Now()
+	results, err := s.currentReadClient().Query(ctx, explainQuery, params...)
 	if err != nil {
+		s.logAudit(audit.Entry{Tool: "explain", Action: auditAction, SQL: statement, Outcome: audit.OutcomeError,
+			Error: err.Error(), DurationMs: time.Since(start).Milliseconds()})
 		return &Response{
 			JSONRPC: "2.0",
 			ID:      id,
 			Error: &Error{
 				Code:    -32603,
-				Message: fmt.Sprintf("Failed to explain query: %v", err),
+				Message: errorMessage("Failed to explain query", err, timeout),
 			},
 		}
 	}
 
-	// Return raw EXPLAIN results in table format
+	s.logAudit(audit.Entry{Tool: "explain", Action: auditAction, SQL: statement, Outcome: audit.OutcomeSuccess,
+		DurationMs: time.Since(start).Milliseconds()})
+
+	// Return raw EXPLAIN results in table format, and JSON and tree plans,
+	// which come as a single value, as they are
 	formattedOutput := s.formatResults(results, "table")
+	if len(results.Columns) == 1 && results.Len() == 1 {
+		if plan, ok := results.Rows[0][0].(string); ok {
+			formattedOutput = plan
+		}
+	}
 
 	// Prepare header text
-	headerText := fmt.Sprintf("Execution plan for: %s", query)
+	headerText := fmt.Sprintf("Execution plan for: %s", statement)
 	if analyze {
-		headerText = fmt.Sprintf("Execution plan with actual statistics for: %s", query)
+		headerText = fmt.Sprintf("Execution plan with actual statistics for: %s", statement)
 	}
 
 	contentMessages := []map[string]interface{}{
@@ -684,17 +1464,45 @@ func (s *MCPServer) handleExplainTool(id interface{}, args json.RawMessage) *Res
 		"text": formattedOutput,
 	})
 
+	result := map[string]interface{}{}
+	if message := warningsMessage(results.Warnings); message != nil {
+		contentMessages = append(contentMessages, message)
+		result["warnings"] = results.Warnings
+	}
+	result["content"] = contentMessages
+
+	reportRetries(ctx, result)
 	return &Response{
 		JSONRPC: "2.0",
 		ID:      id,
-		Result: map[string]interface{}{
-			"content": contentMessages,
-		},
+		Result:  result,
 	}
 }
 
 func (s *MCPServer) handleExecuteTool(id interface{}, args json.RawMessage) *Response {
 	sql := gjson.GetBytes(args, "sql").String()
+
+	if gjson.GetBytes(args, "statements").Exists() {
+		statements, err := parseStatements(args)
+		if err == nil && sql != "" {
+			err = fmt.Errorf("pass either sql or statements, not both")
+		}
+		if err == nil && gjson.GetBytes(args, "params").Exists() {
+			err = fmt.Errorf("params can only be used with sql, not with statements")
+		}
+		if err != nil {
+			return &Response{
+				JSONRPC: "2.0",
+				ID:      id,
+				Error: &Error{
+					Code:    -32602,
+					Message: err.Error(),
+				},
+			}
+		}
+		return s.handleExecuteBatch(id, args, statements)
+	}
+
 	if sql == "" {
 		return &Response{
 			JSONRPC: "2.0",
@@ -706,6 +1514,38 @@ func (s *MCPServer) handleExecuteTool(id interface{}, args json.RawMessage) *Res
 		}
 	}
 
+	if detectQueryOperation(sql) == "CALL" {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: "CALL statements should use the 'call' tool instead, which returns the procedure's result sets and OUT parameters.",
+			},
+		}
+	}
+
+	// The statement is sent as written, with params bound to its
+	// placeholders; sql holds it with the values inlined for analysis
+	query := sql
+	params, err := parseParams(args)
+	if err == nil && len(params) > 0 && !isParameterizable(query) {
+		err = fmt.Errorf("params can only be used with INSERT, UPDATE, DELETE and REPLACE statements")
+	}
+	if err == nil {
+		sql, err = bindParams(query, params)
+	}
+	if err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: err.Error(),
+			},
+		}
+	}
+
 	// Check if this is a SELECT query - redirect to query tool
 	if isSelectQuery(sql) {
 		return &Response{
@@ -739,61 +1579,115 @@ func (s *MCPServer) handleExecuteTool(id interface{}, args json.RawMessage) *Res
 			}
 		}
 
-		// Validate token
-		confirmation, exists := s.confirmTokens[confirmToken]
-		if !exists {
+		// Validate token against the SQL and connection it was issued for
+		confirmation, err := s.confirmations.Validate(confirmToken, statementKey(query, params), s.tokenConnection())
+		if err != nil {
+			return &Response{
+				JSONRPC: "2.0",
+				ID:      id,
+				Error: &Error{
+					Code:    -32602,
+					Message: err.Error(),
+				},
+			}
+		}
+
+		verify, err := s.parseRowCheck(args, sql, confirmation.AffectedRows)
+		if err != nil {
 			return &Response{
 				JSONRPC: "2.0",
 				ID:      id,
 				Error: &Error{
 					Code:    -32602,
-					Message: "Invalid or expired confirmation token",
+					Message: err.Error(),
+				},
+			}
+		}
+
+		// Large operations need an explicit override on top of the token
+		if s.guardrails.RequiresOverride(confirmation.AffectedRows) && !gjson.GetBytes(args, "allow_large_operation").Bool() {
+			return &Response{
+				JSONRPC: "2.0",
+				ID:      id,
+				Error: &Error{
+					Code: -32602,
+					Message: fmt.Sprintf("This %s operation affects %d rows, above the large-operation threshold of %d rows. "+
+						"Confirm the row count with the user and run again with allow_large_operation=true.",
+						confirmation.Operation, confirmation.AffectedRows, s.guardrails.LargeOperationRows),
 				},
 			}
 		}
 
-		// Check if token is expired (5 minutes)
-		if time.Since(confirmation.CreatedAt) > 5*time.Minute {
-			delete(s.confirmTokens, confirmToken)
+		policy := s.evaluatePolicy(sql, confirmation.AffectedRows)
+		if err := checkPolicyAtExecute(confirmation.Policy, policy); err != nil {
+			s.logAudit(audit.Entry{Tool: "execute", Action: "execute", SQL: sql, Outcome: audit.OutcomeRejected,
+				ConfirmToken: confirmToken, EstimatedRows: int64Ptr(confirmation.AffectedRows), Error: err.Error()})
 			return &Response{
 				JSONRPC: "2.0",
 				ID:      id,
 				Error: &Error{
 					Code:    -32602,
-					Message: "Confirmation token has expired. Please run with dry_run=true again.",
+					Message: fmt.Sprintf("Refusing to run this statement: %v.", err),
 				},
 			}
 		}
 
-		// Verify SQL matches
-		if confirmation.SQL != sql {
+		ctx, cancel, timeout := s.callContext(args)
+		defer cancel()
+
+		// The token only authorizes the change the user actually saw: a
+		// statement that runs in a transaction is rolled back and a fresh
+		// dry run returned when it affects a different number of rows
+		if err := s.confirmations.Redeem(confirmToken); err != nil {
+			s.logAudit(audit.Entry{Tool: "execute", Action: "execute", SQL: sql, Outcome: audit.OutcomeRejected,
+				ConfirmToken: confirmToken, EstimatedRows: int64Ptr(confirmation.AffectedRows), Error: err.Error()})
 			return &Response{
 				JSONRPC: "2.0",
 				ID:      id,
 				Error: &Error{
 					Code:    -32602,
-					Message: "SQL does not match the confirmation token",
+					Message: err.Error(),
 				},
 			}
 		}
+		if policy.Outcome == policyConfirmTwice && !confirmation.SecondConfirmation {
+			return s.secondConfirmation(id, "execute", confirmation, fmt.Sprintf("this %s operation", confirmation.Operation))
+		}
 
-		// Execute the query
-		result, err := s.mysqlClient.Execute(sql)
+		// Execute the query. The backup and a pending audit entry are written
+		// before the statement commits, so an executed write can never be
+		// missing from the trail or lack its backup.
+		plan, backupNote := s.planBackup(ctx, sql, confirmation.AffectedRows)
+		start := time.Now()
+		entry := audit.Entry{Tool: "execute", Action: "execute", SQL: sql, ConfirmToken: confirmToken,
+			EstimatedRows: int64Ptr(confirmation.AffectedRows)}
+		result, err := s.currentWriteClient().Execute(ctx, query, s.executeHooks(entry, start, plan, verify), params...)
+		var mismatch *rowMismatchError
+		if errors.As(err, &mismatch) {
+			s.logAudit(audit.Entry{Tool: "execute", Action: "execute", SQL: sql, Outcome: audit.OutcomeRejected,
+				ConfirmToken: confirmToken, EstimatedRows: int64Ptr(confirmation.AffectedRows),
+				ActualRows: int64Ptr(mismatch.actual), Error: mismatch.Error(), DurationMs: time.Since(start).Milliseconds()})
+			return s.redoDryRun(id, args, mismatch)
+		}
 		if err != nil {
+			s.logAudit(audit.Entry{Tool: "execute", Action: "execute", SQL: sql, Outcome: audit.OutcomeError,
+				ConfirmToken: confirmToken, EstimatedRows: int64Ptr(confirmation.AffectedRows),
+				Error: err.Error(), DurationMs: time.Since(start).Milliseconds()})
 			return &Response{
 				JSONRPC: "2.0",
 				ID:      id,
 				Error: &Error{
 					Code:    -32603,
-					Message: fmt.Sprintf("Execution failed: %v", err),
+					Message: errorMessage("Execution failed", err, timeout),
 				},
 			}
 		}
 
-		// Clean up token
-		delete(s.confirmTokens, confirmToken)
-
 		rowsAffected, _ := result.RowsAffected()
+		entry.Outcome = audit.OutcomeSuccess
+		entry.ActualRows = int64Ptr(rowsAffected)
+		entry.DurationMs = time.Since(start).Milliseconds()
+		auditWarning := s.recordOutcome(entry)
 
 		// Prepare execution summary
 		executionSummary := fmt.Sprintf("✅ %s operation completed successfully", confirmation.Operation)
@@ -834,68 +1728,152 @@ func (s *MCPServer) handleExecuteTool(id interface{}, args json.RawMessage) *Res
 			"type": "text",
 			"text": fmt.Sprintf("🔍 SQL executed: %s", sql),
 		})
+		if message := warningsMessage(result.Warnings); message != nil {
+			contentMessages = append(contentMessages, message)
+		}
+		if message := unreadWarningsMessage(result.WarningsErr); message != nil {
+			contentMessages = append(contentMessages, message)
+		}
+		if auditWarning != nil {
+			contentMessages = append(contentMessages, auditWarning)
+		}
+
+		executeResult := map[string]interface{}{
+			"content":        contentMessages,
+			"success":        true,
+			"operation":      confirmation.Operation,
+			"rows_affected":  rowsAffected,
+			"estimated_rows": confirmation.AffectedRows,
+		}
+		if len(result.Warnings) > 0 {
+			executeResult["warnings"] = result.Warnings
+		}
+
+		if plan != nil && plan.saved != nil {
+			executeResult["snapshot_id"] = plan.saved.ID
+			executeResult["content"] = append(contentMessages, map[string]interface{}{
+				"type": "text",
+				"text": fmt.Sprintf("💾 Backup of %d rows saved as snapshot %s. Use the undo tool with this snapshot_id to restore them.",
+					len(plan.saved.Rows), plan.saved.ID),
+			})
+		} else if backupNote != "" {
+			executeResult["content"] = append(contentMessages, map[string]interface{}{
+				"type": "text",
+				"text": fmt.Sprintf("⚠️  No backup was taken: %s", backupNote),
+			})
+		}
 
+		reportInsert(sql, result, rowsAffected, s.lookupAutoIncrement(ctx, sql, result.AutoIncrementIncrement), executeResult)
+		reportRetries(ctx, executeResult)
 		return &Response{
 			JSONRPC: "2.0",
 			ID:      id,
-			Result: map[string]interface{}{
-				"content":        contentMessages,
-				"success":        true,
-				"operation":      confirmation.Operation,
-				"rows_affected":  rowsAffected,
-				"estimated_rows": confirmation.AffectedRows,
-			},
+			Result:  executeResult,
 		}
 	}
 
 	// Dry run mode - analyze the query
 	operation := detectQueryOperation(sql)
 
-	// For dry run, we need to estimate affected rows
-	isExactCount := false
-	affectedRows, err := s.estimateAffectedRows(sql)
+	if err := s.guardrails.CheckStatement(sql); err != nil {
+		s.logAudit(audit.Entry{Tool: "execute", Action: "dry_run", SQL: sql, Outcome: audit.OutcomeRejected, Error: err.Error()})
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: fmt.Sprintf("Refusing to run this statement: %v.", err),
+			},
+		}
+	}
+
+	ctx, cancel, timeout := s.callContext(args)
+	defer cancel()
+
+	// For dry run, we need to estimate affected rows and capture a preview
+	start := time.Now()
+	preview := s.buildRowPreview(ctx, sql)
+	var probe *mysql.DryRunProbe
+	if preview != nil {
+		probe = preview.Probe
+	}
+	dryRunResult, isExactCount, err := s.dryRun(ctx, query, params, probe)
 	if err != nil {
+		s.logAudit(audit.Entry{Tool: "execute", Action: "dry_run", SQL: sql, Outcome: audit.OutcomeError,
+			Error: err.Error(), DurationMs: time.Since(start).Milliseconds()})
 		return &Response{
 			JSONRPC: "2.0",
 			ID:      id,
 			Error: &Error{
 				Code:    -32603,
-				Message: fmt.Sprintf("Failed to analyze query: %v", err),
+				Message: errorMessage("Failed to analyze query", err, timeout),
+			},
+		}
+	}
+
+	affectedRows := dryRunResult.AffectedRows
+
+	if err := s.guardrails.CheckAffectedRows(operation, affectedRows); err != nil {
+		s.logAudit(audit.Entry{Tool: "execute", Action: "dry_run", SQL: sql, Outcome: audit.OutcomeRejected,
+			EstimatedRows: int64Ptr(affectedRows), Error: err.Error(), DurationMs: time.Since(start).Milliseconds()})
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: fmt.Sprintf("Refusing to run this statement: %v.", err),
 			},
 		}
 	}
+	requiresOverride := s.guardrails.RequiresOverride(affectedRows)
 
-	// Check if we can use transaction method
-	if s.mysqlClient.CanUseTransaction(sql) {
-		isExactCount = true
+	policy := s.evaluatePolicy(sql, affectedRows)
+	if policy.Outcome == policyDeny {
+		message := policy.Describe()
+		s.logAudit(audit.Entry{Tool: "execute", Action: "dry_run", SQL: sql, Outcome: audit.OutcomeRejected,
+			EstimatedRows: int64Ptr(affectedRows), Error: message, DurationMs: time.Since(start).Milliseconds()})
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: fmt.Sprintf("Refusing to run this statement. %s", message),
+			},
+		}
 	}
 
-	// Generate confirmation token
-	token := generateConfirmToken(sql, affectedRows)
+	// DDL cannot be dry-run in a transaction, so it is tried on a shadow
+	// table instead
+	ddlReport := s.validateDDL(ctx, sql)
 
-	// Store confirmation
-	s.confirmTokens[token] = &ExecuteConfirmation{
-		SQL:          sql,
+	// Clean up old tokens
+	s.confirmations.Cleanup()
+
+	// Generate confirmation token bound to this dry run
+	token := s.confirmations.Issue(&ExecuteConfirmation{
+		SQL:          statementKey(query, params),
 		AffectedRows: affectedRows,
 		Operation:    operation,
-		CreatedAt:    time.Now(),
-	}
+		Connection:   s.tokenConnection(),
+		Policy:       policy,
+	})
 
-	// Clean up old tokens
-	s.cleanupExpiredTokens()
+	s.logAudit(audit.Entry{Tool: "execute", Action: "dry_run", SQL: sql, Outcome: audit.OutcomeSuccess,
+		ConfirmToken: token, EstimatedRows: int64Ptr(affectedRows), DurationMs: time.Since(start).Milliseconds()})
 
 	warning := ""
 	warningDetail := ""
-	if affectedRows > 1000 {
+	if requiresOverride {
 		warning = fmt.Sprintf("⚠️  WARNING: This operation will affect %d rows", affectedRows)
-		warningDetail = "This is a large number of rows. Please ensure this is intentional."
+		warningDetail = fmt.Sprintf("This is above the large-operation threshold of %d rows. Executing it requires allow_large_operation=true in addition to the confirm token.",
+			s.guardrails.LargeOperationRows)
 	} else if affectedRows == -1 {
 		warning = "⚠️  WARNING: Unable to estimate affected rows for this operation"
 		warningDetail = fmt.Sprintf("Operation type: %s - This operation may affect the entire table or database structure.", operation)
 	}
 
 	// Add extra warnings for dangerous operations
-	isDangerous := false
+	isDangerous := policy.Outcome == policyConfirmTwice
 	if operation == "DROP" || operation == "TRUNCATE" || operation == "ALTER" {
 		isDangerous = true
 		if operation == "DROP" {
@@ -914,10 +1892,14 @@ func (s *MCPServer) handleExecuteTool(id interface{}, args json.RawMessage) *Res
 	}
 
 	aiInstruction := fmt.Sprintf(`IMPORTANT: Before executing this query, you MUST:
-1. Show the user this dry-run result: %s operation will affect %d rows
+1. Show the user this dry-run result: %s operation will affect %d rows, including the row preview if there is one
 2. Ask the user explicitly: "%s"
 3. Only proceed with execution if the user clearly confirms (yes, proceed, confirm, etc.)
 4. If the user declines or is unsure, do not execute the query`, operation, affectedRows, confirmationQuestion)
+	if !policy.RequiresConfirmation() {
+		aiInstruction = fmt.Sprintf(`The approval policy allows executing this %s operation affecting %d rows without asking the user.
+Tell the user what you are executing, including the row preview if there is one`, operation, affectedRows)
+	}
 
 	if warning != "" {
 		aiInstruction += fmt.Sprintf("\n5. Emphasize the warning: %s", warning)
@@ -928,6 +1910,32 @@ func (s *MCPServer) handleExecuteTool(id interface{}, args json.RawMessage) *Res
 		aiInstruction += "\n7. Remind the user this operation cannot be undone"
 	}
 
+	if policy.Outcome == policyConfirmTwice {
+		aiInstruction += "\n- The approval policy requires two confirmations: executing with this token returns a second token. Ask the user again before using it"
+	}
+	if policy.Message != "" {
+		aiInstruction += fmt.Sprintf("\n- Show the user the approval policy's message: %s", policy.Message)
+	}
+
+	if requiresOverride {
+		aiInstruction += fmt.Sprintf("\n- This operation exceeds the large-operation threshold (%d rows). Only pass allow_large_operation=true if the user explicitly accepts affecting %d rows",
+			s.guardrails.LargeOperationRows, affectedRows)
+	}
+
+	if ddlReport != nil && ddlReport.Online != nil && ddlReport.Online.BlocksWrites() {
+		aiInstruction += fmt.Sprintf("\n- This ALTER uses ALGORITHM=%s and blocks writes to the table until it finishes. Make sure the user understands the expected duration from the online DDL analysis before confirming",
+			ddlReport.Online.Algorithm)
+	}
+
+	if len(dryRunResult.Warnings) > 0 {
+		aiInstruction += "\n- MySQL reported warnings for this statement, such as truncated data or implicit conversions. Show them to the user before asking for confirmation"
+	}
+
+	if ddlReport != nil && ddlReport.Failed() {
+		aiInstruction += fmt.Sprintf("\n- The statement failed validation (%s). Tell the user it will most likely fail and propose a corrected statement instead of executing it",
+			ddlReport.Error)
+	}
+
 	affectedRowsText := fmt.Sprintf("📊 Affected rows: %d", affectedRows)
 	if isExactCount {
 		affectedRowsText = fmt.Sprintf("📊 Affected rows: %d (exact count using transaction rollback)", affectedRows)
@@ -946,6 +1954,50 @@ func (s *MCPServer) handleExecuteTool(id interface{}, args json.RawMessage) *Res
 		},
 	}
 
+	contentMessages = append(contentMessages, map[string]interface{}{
+		"type": "text",
+		"text": policy.Describe(),
+	})
+
+	if s.backups != nil && (operation == "UPDATE" || operation == "DELETE") {
+		backupText := "💾 The affected rows will be backed up before execution, so the change can be undone with the undo tool"
+		if plan, note := s.planBackup(ctx, sql, affectedRows); plan == nil {
+			backupText = fmt.Sprintf("⚠️  No backup will be taken: %s", note)
+		}
+		contentMessages = append(contentMessages, map[string]interface{}{
+			"type": "text",
+			"text": backupText,
+		})
+	}
+
+	var ddlData map[string]interface{}
+	if ddlReport != nil {
+		var ddlText string
+		ddlText, ddlData = ddlReport.Render()
+		if ddlText != "" {
+			contentMessages = append(contentMessages, map[string]interface{}{
+				"type": "text",
+				"text": ddlText,
+			})
+		}
+	}
+
+	var previewData map[string]interface{}
+	if preview != nil {
+		var previewText string
+		previewText, previewData = preview.Render(s, dryRunResult, affectedRows)
+		if previewText != "" {
+			contentMessages = append(contentMessages, map[string]interface{}{
+				"type": "text",
+				"text": previewText,
+			})
+		}
+	}
+
+	if message := warningsMessage(dryRunResult.Warnings); message != nil {
+		contentMessages = append(contentMessages, message)
+	}
+
 	if warning != "" {
 		contentMessages = append(contentMessages, map[string]interface{}{
 			"type": "text",
@@ -966,40 +2018,85 @@ func (s *MCPServer) handleExecuteTool(id interface{}, args json.RawMessage) *Res
 		},
 		map[string]interface{}{
 			"type": "text",
-			"text": fmt.Sprintf("Use the execute tool with dry_run=false and confirm_token='%s'", token),
+			"text": fmt.Sprintf("Use the execute tool with dry_run=false and confirm_token='%s' (single use, valid for %s)", token, s.confirmations.TTL()),
 		},
 	)
 
+	if requiresOverride {
+		contentMessages = append(contentMessages, map[string]interface{}{
+			"type": "text",
+			"text": "Also pass allow_large_operation=true, as this operation is above the large-operation threshold",
+		})
+	}
+
+	result := map[string]interface{}{
+		"content":                    contentMessages,
+		"affected_rows":              affectedRows,
+		"operation":                  operation,
+		"confirm_token":              token,
+		"warning":                    warning,
+		"ai_instruction":             aiInstruction,
+		"requires_user_confirmation": policy.RequiresConfirmation(),
+		"confirmation_prompt":        confirmationQuestion,
+		"is_dangerous_operation":     isDangerous,
+		"is_exact_count":             isExactCount,
+		"requires_override":          requiresOverride,
+		"policy":                     policy.data(),
+	}
+	if previewData != nil {
+		result["preview"] = previewData
+	}
+	if len(dryRunResult.Warnings) > 0 {
+		result["warnings"] = dryRunResult.Warnings
+	}
+	if ddlData != nil {
+		result["ddl_validation"] = ddlData
+	}
+
+	reportRetries(ctx, result)
 	return &Response{
 		JSONRPC: "2.0",
 		ID:      id,
-		Result: map[string]interface{}{
-			"content":                    contentMessages,
-			"affected_rows":              affectedRows,
-			"operation":                  operation,
-			"confirm_token":              token,
-			"warning":                    warning,
-			"ai_instruction":             aiInstruction,
-			"requires_user_confirmation": true,
-			"confirmation_prompt":        confirmationQuestion,
-			"is_dangerous_operation":     isDangerous,
-			"is_exact_count":             isExactCount,
-		},
+		Result:  result,
 	}
 }
 
-func (s *MCPServer) estimateAffectedRows(sql string) (int64, error) {
+// dryRun determines the rows a statement affects, with params bound to its
+// placeholders. It runs the statement in a rolled-back transaction when
+// possible, capturing the rows described by probe, and falls back to
+// estimation only for statements that cannot run in one or when the
+// transaction cannot be started. Errors of the statement or the probe are
+// returned, as executing would fail the same way. isExact reports whether the
+// transaction method was used.
+func (s *MCPServer) dryRun(ctx context.Context, sql string, params []interface{}, probe *mysql.DryRunProbe) (result *mysql.DryRunResult, isExact bool, err error) {
 	// First, try to use transaction method for accurate results
-	if s.mysqlClient.CanUseTransaction(sql) {
-		affectedRows, err := s.mysqlClient.ExecuteInTransaction(sql)
+	if s.currentReadClient().CanUseTransaction(sql) {
+		result, err := s.currentWriteClient().ExecuteInTransaction(ctx, sql, probe, params...)
 		if err == nil {
 			// Successfully got exact count using transaction
-			return affectedRows, nil
+			return result, true, nil
+		}
+		// A timed-out dry run would time out again as an estimate
+		if !errors.Is(err, mysql.ErrNoTransaction) || errors.Is(err, mysql.ErrTimeout) {
+			return nil, false, err
 		}
-		// If transaction method failed, fall back to estimation
-		log.Printf("Transaction method failed, falling back to estimation: %v", err)
+		log.Printf("Transaction method unavailable, falling back to estimation: %v", err)
+	}
+
+	bound, err := bindParams(sql, params)
+	if err != nil {
+		return nil, false, err
+	}
+	affectedRows, err := s.estimateAffectedRows(ctx, bound)
+	if err != nil {
+		return nil, false, err
 	}
+	return &mysql.DryRunResult{AffectedRows: affectedRows}, false, nil
+}
 
+// estimateAffectedRows estimates the rows affected by statements that cannot
+// be dry-run in a transaction.
+func (s *MCPServer) estimateAffectedRows(ctx context.Context, sql string) (int64, error) {
 	// Fall back to estimation for DDL statements or if transaction failed
 	operation := detectQueryOperation(sql)
 
@@ -1007,12 +2104,12 @@ func (s *MCPServer) estimateAffectedRows(sql string) (int64, error) {
 	case "DELETE":
 		// Convert DELETE to SELECT COUNT(*) to estimate rows
 		selectQuery := regexp.MustCompile(`(?i)DELETE\s+FROM`).ReplaceAllString(sql, "SELECT COUNT(*) as count FROM")
-		results, err := s.mysqlClient.Query(selectQuery)
+		results, err := s.currentReadClient().Query(ctx, selectQuery)
 		if err != nil {
 			return 0, err
 		}
-		if len(results) > 0 {
-			if countVal, exists := results[0]["count"]; exists {
+		if results.Len() > 0 {
+			if countVal := results.Get(0, "count"); countVal != nil {
 				count, err := convertToInt64(countVal)
 				if err != nil {
 					return 0, fmt.Errorf("failed to convert count: %w", err)
@@ -1033,12 +2130,12 @@ func (s *MCPServer) estimateAffectedRows(sql string) (int64, error) {
 				whereClause = matches[2]
 			}
 			selectQuery := fmt.Sprintf("SELECT COUNT(*) as count FROM %s %s", table, whereClause)
-			results, err := s.mysqlClient.Query(selectQuery)
+			results, err := s.currentReadClient().Query(ctx, selectQuery)
 			if err != nil {
 				return 0, err
 			}
-			if len(results) > 0 {
-				switch v := results[0]["count"].(type) {
+			if results.Len() > 0 {
+				switch v := results.Get(0, "count").(type) {
 				case int64:
 					return v, nil
 				case string:
@@ -1072,13 +2169,13 @@ func (s *MCPServer) estimateAffectedRows(sql string) (int64, error) {
 		if len(matches) > 1 {
 			table := strings.Trim(matches[1], "`\"'")
 			selectQuery := fmt.Sprintf("SELECT COUNT(*) as count FROM `%s`", table)
-			results, err := s.mysqlClient.Query(selectQuery)
+			results, err := s.currentReadClient().Query(ctx, selectQuery)
 			if err != nil {
 				// If we can't get count, return -1 to indicate unknown
 				return -1, nil
 			}
-			if len(results) > 0 {
-				if countVal, exists := results[0]["count"]; exists {
+			if results.Len() > 0 {
+				if countVal := results.Get(0, "count"); countVal != nil {
 					count, err := convertToInt64(countVal)
 					if err != nil {
 						return -1, nil
@@ -1098,28 +2195,22 @@ func (s *MCPServer) estimateAffectedRows(sql string) (int64, error) {
 	return 0, nil
 }
 
-func (s *MCPServer) cleanupExpiredTokens() {
-	now := time.Now()
-	for token, confirmation := range s.confirmTokens {
-		if now.Sub(confirmation.CreatedAt) > 5*time.Minute {
-			delete(s.confirmTokens, token)
-		}
-	}
-}
-
-func (s *MCPServer) formatResults(results []map[string]interface{}, outputFormat string) string {
-	if len(results) == 0 {
+// formatResults renders a result set with its columns in query order. JSON
+// output lists the columns with their types and the rows as arrays, so
+// duplicate column names survive and numbers stay numbers.
+func (s *MCPServer) formatResults(results *mysql.ResultSet, outputFormat string) string {
+	if results.Len() == 0 {
 		return "No results"
 	}
 
 	switch outputFormat {
 	case "table":
-		formatter := format.NewTableFormatter(results)
+		formatter := format.NewTableFormatter(results.ColumnNames(), results.Rows)
 		return formatter.Render()
 	case "csv":
-		return format.FormatCSV(results)
+		return format.FormatCSV(results.ColumnNames(), results.Rows)
 	case "markdown":
-		return format.FormatMarkdown(results)
+		return format.FormatMarkdown(results.ColumnNames(), results.Rows)
 	case "json":
 		fallthrough
 	default:
@@ -1128,12 +2219,14 @@ func (s *MCPServer) formatResults(results []map[string]interface{}, outputFormat
 	}
 }
 
-func formatResults(results []map[string]interface{}) string {
-	if len(results) == 0 {
+// formatResults renders rows as a JSON array of objects, which suits result
+// sets with unique column names such as DESCRIBE output.
+func formatResults(results *mysql.ResultSet) string {
+	if results.Len() == 0 {
 		return "No results"
 	}
 
-	output, _ := json.MarshalIndent(results, "", "  ")
+	output, _ := json.MarshalIndent(results.Maps(), "", "  ")
 	return string(output)
 }
 
@@ -1,12 +1,24 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	sqldriver "database/sql/driver"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"regexp"
 	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	driver "github.com/go-sql-driver/mysql"
+	"github.com/koh-yoshimoto/mysql-mcp-server/audit"
+	"github.com/koh-yoshimoto/mysql-mcp-server/backup"
+	"github.com/koh-yoshimoto/mysql-mcp-server/mysql"
+	"github.com/koh-yoshimoto/mysql-mcp-server/sqlparse"
 )
 
 func TestIsSelectQuery(t *testing.T) {
@@ -113,6 +125,11 @@ func TestDetectQueryOperation(t *testing.T) {
 			query:    "TRUNCATE TABLE users",
 			expected: "TRUNCATE",
 		},
+		{
+			name:     "CALL statement",
+			query:    "CALL close_month(2024, @total)",
+			expected: "CALL",
+		},
 		{
 			name:     "SELECT query",
 			query:    "SELECT * FROM users",
@@ -123,6 +140,21 @@ func TestDetectQueryOperation(t *testing.T) {
 			query:    "update users set name = 'John'",
 			expected: "UPDATE",
 		},
+		{
+			name:     "DELETE with a WITH clause",
+			query:    "WITH x AS (SELECT 1) DELETE FROM orders",
+			expected: "DELETE",
+		},
+		{
+			name:     "UPDATE with a recursive WITH clause",
+			query:    "/* nightly */ WITH RECURSIVE ids (n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM ids WHERE n < 5) UPDATE orders SET paid = 1 WHERE id IN (SELECT n FROM ids)",
+			expected: "UPDATE",
+		},
+		{
+			name:     "SELECT with a WITH clause",
+			query:    "WITH x AS (SELECT 1) SELECT * FROM x",
+			expected: "UNKNOWN",
+		},
 	}
 
 	for _, tt := range tests {
@@ -135,18 +167,64 @@ func TestDetectQueryOperation(t *testing.T) {
 	}
 }
 
-func TestGenerateConfirmToken(t *testing.T) {
-	token1 := generateConfirmToken("UPDATE users SET status = 'active'", 100)
-	token2 := generateConfirmToken("UPDATE users SET status = 'active'", 100)
+func TestConfirmationStoreIssue(t *testing.T) {
+	store := NewConfirmationStore([]byte("secret"), 5*time.Minute)
+	token1 := store.Issue(&ExecuteConfirmation{SQL: "UPDATE users SET status = 'active'", AffectedRows: 100})
+	token2 := store.Issue(&ExecuteConfirmation{SQL: "UPDATE users SET status = 'active'", AffectedRows: 100})
 
-	// Tokens should be different even with same input (due to timestamp)
+	// Tokens should be different even with same input (due to the nonce)
 	if token1 == token2 {
-		t.Error("generateConfirmToken should generate different tokens for same input")
+		t.Error("Issue should generate different tokens for same input")
+	}
+
+	// Token is a 16 character nonce and a 64 character HMAC
+	if len(token1) != 81 {
+		t.Errorf("Token length = %d, want 81", len(token1))
+	}
+
+	// A token from a store with another secret does not validate
+	other := NewConfirmationStore([]byte("other"), 5*time.Minute)
+	otherToken := other.Issue(&ExecuteConfirmation{SQL: "UPDATE users SET status = 'active'", AffectedRows: 100})
+	store.confirmations[otherToken] = other.confirmations[otherToken]
+	if _, err := store.Validate(otherToken, "UPDATE users SET status = 'active'", ""); err == nil {
+		t.Error("Token signed with another secret should not validate")
 	}
+}
+
+func TestConfirmationStoreRedeem(t *testing.T) {
+	store := NewConfirmationStore([]byte("secret"), 5*time.Minute)
+	sql := "UPDATE users SET status = 'active' WHERE id < 100"
+	token := store.Issue(&ExecuteConfirmation{SQL: sql, AffectedRows: 10, Connection: "app@db:3306/shop"})
+
+	// Bound to the connection
+	if _, err := store.Validate(token, sql, "app@other:3306/shop"); err == nil {
+		t.Error("Token should not validate for another connection")
+	}
+
+	// Single use, even when redeemed concurrently
+	token = store.Issue(&ExecuteConfirmation{SQL: sql, AffectedRows: 10, Connection: "app@db:3306/shop"})
+	if _, err := store.Validate(token, sql, "app@db:3306/shop"); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	successes := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if store.Redeem(token) == nil {
+				mu.Lock()
+				successes++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
 
-	// Token should have expected length (12 characters)
-	if len(token1) != 12 {
-		t.Errorf("Token length = %d, want 12", len(token1))
+	if successes != 1 {
+		t.Errorf("Token redeemed %d times, want exactly once", successes)
 	}
 }
 
@@ -250,13 +328,11 @@ func TestHandleExecuteToolConfirmation(t *testing.T) {
 
 	// Manually create a confirmation token for testing
 	sql := "UPDATE users SET status = 'active'"
-	token := generateConfirmToken(sql, 10)
-	server.confirmTokens[token] = &ExecuteConfirmation{
+	token := server.confirmations.Issue(&ExecuteConfirmation{
 		SQL:          sql,
 		AffectedRows: 10,
 		Operation:    "UPDATE",
-		CreatedAt:    time.Now(),
-	}
+	})
 
 	// Test execution without token
 	args2, _ := json.Marshal(map[string]interface{}{
@@ -308,13 +384,12 @@ func TestHandleExecuteToolTokenExpiration(t *testing.T) {
 
 	// Create a confirmation with past timestamp
 	sql := "UPDATE users SET status = 'active'"
-	token := generateConfirmToken(sql, 10)
-	server.confirmTokens[token] = &ExecuteConfirmation{
+	token := server.confirmations.Issue(&ExecuteConfirmation{
 		SQL:          sql,
 		AffectedRows: 10,
 		Operation:    "UPDATE",
 		CreatedAt:    time.Now().Add(-6 * time.Minute), // 6 minutes ago
-	}
+	})
 
 	// Try to use expired token
 	args, _ := json.Marshal(map[string]interface{}{
@@ -332,39 +407,47 @@ func TestHandleExecuteToolTokenExpiration(t *testing.T) {
 	}
 
 	// Token should be removed
-	if _, exists := server.confirmTokens[token]; exists {
+	if _, exists := server.confirmations.confirmations[token]; exists {
 		t.Error("Expired token should be removed")
 	}
 }
 
 func TestCleanupExpiredTokens(t *testing.T) {
-	server := NewMCPServer()
+	store := NewConfirmationStore([]byte("secret"), 5*time.Minute)
 
 	// Add some tokens with different ages
-	server.confirmTokens["fresh"] = &ExecuteConfirmation{
+	fresh := store.Issue(&ExecuteConfirmation{
 		CreatedAt: time.Now(),
-	}
-	server.confirmTokens["old"] = &ExecuteConfirmation{
+	})
+	old := store.Issue(&ExecuteConfirmation{
 		CreatedAt: time.Now().Add(-10 * time.Minute),
-	}
-	server.confirmTokens["very_old"] = &ExecuteConfirmation{
+	})
+	veryOld := store.Issue(&ExecuteConfirmation{
 		CreatedAt: time.Now().Add(-30 * time.Minute),
-	}
+	})
 
-	server.cleanupExpiredTokens()
+	store.Cleanup()
 
 	// Fresh token should remain
-	if _, exists := server.confirmTokens["fresh"]; !exists {
+	if _, exists := store.confirmations[fresh]; !exists {
 		t.Error("Fresh token should not be removed")
 	}
 
 	// Old tokens should be removed
-	if _, exists := server.confirmTokens["old"]; exists {
+	if _, exists := store.confirmations[old]; exists {
 		t.Error("Old token should be removed")
 	}
-	if _, exists := server.confirmTokens["very_old"]; exists {
+	if _, exists := store.confirmations[veryOld]; exists {
 		t.Error("Very old token should be removed")
 	}
+
+	// The TTL is configurable
+	short := NewConfirmationStore([]byte("secret"), time.Minute)
+	token := short.Issue(&ExecuteConfirmation{CreatedAt: time.Now().Add(-2 * time.Minute)})
+	short.Cleanup()
+	if _, exists := short.confirmations[token]; exists {
+		t.Error("Token older than a custom TTL should be removed")
+	}
 }
 
 // TestExplainAnalyzeValidation tests that EXPLAIN ANALYZE rejects non-SELECT queries
@@ -451,3 +534,1294 @@ func TestExplainAnalyzeValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestCallContextTimeout(t *testing.T) {
+	server := NewMCPServer()
+
+	// Default timeout applies when timeout_ms is absent
+	args, _ := json.Marshal(map[string]interface{}{"query": "SELECT 1"})
+	ctx, cancel, timeout := server.callContext(args)
+	defer cancel()
+	if timeout != defaultQueryTimeout {
+		t.Errorf("timeout = %v, want %v", timeout, defaultQueryTimeout)
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		t.Error("Context should have a deadline")
+	}
+
+	// timeout_ms overrides the default
+	args, _ = json.Marshal(map[string]interface{}{"query": "SELECT 1", "timeout_ms": 1500})
+	_, cancel2, timeout := server.callContext(args)
+	defer cancel2()
+	if timeout != 1500*time.Millisecond {
+		t.Errorf("timeout = %v, want 1.5s", timeout)
+	}
+
+	// A zero default disables the timeout
+	server.queryTimeout = 0
+	ctx, cancel3, _ := server.callContext(nil)
+	defer cancel3()
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("Context should not have a deadline when timeouts are disabled")
+	}
+}
+
+func TestErrorMessageTimeout(t *testing.T) {
+	err := fmt.Errorf("query failed: %w", mysql.ErrTimeout)
+	msg := errorMessage("Query failed", err, 2*time.Second)
+	if !strings.Contains(msg, "cut off after 2000ms") || !strings.Contains(msg, "explain") {
+		t.Errorf("Timeout message should explain the cut-off and suggest explain, got %q", msg)
+	}
+
+	msg = errorMessage("Query failed", err, 0)
+	if strings.Contains(msg, "0ms") || !strings.Contains(msg, "server-side limit") {
+		t.Errorf("Timeout message without a time limit should blame the server's limit, got %q", msg)
+	}
+
+	msg = errorMessage("Query failed", fmt.Errorf("syntax error"), time.Second)
+	if msg != "Query failed: syntax error" {
+		t.Errorf("Unexpected message for non-timeout error: %q", msg)
+	}
+}
+
+func TestGuardrailsCheckStatement(t *testing.T) {
+	g := defaultGuardrails()
+
+	tests := []struct {
+		name        string
+		query       string
+		shouldError bool
+	}{
+		{"UPDATE with WHERE", "UPDATE users SET status = 'active' WHERE id = 1", false},
+		{"UPDATE without WHERE", "UPDATE users SET status = 'active'", true},
+		{"DELETE without WHERE", "DELETE FROM orders", true},
+		{"DELETE with 1=1", "DELETE FROM orders WHERE 1=1", true},
+		{"DELETE with OR TRUE", "DELETE FROM orders WHERE id = 5 OR TRUE", true},
+		{"INSERT is not checked", "INSERT INTO users (name) VALUES ('x')", false},
+		{"DELETE with a WITH clause and no WHERE", "WITH x AS (SELECT 1) DELETE FROM orders", true},
+		{"UPDATE with a WITH clause and 1=1", "WITH x AS (SELECT 1) UPDATE orders SET paid = 1 WHERE 1=1", true},
+		{"DELETE with a WITH clause and WHERE", "WITH old AS (SELECT id FROM orders WHERE created < '2020-01-01') DELETE FROM orders WHERE id IN (SELECT id FROM old)", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := g.CheckStatement(tt.query)
+			if (err != nil) != tt.shouldError {
+				t.Errorf("CheckStatement(%q) error = %v, shouldError %v", tt.query, err, tt.shouldError)
+			}
+		})
+	}
+
+	g.RequireWhere = false
+	if err := g.CheckStatement("DELETE FROM orders"); err != nil {
+		t.Errorf("CheckStatement should allow DELETE without WHERE when disabled: %v", err)
+	}
+}
+
+func TestGuardrailsRowLimits(t *testing.T) {
+	g := Guardrails{MaxAffectedRows: 5000, LargeOperationRows: 1000}
+
+	if err := g.CheckAffectedRows("DELETE", 5000); err != nil {
+		t.Errorf("Rows at the hard limit should be allowed: %v", err)
+	}
+	if err := g.CheckAffectedRows("DELETE", 5001); err == nil {
+		t.Error("Rows above the hard limit should be rejected")
+	}
+	if g.RequiresOverride(1000) || !g.RequiresOverride(1001) {
+		t.Error("Override should be required only above the soft threshold")
+	}
+}
+
+func TestQueryRejectsDeniedFunctions(t *testing.T) {
+	server := NewMCPServer()
+
+	for query, expected := range map[string]string{
+		"SELECT LOAD_FILE('/etc/passwd')":               "LOAD_FILE() is not allowed",
+		"SELECT * FROM users INTO OUTFILE '/tmp/users'": "INTO OUTFILE is not allowed",
+		"SELECT id FROM users WHERE id = 1 FOR UPDATE":  "FOR UPDATE is not allowed",
+		"SELECT /*!50000 SLEEP(600) */ FROM users":      "SLEEP() is not allowed",
+	} {
+		args, _ := json.Marshal(map[string]interface{}{"query": query})
+		for _, response := range []*Response{server.handleQueryTool(1, args), server.handleExplainTool(1, args)} {
+			if response.Error == nil || !strings.Contains(response.Error.Message, expected) {
+				t.Errorf("%q should be rejected with %q, got %+v", query, expected, response.Error)
+			}
+		}
+	}
+
+	t.Setenv("MYSQL_DENY_FUNCTIONS", "sleep, my_udf")
+	t.Setenv("MYSQL_DENY_CLAUSES", "")
+	g := loadGuardrails()
+	if err := g.CheckRead("SELECT my_udf(1)"); err == nil || !strings.Contains(err.Error(), "MYSQL_DENY_FUNCTIONS") {
+		t.Errorf("Configured functions should be denied, got %v", err)
+	}
+	if err := g.CheckRead("SELECT LOAD_FILE('x') FROM t FOR UPDATE"); err != nil {
+		t.Errorf("The configured lists should replace the defaults: %v", err)
+	}
+}
+
+func TestShadowClient(t *testing.T) {
+	read, write := &mysql.Client{}, &mysql.Client{}
+	server := &MCPServer{readClient: read, writeClient: write}
+
+	if server.shadowClient() != write {
+		t.Error("Shadow tables should use the write account by default")
+	}
+	server.writeAfterConfirm = true
+	if server.shadowClient() != read {
+		t.Error("Shadow tables should use the read account with MYSQL_WRITE_AFTER_CONFIRM")
+	}
+}
+
+func TestExecuteDryRunRejectsUnboundedDelete(t *testing.T) {
+	server := NewMCPServer()
+
+	args, _ := json.Marshal(map[string]interface{}{
+		"sql":     "DELETE FROM orders",
+		"dry_run": true,
+	})
+
+	response := server.handleExecuteTool(1, args)
+	if response.Error == nil {
+		t.Fatal("Dry run of DELETE without WHERE should be rejected")
+	}
+	if !strings.Contains(response.Error.Message, "without a WHERE clause") {
+		t.Errorf("Wrong error message: %v", response.Error.Message)
+	}
+}
+
+func TestExecuteRequiresLargeOperationOverride(t *testing.T) {
+	server := NewMCPServer()
+
+	sql := "UPDATE users SET status = 'active' WHERE created_at < '2024-01-01'"
+	token := server.confirmations.Issue(&ExecuteConfirmation{
+		SQL:          sql,
+		AffectedRows: 5000,
+		Operation:    "UPDATE",
+	})
+
+	args, _ := json.Marshal(map[string]interface{}{
+		"sql":           sql,
+		"dry_run":       false,
+		"confirm_token": token,
+	})
+
+	response := server.handleExecuteTool(1, args)
+	if response.Error == nil {
+		t.Fatal("Execution above the threshold should require allow_large_operation")
+	}
+	if !strings.Contains(response.Error.Message, "allow_large_operation=true") {
+		t.Errorf("Wrong error message: %v", response.Error.Message)
+	}
+}
+
+func TestDiffRows(t *testing.T) {
+	key := []string{"id"}
+	before := []map[string]interface{}{
+		{"id": int64(1), "status": "active", "score": int64(10)},
+		{"id": int64(2), "status": "active", "score": int64(20)},
+	}
+	after := []map[string]interface{}{
+		{"id": int64(1), "status": "inactive", "score": int64(10)},
+		{"id": int64(2), "status": "active", "score": int64(20)},
+	}
+
+	changes := diffRows(key, before, after)
+	if len(changes) != 2 {
+		t.Fatalf("Expected 2 changes, got %d", len(changes))
+	}
+
+	if changes[0]["row"] != "Row id=1" {
+		t.Errorf("Wrong row label: %v", changes[0]["row"])
+	}
+	columns := changes[0]["columns"].(map[string]map[string]interface{})
+	if len(columns) != 1 || columns["status"]["before"] != "active" || columns["status"]["after"] != "inactive" {
+		t.Errorf("Wrong column changes: %v", columns)
+	}
+	if columns := changes[1]["columns"].(map[string]map[string]interface{}); len(columns) != 0 {
+		t.Errorf("Unchanged row should have no column changes: %v", columns)
+	}
+}
+
+func TestSelectAffectedRowsKeepsWithClause(t *testing.T) {
+	dml, err := sqlparse.ParseDML("WITH old AS (SELECT id FROM orders WHERE created < '2020-01-01') DELETE FROM orders WHERE id IN (SELECT id FROM old)")
+	if err != nil {
+		t.Fatalf("ParseDML() error = %v", err)
+	}
+	want := "WITH old AS (SELECT id FROM orders WHERE created < '2020-01-01') SELECT * FROM orders WHERE id IN (SELECT id FROM old) LIMIT 10"
+	if got := selectAffectedRows(dml, "10"); got != want {
+		t.Errorf("selectAffectedRows() = %q, want %q", got, want)
+	}
+}
+
+func TestSelectByKey(t *testing.T) {
+	rows := []map[string]interface{}{
+		{"order_id": int64(1), "line": int64(1)},
+		{"order_id": int64(1), "line": int64(2)},
+	}
+
+	query, args := selectByKey("order_lines", []string{"order_id", "line"}, rows)
+	expected := "SELECT * FROM order_lines WHERE (`order_id`, `line`) IN ((?, ?), (?, ?))"
+	if query != expected {
+		t.Errorf("selectByKey query = %q, want %q", query, expected)
+	}
+	if len(args) != 4 {
+		t.Errorf("Expected 4 args, got %d", len(args))
+	}
+
+	if query, _ := selectByKey("order_lines", []string{"id"}, nil); query != "" {
+		t.Errorf("selectByKey without rows should return no query, got %q", query)
+	}
+}
+
+func TestUndoRequiresBackups(t *testing.T) {
+	server := NewMCPServer()
+
+	args, _ := json.Marshal(map[string]interface{}{"snapshot_id": "20240101-000000-abcdef01"})
+	response := server.handleUndoTool(1, args)
+	if response.Error == nil || !strings.Contains(response.Error.Message, "MYSQL_BACKUP_DIR") {
+		t.Errorf("Undo without backups should explain how to enable them, got %+v", response.Error)
+	}
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	store, err := backup.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+
+	plan := &backupPlan{
+		sql:       "UPDATE `shop`.`orders` SET status = 'void' WHERE customer_id = 7",
+		operation: "UPDATE",
+		table:     "`shop`.`orders`",
+		key:       []string{"id"},
+		generated: []string{"total_cents"},
+		maxRows:   2,
+	}
+	captured := &mysql.ResultSet{
+		Columns: []mysql.Column{{Name: "id"}, {Name: "status"}, {Name: "note"}, {Name: "total_cents"}},
+		Rows: [][]interface{}{
+			{int64(1), "open", nil, int64(100)},
+			{int64(2), "it's paid", "\xff", int64(200)},
+		},
+	}
+	if err := plan.save(store, "app@db:3306/shop", captured); err != nil || plan.saved == nil {
+		t.Fatalf("save() = %v, saved %v", err, plan.saved)
+	}
+
+	loaded, err := store.Load(plan.saved.ID)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded.SQL != plan.sql || loaded.Operation != "UPDATE" || loaded.Connection != "app@db:3306/shop" {
+		t.Errorf("Loaded snapshot = %+v", loaded)
+	}
+	expected := "INSERT INTO `shop`.`orders` (`id`, `note`, `status`) VALUES (1, NULL, 'open'), (2, X'ff', 'it''s paid') " +
+		"ON DUPLICATE KEY UPDATE `note` = VALUES(`note`), `status` = VALUES(`status`)"
+	if sql := loaded.RestoreSQL(); sql != expected {
+		t.Errorf("RestoreSQL() =\n%s\nwant\n%s", sql, expected)
+	}
+
+	// More rows than the snapshot may hold roll the statement back
+	plan.maxRows = 1
+	if err := plan.save(store, "app@db:3306/shop", captured); err == nil || !strings.Contains(err.Error(), "MYSQL_BACKUP_MAX_ROWS") {
+		t.Errorf("save() of too many rows = %v, want an error", err)
+	}
+}
+
+func TestRowCheck(t *testing.T) {
+	check := &rowCheck{expected: 100, tolerance: 2}
+
+	if err := check.check(102); err != nil {
+		t.Errorf("Difference within the tolerance should pass: %v", err)
+	}
+	err := check.check(97)
+	var mismatch *rowMismatchError
+	if !errors.As(err, &mismatch) || mismatch.actual != 97 {
+		t.Errorf("Difference above the tolerance should fail with a mismatch, got %v", err)
+	}
+}
+
+func TestParseRowCheck(t *testing.T) {
+	server := NewMCPServer()
+
+	args, _ := json.Marshal(map[string]interface{}{"row_tolerance": 5})
+	check, err := server.parseRowCheck(args, "DELETE FROM orders WHERE id < 10", 9)
+	if err != nil || check == nil || check.expected != 9 || check.tolerance != 5 {
+		t.Errorf("parseRowCheck = %+v, %v", check, err)
+	}
+
+	if _, err := server.parseRowCheck(args, "DROP TABLE orders", -1); err == nil {
+		t.Error("row_tolerance should be rejected for statements that cannot be rolled back")
+	}
+
+	if check, err := server.parseRowCheck(json.RawMessage(`{}`), "DELETE FROM orders WHERE id < 10", 9); check == nil || err != nil || check.tolerance != 0 {
+		t.Errorf("Row counts should be verified by default, got %+v, %v", check, err)
+	}
+
+	if check, err := server.parseRowCheck(json.RawMessage(`{}`), "TRUNCATE TABLE orders", -1); check != nil || err != nil {
+		t.Errorf("DDL row counts should not be verified, got %+v, %v", check, err)
+	}
+	if check, _ := server.parseRowCheck(json.RawMessage(`{"verify_rows": false}`), "DELETE FROM orders WHERE id = 1", 1); check == nil {
+		t.Error("The caller should not be able to turn off row count verification")
+	}
+}
+
+func TestParseStatements(t *testing.T) {
+	statements, err := parseStatements(json.RawMessage(`{"statements": ["INSERT INTO log VALUES (1)", "DELETE FROM items WHERE order_id = 1"]}`))
+	if err != nil || len(statements) != 2 {
+		t.Fatalf("parseStatements = %v, %v", statements, err)
+	}
+
+	for _, args := range []string{
+		`{"statements": []}`,
+		`{"statements": "DELETE FROM items WHERE id = 1"}`,
+		`{"statements": ["DELETE FROM items WHERE id = 1", 5]}`,
+		`{"statements": ["DELETE FROM items WHERE id = 1", "  "]}`,
+	} {
+		if _, err := parseStatements(json.RawMessage(args)); err == nil {
+			t.Errorf("parseStatements(%s) should fail", args)
+		}
+	}
+}
+
+func TestExecuteBatchChecks(t *testing.T) {
+	server := NewMCPServer()
+
+	tests := []struct {
+		statements []string
+		message    string
+	}{
+		{[]string{"UPDATE orders SET paid = 1 WHERE id = 1", "SELECT * FROM orders"}, "statement 2 is a SELECT query"},
+		{[]string{"ALTER TABLE orders ADD note TEXT", "UPDATE orders SET note = '' WHERE id = 1"}, "statement 1 (ALTER) cannot run in a transaction"},
+		{[]string{"INSERT INTO log VALUES (1)", "DELETE FROM orders"}, "statement 2: DELETE without a WHERE clause"},
+		{[]string{"INSERT INTO log VALUES (1)", "WITH x AS (SELECT 1) DELETE FROM orders"}, "statement 2: DELETE without a WHERE clause"},
+	}
+
+	for _, tt := range tests {
+		args, _ := json.Marshal(map[string]interface{}{"statements": tt.statements, "dry_run": true})
+		response := server.handleExecuteTool(1, args)
+		if response.Error == nil || !strings.Contains(response.Error.Message, tt.message) {
+			t.Errorf("Expected error containing %q, got %+v", tt.message, response.Error)
+		}
+	}
+}
+
+func TestExecuteBatchTokenBoundToStatements(t *testing.T) {
+	server := NewMCPServer()
+
+	token := server.confirmations.Issue(&ExecuteConfirmation{
+		SQL:          batchKey([]string{"UPDATE a SET x = 1 WHERE id = 1", "UPDATE b SET y = 2 WHERE id = 2"}),
+		AffectedRows: 2,
+		Operation:    "BATCH",
+	})
+
+	// A token does not cover statements added after the dry run
+	args, _ := json.Marshal(map[string]interface{}{
+		"statements":    []string{"UPDATE a SET x = 1 WHERE id = 1", "UPDATE b SET y = 2 WHERE id = 2", "DELETE FROM c WHERE id = 3"},
+		"dry_run":       false,
+		"confirm_token": token,
+	})
+	response := server.handleExecuteTool(1, args)
+	if response.Error == nil || response.Error.Message != errTokenSQLMismatch.Error() {
+		t.Errorf("Expected SQL mismatch error, got %+v", response.Error)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	before := splitLines("CREATE TABLE `t` (\n  `id` int NOT NULL,\n  `name` varchar(50) DEFAULT NULL,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB")
+	after := splitLines("CREATE TABLE `t` (\n  `id` int NOT NULL,\n  `name` varchar(100) DEFAULT NULL,\n  `note` text,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB")
+
+	diff := diffLines(before, after)
+	expected := []string{"- `name` varchar(50) DEFAULT NULL", "+ `name` varchar(100) DEFAULT NULL", "+ `note` text"}
+	if strings.Join(diff, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("diffLines =\n%s\nwant\n%s", strings.Join(diff, "\n"), strings.Join(expected, "\n"))
+	}
+
+	if diff := diffLines(before, before); len(diff) != 0 {
+		t.Errorf("Identical definitions should have no diff, got %v", diff)
+	}
+}
+
+func TestOnlineReportRender(t *testing.T) {
+	report := &OnlineReport{
+		Probes: map[string]string{
+			"ALGORITHM=INSTANT":            "ALGORITHM=INSTANT is not supported for this operation",
+			"ALGORITHM=INPLACE, LOCK=NONE": "LOCK=NONE is not supported",
+			"ALGORITHM=INPLACE":            "ALGORITHM=INPLACE is not supported",
+			"ALGORITHM=COPY":               "",
+		},
+		Algorithm: "COPY",
+		Size:      &mysql.TableSize{Engine: "InnoDB", Rows: 1000000, DataLength: 3 << 30, IndexLength: 1 << 30},
+	}
+
+	if !report.BlocksWrites() {
+		t.Error("A COPY alter should block writes")
+	}
+
+	text, data := report.Render()
+	for _, expected := range []string{"🚨 COPY", "3.0 GB of data", "Estimated rebuild time: about 1m22s"} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("Render() should contain %q:\n%s", expected, text)
+		}
+	}
+	if data["estimated_rebuild_seconds"] != int64(81) {
+		t.Errorf("Wrong rebuild estimate: %v", data["estimated_rebuild_seconds"])
+	}
+
+	instant := &OnlineReport{Probes: map[string]string{"ALGORITHM=INSTANT": ""}, Algorithm: "INSTANT", LockNone: true,
+		RowVersions: 3, RowVersionLimit: 64}
+	if instant.BlocksWrites() {
+		t.Error("An INSTANT alter should not block writes")
+	}
+	if text, data := instant.Render(); !strings.Contains(text, "used 3 of 64 row versions") || data["row_versions"] != int64(3) {
+		t.Errorf("Render() should report the row versions used:\n%s", text)
+	}
+}
+
+func TestCostGuardCheck(t *testing.T) {
+	guard := CostGuard{Mode: costGuardBlock, MaxScanRows: 1000, MaxExaminedRows: 100000}
+
+	fullScan := `{"query_block": {"select_id": 1, "table": {"table_name": "orders", "access_type": "ALL",
+		"rows_examined_per_scan": 50000, "rows_produced_per_join": 5000, "attached_condition": "(status = 'open')"}}}`
+	findings := guard.Check(fullScan)
+	if len(findings) != 1 || !strings.Contains(findings[0], "full table scan of orders (about 50000 rows)") {
+		t.Errorf("Expected a full scan finding, got %v", findings)
+	}
+
+	cartesian := `{"query_block": {"select_id": 1, "nested_loop": [
+		{"table": {"table_name": "a", "access_type": "ALL", "rows_examined_per_scan": 500, "rows_produced_per_join": 500}},
+		{"table": {"table_name": "b", "access_type": "ALL", "rows_examined_per_scan": 800, "rows_produced_per_join": 400000,
+			"using_join_buffer": "Block Nested Loop"}}]}}`
+	findings = guard.Check(cartesian)
+	if len(findings) != 2 {
+		t.Fatalf("Expected examined rows and cartesian findings, got %v", findings)
+	}
+	if !strings.Contains(findings[0], "examines about 400500 rows") {
+		t.Errorf("Wrong examined rows finding: %s", findings[0])
+	}
+	if !strings.Contains(findings[1], "cartesian join: b") {
+		t.Errorf("Wrong cartesian finding: %s", findings[1])
+	}
+
+	indexed := `{"query_block": {"select_id": 1, "table": {"table_name": "orders", "access_type": "ref",
+		"rows_examined_per_scan": 20, "rows_produced_per_join": 20}}}`
+	if findings := guard.Check(indexed); len(findings) != 0 {
+		t.Errorf("An indexed lookup should pass, got %v", findings)
+	}
+}
+
+func TestLoadCostGuard(t *testing.T) {
+	t.Setenv("MYSQL_COST_GUARD", "")
+	if guard := loadCostGuard(); guard.Enabled() || guard.MaxScanRows != 100000 {
+		t.Errorf("Unexpected defaults: %+v", guard)
+	}
+
+	t.Setenv("MYSQL_COST_GUARD", "WARN")
+	t.Setenv("MYSQL_COST_GUARD_SCAN_ROWS", "500")
+	if guard := loadCostGuard(); guard.Mode != costGuardWarn || guard.MaxScanRows != 500 {
+		t.Errorf("Settings not applied: %+v", guard)
+	}
+}
+
+func TestPolicyEvaluate(t *testing.T) {
+	policy, err := parsePolicy([]byte(`{
+		"timezone": "UTC",
+		"rules": [
+			{"name": "no prod drops", "operations": ["DROP", "TRUNCATE"], "connections": ["*@prod-*"], "outcome": "deny", "message": "Ask a DBA"},
+			{"name": "night freeze", "hours": "22:00-06:00", "outcome": "deny"},
+			{"name": "large deletes", "operations": ["delete"], "min_rows": 1000, "outcome": "confirm_twice"},
+			{"name": "scratch tables", "tables": ["scratch.*"], "outcome": "allow"}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("parsePolicy failed: %v", err)
+	}
+
+	day := time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		stmt PolicyStatement
+		rule string
+		want string
+	}{
+		{PolicyStatement{Operation: "DROP", Table: "orders", Connection: "app@prod-db:3306/shop", Time: day}, "no prod drops", policyDeny},
+		{PolicyStatement{Operation: "DROP", Table: "orders", Connection: "app@staging:3306/shop", Time: day}, "", policyConfirm},
+		{PolicyStatement{Operation: "UPDATE", Table: "orders", AffectedRows: 1, Time: day.Add(11 * time.Hour)}, "night freeze", policyDeny},
+		{PolicyStatement{Operation: "DELETE", Table: "orders", AffectedRows: 5000, Time: day}, "large deletes", policyConfirmTwice},
+		{PolicyStatement{Operation: "DELETE", Table: "orders", AffectedRows: 10, Time: day}, "", policyConfirm},
+		{PolicyStatement{Operation: "DELETE", Table: "scratch.tmp", AffectedRows: 10, Time: day}, "scratch tables", policyAllow},
+		// Unknown row counts and tables match stricter rules, but never allow rules
+		{PolicyStatement{Operation: "DELETE", AffectedRows: -1, Time: day}, "large deletes", policyConfirmTwice},
+		{PolicyStatement{Operation: "UPDATE", AffectedRows: 10, Time: day}, "", policyConfirm},
+	}
+	for _, tt := range tests {
+		decision := policy.Evaluate(tt.stmt)
+		if decision.Outcome != tt.want || decision.Rule != tt.rule {
+			t.Errorf("Evaluate(%+v) = %+v, want %s from %q", tt.stmt, decision, tt.want, tt.rule)
+		}
+	}
+
+	for _, invalid := range []string{
+		`{"rules": [{"outcome": "maybe"}]}`,
+		`{"rules": [{"outcome": "deny", "hours": "late"}]}`,
+		`{"rules": [{"outcome": "deny", "days": ["someday"]}]}`,
+		`{"rules": [{"outcome": "deny", "table": "orders"}]}`,
+	} {
+		if _, err := parsePolicy([]byte(invalid)); err == nil {
+			t.Errorf("parsePolicy(%s) should fail", invalid)
+		}
+	}
+}
+
+func TestStatementTable(t *testing.T) {
+	tests := map[string]string{
+		"UPDATE `shop`.`orders` SET status = 'x' WHERE id = 1": "shop.orders",
+		"DELETE FROM orders WHERE id = 1":                      "orders",
+		"WITH x AS (SELECT 1) DELETE FROM orders WHERE id = 1": "orders",
+		"INSERT INTO shop.orders (id) VALUES (1)":              "shop.orders",
+		"ALTER TABLE `orders` ADD COLUMN note TEXT":            "orders",
+		"DROP TABLE IF EXISTS shop.old_orders":                 "shop.old_orders",
+	}
+	for sql, want := range tests {
+		if got := statementTable(sql); got != want {
+			t.Errorf("statementTable(%q) = %q, want %q", sql, got, want)
+		}
+	}
+}
+
+func TestPolicyAtExecute(t *testing.T) {
+	confirmed := PolicyDecision{Outcome: policyConfirm}
+	if err := checkPolicyAtExecute(confirmed, PolicyDecision{Outcome: policyAllow}); err != nil {
+		t.Errorf("A less restrictive policy should pass: %v", err)
+	}
+	if err := checkPolicyAtExecute(confirmed, PolicyDecision{Outcome: policyConfirmTwice}); err == nil {
+		t.Error("A stricter policy should require a new dry run")
+	}
+	if err := checkPolicyAtExecute(confirmed, PolicyDecision{Outcome: policyDeny, Message: "Change freeze"}); err == nil ||
+		!strings.Contains(err.Error(), "Change freeze") {
+		t.Errorf("A denied statement should fail with the policy message, got %v", err)
+	}
+
+	s := NewMCPServer()
+	confirmation := &ExecuteConfirmation{SQL: "DELETE FROM orders WHERE id = 1", AffectedRows: 1, Operation: "DELETE",
+		Connection: "app@db:3306/shop", Policy: PolicyDecision{Outcome: policyConfirmTwice}}
+	resp := s.secondConfirmation(1, "execute", confirmation, "this DELETE operation")
+	token := resp.Result.(map[string]interface{})["confirm_token"].(string)
+	second, err := s.confirmations.Validate(token, confirmation.SQL, confirmation.Connection)
+	if err != nil || !second.SecondConfirmation {
+		t.Errorf("The second token should be valid and marked as the second confirmation: %v", err)
+	}
+}
+
+func TestFormatResultsKeepsColumnOrder(t *testing.T) {
+	server := &MCPServer{}
+	results := &mysql.ResultSet{
+		Columns: []mysql.Column{{Name: "id", DatabaseType: "INT"}, {Name: "id", DatabaseType: "INT"}, {Name: "total", DatabaseType: "DECIMAL"}},
+		Rows:    [][]interface{}{{int64(1), int64(2), json.Number("9.50")}},
+	}
+
+	if csv := server.formatResults(results, "csv"); csv != "id,id,total\n1,2,9.50\n" {
+		t.Errorf("csv = %q", csv)
+	}
+
+	var decoded struct {
+		Columns []map[string]interface{} `json:"columns"`
+		Rows    [][]interface{}          `json:"rows"`
+	}
+	if err := json.Unmarshal([]byte(server.formatResults(results, "json")), &decoded); err != nil {
+		t.Fatalf("json output does not decode: %v", err)
+	}
+	if len(decoded.Columns) != 3 || decoded.Columns[2]["type"] != "DECIMAL" {
+		t.Errorf("columns = %v", decoded.Columns)
+	}
+	if len(decoded.Rows) != 1 || decoded.Rows[0][1] != float64(2) || decoded.Rows[0][2] != 9.5 {
+		t.Errorf("rows = %v, want numbers to stay numbers", decoded.Rows)
+	}
+}
+
+func TestLimitResults(t *testing.T) {
+	results := &mysql.ResultSet{
+		Columns: []mysql.Column{{Name: "id"}},
+		Rows:    [][]interface{}{{int64(1)}, {int64(2)}, {int64(3)}},
+	}
+
+	if limited, truncated := limitResults(results, 2); limited.Len() != 2 || !truncated {
+		t.Errorf("limitResults(3 rows, 2) = %d rows, truncated %v", limited.Len(), truncated)
+	}
+	if limited, truncated := limitResults(results, 3); limited.Len() != 3 || truncated {
+		t.Errorf("limitResults(3 rows, 3) = %d rows, truncated %v", limited.Len(), truncated)
+	}
+	if limited, truncated := limitResults(results, 0); limited.Len() != 3 || truncated {
+		t.Errorf("limitResults without a limit = %d rows, truncated %v", limited.Len(), truncated)
+	}
+}
+
+func TestStreamQueryTruncates(t *testing.T) {
+	rows := [][]sqldriver.Value{{int64(1)}, {int64(2)}, {int64(3)}, {int64(4)}}
+	tests := []struct {
+		name      string
+		maxRows   int
+		wantRows  int
+		truncated bool
+	}{
+		{name: "over the limit", maxRows: 2, wantRows: 2, truncated: true},
+		{name: "at the limit", maxRows: 4, wantRows: 4},
+		{name: "no limit", maxRows: 0, wantRows: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewMCPServer()
+			server.readClient = fakeClient(t, fakeQuery{match: "SELECT id FROM orders", columns: []string{"id"}, rows: rows})
+
+			output, err := server.streamQuery(context.Background(), "SELECT id FROM orders", nil, "csv", tt.maxRows)
+			if err != nil {
+				t.Fatalf("streamQuery() error = %v", err)
+			}
+			if output.Rows != tt.wantRows || output.Truncated != tt.truncated {
+				t.Errorf("streamQuery() = %d rows, truncated %v, want %d rows, truncated %v",
+					output.Rows, output.Truncated, tt.wantRows, tt.truncated)
+			}
+			if lines := strings.Split(strings.TrimSpace(output.Text), "\n"); len(lines) != tt.wantRows+1 {
+				t.Errorf("CSV output should hold the header and %d rows, got:\n%s", tt.wantRows, output.Text)
+			}
+		})
+	}
+}
+
+func TestParseParams(t *testing.T) {
+	params, err := parseParams(json.RawMessage(`{"params": ["a", 1, 18446744073709551615, 2.50, true, null, "2024-05-01T12:00:00+02:00",
+		{"type": "datetime", "value": "2024-05-01T12:00:00+02:00"}, "2024-05-01"]}`))
+	if err != nil {
+		t.Fatalf("parseParams() error = %v", err)
+	}
+	expected := []interface{}{"a", int64(1), uint64(18446744073709551615), json.Number("2.50"), true, nil,
+		"2024-05-01T12:00:00+02:00", time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), "2024-05-01"}
+	if len(params) != len(expected) {
+		t.Fatalf("parseParams() = %v, want %v", params, expected)
+	}
+	for i := range expected {
+		if params[i] != expected[i] {
+			t.Errorf("param %d = %#v, want %#v", i+1, params[i], expected[i])
+		}
+	}
+
+	for _, args := range []string{`{"params": "a"}`, `{"params": [[1]]}`, `{"params": [{"a": 1}]}`,
+		`{"params": [{"type": "date", "value": "2024-05-01"}]}`, `{"params": [{"type": "datetime", "value": "2024-05-01"}]}`} {
+		if _, err := parseParams(json.RawMessage(args)); err == nil {
+			t.Errorf("parseParams(%s) should fail", args)
+		}
+	}
+}
+
+func TestStatementKeyIncludesParams(t *testing.T) {
+	sql := "DELETE FROM users WHERE id = ?"
+	if statementKey("SELECT 1", nil) != "SELECT 1" {
+		t.Error("A statement without params should be its own key")
+	}
+	if statementKey(sql, []interface{}{int64(1)}) == statementKey(sql, []interface{}{int64(2)}) {
+		t.Error("Different params must give different keys")
+	}
+
+	store := NewConfirmationStore([]byte("secret"), time.Minute)
+	token := store.Issue(&ExecuteConfirmation{SQL: statementKey(sql, []interface{}{int64(1)}), AffectedRows: 1})
+	if _, err := store.Validate(token, statementKey(sql, []interface{}{int64(2)}), ""); err == nil {
+		t.Error("A token must not validate with other params")
+	}
+	if _, err := store.Validate(token, statementKey(sql, []interface{}{int64(1)}), ""); err != nil {
+		t.Errorf("Validate() with the same params error = %v", err)
+	}
+}
+
+func TestWarningsMessage(t *testing.T) {
+	if message := warningsMessage(nil); message != nil {
+		t.Errorf("warningsMessage(nil) = %v, want nil", message)
+	}
+	if message := unreadWarningsMessage(nil); message != nil {
+		t.Errorf("unreadWarningsMessage(nil) = %v, want nil", message)
+	}
+	if text, _ := unreadWarningsMessage(errors.New("connection reset"))["text"].(string); !strings.Contains(text, "applied") {
+		t.Errorf("unreadWarningsMessage() = %q, want it to say the statement was applied", text)
+	}
+
+	message := warningsMessage([]mysql.Warning{
+		{Level: "Warning", Code: 1265, Message: "Data truncated for column 'name' at row 1"},
+		{Level: "Note", Code: 1292, Message: "Truncated incorrect DOUBLE value: 'abc'"},
+	})
+	text, _ := message["text"].(string)
+	for _, want := range []string{"2 warnings", "- Warning 1265: Data truncated for column 'name' at row 1", "- Note 1292:"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("warningsMessage() = %q, want it to contain %q", text, want)
+		}
+	}
+}
+
+type insertResult struct{ lastInsertID, rowsAffected int64 }
+
+func (r insertResult) LastInsertId() (int64, error) { return r.lastInsertID, nil }
+func (r insertResult) RowsAffected() (int64, error) { return r.rowsAffected, nil }
+
+func TestReportInsert(t *testing.T) {
+	serial := autoIncrement{Column: "id", Increment: 1}
+	tests := []struct {
+		name   string
+		sql    string
+		result insertResult
+		ids    autoIncrement
+		want   map[string]interface{}
+		text   string
+	}{
+		{name: "single row", sql: "INSERT INTO users (name) VALUES ('a')", result: insertResult{42, 1},
+			want: map[string]interface{}{"last_insert_id": int64(42)}, text: "Last insert id: 42"},
+		{name: "multiple rows", sql: "INSERT INTO users (name) VALUES ('a'), ('b'), ('c')", result: insertResult{10, 3}, ids: serial,
+			want: map[string]interface{}{"generated_ids": map[string]interface{}{"first": int64(10), "last": int64(12), "step": int64(1)}},
+			text: "Generated ids: 10 to 12 (3 rows)"},
+		{name: "auto_increment_increment", sql: "INSERT INTO users (name) VALUES ('a'), ('b'), ('c')", result: insertResult{11, 3},
+			ids:  autoIncrement{Column: "id", Increment: 10},
+			want: map[string]interface{}{"generated_ids": map[string]interface{}{"first": int64(11), "last": int64(31), "step": int64(10)}},
+			text: "Generated ids: 11 to 31 (3 rows), 10 apart"},
+		{name: "explicit ids", sql: "INSERT INTO users (ID, name) VALUES (NULL, 'a'), (100, 'b')", result: insertResult{5, 2}, ids: serial,
+			want: map[string]interface{}{"last_insert_id": int64(5), "generated_ids": nil}, text: "the first id generated"},
+		{name: "no column list", sql: "INSERT INTO users VALUES (NULL, 'a'), (NULL, 'b')", result: insertResult{5, 2}, ids: serial,
+			want: map[string]interface{}{"last_insert_id": int64(5), "generated_ids": nil}, text: "the first id generated"},
+		{name: "unknown column", sql: "INSERT INTO users (name) VALUES ('a'), ('b')", result: insertResult{5, 2},
+			want: map[string]interface{}{"last_insert_id": int64(5), "generated_ids": nil}, text: "the first id generated"},
+		{name: "ignored rows", sql: "INSERT IGNORE INTO users (name) VALUES ('a'), ('b')", result: insertResult{7, 1},
+			want: map[string]interface{}{"last_insert_id": int64(7)}, text: "the first id generated"},
+		{name: "upsert updated", sql: "INSERT INTO users (id, name) VALUES (1, 'a') ON DUPLICATE KEY UPDATE name = 'a'", result: insertResult{1, 2},
+			want: map[string]interface{}{"inserted_rows": int64(0), "updated_rows": int64(1)}, text: "0 inserted, 1 updated"},
+		{name: "upsert unchanged", sql: "INSERT INTO users (id, name) VALUES (1, 'a') ON DUPLICATE KEY UPDATE name = 'a'", result: insertResult{0, 0},
+			want: map[string]interface{}{"unchanged_rows": int64(1)}, text: "1 unchanged"},
+		{name: "upsert multiple rows", sql: "INSERT INTO users (id) VALUES (1), (2), (3) ON DUPLICATE KEY UPDATE id = id + 10", result: insertResult{3, 4},
+			want: map[string]interface{}{"inserted_rows": int64(2), "updated_rows": int64(1)}, text: "assuming no duplicate row"},
+		{name: "upsert ambiguous", sql: "INSERT INTO users (id) VALUES (1), (2), (3) ON DUPLICATE KEY UPDATE id = id", result: insertResult{0, 1},
+			text: "cannot be split exactly"},
+		{name: "update", sql: "UPDATE users SET name = 'a'", result: insertResult{0, 5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := map[string]interface{}{}
+			reportInsert(tt.sql, tt.result, tt.result.rowsAffected, tt.ids, result)
+			for key, want := range tt.want {
+				if got := fmt.Sprint(result[key]); got != fmt.Sprint(want) {
+					t.Errorf("result[%q] = %s, want %s", key, got, fmt.Sprint(want))
+				}
+			}
+
+			content, _ := result["content"].([]map[string]interface{})
+			var texts []string
+			for _, message := range content {
+				texts = append(texts, message["text"].(string))
+			}
+			if text := strings.Join(texts, "\n"); tt.text == "" && text != "" || !strings.Contains(text, tt.text) {
+				t.Errorf("reportInsert() content = %q, want it to contain %q", text, tt.text)
+			}
+		})
+	}
+}
+
+func TestSessionStatementWithoutSession(t *testing.T) {
+	server := NewMCPServer()
+	response := server.handleQueryTool(1, json.RawMessage(`{"query": "CREATE TEMPORARY TABLE recent AS SELECT * FROM orders"}`))
+	if response.Error == nil || !strings.Contains(response.Error.Message, "session_open") {
+		t.Errorf("handleQueryTool() = %+v, want an error pointing to session_open", response)
+	}
+
+	response = server.handleSessionCloseTool(2)
+	if response.Error == nil || response.Error.Code != -32602 {
+		t.Errorf("handleSessionCloseTool() without a session = %+v, want an invalid params error", response)
+	}
+}
+
+func TestTokenConnectionInSession(t *testing.T) {
+	server := NewMCPServer()
+	server.connection = "app@db:3306/shop"
+	sql := "DELETE FROM orders WHERE id = 1"
+	token := server.confirmations.Issue(&ExecuteConfirmation{SQL: sql, AffectedRows: 1, Connection: server.tokenConnection()})
+
+	// The same statement in another database is another change
+	server.session = &session{database: "archive"}
+	if _, err := server.confirmations.Validate(token, sql, server.tokenConnection()); err == nil {
+		t.Error("Token should not validate after USE of another database")
+	}
+
+	server.session = &session{}
+	if _, err := server.confirmations.Validate(token, sql, server.tokenConnection()); err != nil {
+		t.Errorf("Token should validate in a session on the same database: %v", err)
+	}
+}
+
+func TestSessionNotice(t *testing.T) {
+	server := NewMCPServer()
+	server.sessionNotice = "📌 The session on connection 7 was closed because it was idle for 10m0s."
+
+	result := map[string]interface{}{"content": []map[string]interface{}{{"type": "text", "text": "Query executed"}}}
+	server.afterToolCall(&Response{Result: result})
+	content := result["content"].([]map[string]interface{})
+	if len(content) != 2 || !strings.Contains(content[1]["text"].(string), "idle for 10m0s") {
+		t.Errorf("afterToolCall() content = %v, want the notice appended", content)
+	}
+
+	// The notice is only given once
+	response := &Response{Error: &Error{Code: -32603, Message: "Query failed"}}
+	server.afterToolCall(response)
+	if response.Error.Message != "Query failed" {
+		t.Errorf("afterToolCall() error = %q, want it unchanged", response.Error.Message)
+	}
+
+	server.sessionNotice = "📌 The session was closed."
+	server.afterToolCall(response)
+	if !strings.HasSuffix(response.Error.Message, "📌 The session was closed.") {
+		t.Errorf("afterToolCall() error = %q, want the notice appended", response.Error.Message)
+	}
+}
+
+// fakeQuery is a canned answer of fakeDB to the queries containing match and,
+// if args is set, bound to these arguments. more holds any further result
+// sets. Statements report affected rows and call exec, if set, when they run.
+type fakeQuery struct {
+	match    string
+	args     []sqldriver.Value
+	columns  []string
+	rows     [][]sqldriver.Value
+	more     []fakeQuery
+	err      error
+	affected int64
+	exec     func()
+}
+
+func (q fakeQuery) matches(query string, args []sqldriver.NamedValue) bool {
+	if !strings.Contains(query, q.match) {
+		return false
+	}
+	if q.args == nil {
+		return true
+	}
+	if len(args) != len(q.args) {
+		return false
+	}
+	for i, arg := range args {
+		if arg.Value != q.args[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// fakeDB is a database/sql connector answering queries with the first
+// fakeQuery that matches, for handler tests that need a database. Statements
+// never have warnings.
+type fakeDB []fakeQuery
+
+func (f fakeDB) Connect(context.Context) (sqldriver.Conn, error) { return fakeConn{f}, nil }
+func (f fakeDB) Driver() sqldriver.Driver                        { return f }
+func (f fakeDB) Open(string) (sqldriver.Conn, error)             { return fakeConn{f}, nil }
+
+// fakeClient returns a client whose queries fakeDB answers.
+func fakeClient(t *testing.T, queries ...fakeQuery) *mysql.Client {
+	db := sql.OpenDB(fakeDB(queries))
+	t.Cleanup(func() { db.Close() })
+	return mysql.NewClientFromDB(db, &mysql.Config{})
+}
+
+type fakeConn struct{ queries fakeDB }
+
+func (c fakeConn) Prepare(string) (sqldriver.Stmt, error) {
+	return nil, errors.New("fakeConn does not prepare statements")
+}
+func (c fakeConn) Close() error                 { return nil }
+func (c fakeConn) Begin() (sqldriver.Tx, error) { return fakeTx{}, nil }
+func (c fakeConn) QueryContext(_ context.Context, query string, args []sqldriver.NamedValue) (sqldriver.Rows, error) {
+	for _, q := range c.queries {
+		if q.matches(query, args) {
+			if q.err != nil {
+				return nil, q.err
+			}
+			return &fakeRows{columns: q.columns, rows: q.rows, more: q.more}, nil
+		}
+	}
+	if query == "SHOW COUNT(*) WARNINGS" {
+		return &fakeRows{columns: []string{"@@session.warning_count"}, rows: [][]sqldriver.Value{{int64(0)}}}, nil
+	}
+	return nil, fmt.Errorf("unexpected query %q", query)
+}
+func (c fakeConn) ExecContext(_ context.Context, query string, args []sqldriver.NamedValue) (sqldriver.Result, error) {
+	for _, q := range c.queries {
+		if q.matches(query, args) {
+			if q.exec != nil {
+				q.exec()
+			}
+			if q.err != nil {
+				return nil, q.err
+			}
+			return sqldriver.RowsAffected(q.affected), nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected statement %q", query)
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct {
+	columns []string
+	rows    [][]sqldriver.Value
+	more    []fakeQuery
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []sqldriver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+func (r *fakeRows) HasNextResultSet() bool { return len(r.more) > 0 }
+func (r *fakeRows) NextResultSet() error {
+	if len(r.more) == 0 {
+		return io.EOF
+	}
+	r.columns, r.rows, r.more = r.more[0].columns, r.more[0].rows, r.more[1:]
+	return nil
+}
+
+func TestHandleRoutinesTool(t *testing.T) {
+	queries := []fakeQuery{
+		{match: "ROUTINE_TYPE = 'PROCEDURE'", columns: []string{"name", "security"},
+			rows: [][]sqldriver.Value{{"close_month", "DEFINER"}, {"archive_orders", "INVOKER"}}},
+		{match: "ROUTINE_TYPE = 'FUNCTION'", columns: []string{"name", "returns"}},
+		{match: "information_schema.TRIGGERS", columns: []string{"name", "table", "timing"},
+			rows: [][]sqldriver.Value{{"orders_audit", "orders", "AFTER"}}},
+		{match: "information_schema.EVENTS", columns: []string{"name", "status"},
+			rows: [][]sqldriver.Value{{"purge_sessions", "ENABLED"}}},
+	}
+
+	tests := []struct {
+		name    string
+		args    string
+		queries []fakeQuery
+		keys    []string
+		texts   []string
+		code    int
+	}{
+		{name: "all types", args: `{}`, queries: queries,
+			keys:  []string{"procedures", "functions", "triggers", "events"},
+			texts: []string{"Stored procedures (2)", "archive_orders", "Stored functions (0)", "Triggers (1)", "orders_audit", "Events (1)", "purge_sessions"}},
+		{name: "triggers only", args: `{"type": "TRIGGER", "schema": "shop"}`, queries: queries,
+			keys: []string{"triggers"}, texts: []string{"Triggers (1)", "orders_audit"}},
+		{name: "events only", args: `{"type": "event"}`, queries: queries,
+			keys: []string{"events"}, texts: []string{"Events (1)", "purge_sessions"}},
+		{name: "unknown type", args: `{"type": "view"}`, queries: queries, code: -32602},
+		{name: "listing fails", args: `{"type": "trigger"}`, code: -32603,
+			queries: []fakeQuery{{match: "information_schema.TRIGGERS", err: &driver.MySQLError{Number: 1142, Message: "SELECT command denied"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewMCPServer()
+			server.readClient = fakeClient(t, tt.queries...)
+			response := server.handleRoutinesTool(1, json.RawMessage(tt.args))
+
+			if tt.code != 0 {
+				if response.Error == nil || response.Error.Code != tt.code {
+					t.Fatalf("handleRoutinesTool() = %+v, want error code %d", response, tt.code)
+				}
+				return
+			}
+			if response.Error != nil {
+				t.Fatalf("handleRoutinesTool() error = %s", response.Error.Message)
+			}
+
+			result := response.Result.(map[string]interface{})
+			for _, objectType := range objectTypes {
+				key := objectType.arg + "s"
+				_, listed := result[key]
+				want := false
+				for _, k := range tt.keys {
+					want = want || k == key
+				}
+				if listed != want {
+					t.Errorf("result[%q] present = %v, want %v", key, listed, want)
+				}
+			}
+			text := contentText(result)
+			for _, want := range tt.texts {
+				if !strings.Contains(text, want) {
+					t.Errorf("handleRoutinesTool() content = %q, want it to contain %q", text, want)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleDefinitionTool(t *testing.T) {
+	procedure := "CREATE DEFINER=`app`@`%` PROCEDURE `close_month`(IN m CHAR(7))\nBEGIN\n  UPDATE invoices SET closed = 1 WHERE month = m;\nEND"
+	trigger := "CREATE DEFINER=`app`@`%` TRIGGER orders_audit AFTER UPDATE ON orders FOR EACH ROW INSERT INTO audit VALUES (NEW.id)"
+
+	tests := []struct {
+		name       string
+		args       string
+		queries    []fakeQuery
+		definition string
+		code       int
+		message    string
+	}{
+		{name: "procedure", args: `{"type": "procedure", "name": "shop.close_month"}`, definition: procedure,
+			queries: []fakeQuery{{match: "SHOW CREATE PROCEDURE `shop`.`close_month`", columns: []string{"Procedure", "sql_mode", "Create Procedure"},
+				rows: [][]sqldriver.Value{{"close_month", "STRICT_TRANS_TABLES", procedure}}}}},
+		{name: "trigger", args: `{"type": "trigger", "name": "orders_audit"}`, definition: trigger,
+			queries: []fakeQuery{{match: "SHOW CREATE TRIGGER `orders_audit`", columns: []string{"Trigger", "sql_mode", "SQL Original Statement"},
+				rows: [][]sqldriver.Value{{"orders_audit", "", trigger}}}}},
+		{name: "missing routine", args: `{"type": "function", "name": "nope"}`, code: -32603, message: "does not exist",
+			queries: []fakeQuery{{match: "SHOW CREATE FUNCTION `nope`", err: &driver.MySQLError{Number: 1305, Message: "FUNCTION nope does not exist"}}}},
+		{name: "hidden definition", args: `{"type": "procedure", "name": "close_month"}`, code: -32603, message: "not visible to this account",
+			queries: []fakeQuery{{match: "SHOW CREATE PROCEDURE `close_month`", columns: []string{"Procedure", "sql_mode", "Create Procedure"},
+				rows: [][]sqldriver.Value{{"close_month", "", nil}}}}},
+		{name: "missing name", args: `{"type": "procedure"}`, code: -32602, message: "name are required"},
+		{name: "unknown type", args: `{"type": "view", "name": "v"}`, code: -32602, message: "name are required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewMCPServer()
+			server.readClient = fakeClient(t, tt.queries...)
+			response := server.handleDefinitionTool(1, json.RawMessage(tt.args))
+
+			if tt.code != 0 {
+				if response.Error == nil || response.Error.Code != tt.code || !strings.Contains(response.Error.Message, tt.message) {
+					t.Fatalf("handleDefinitionTool() = %+v, want error code %d containing %q", response, tt.code, tt.message)
+				}
+				return
+			}
+			if response.Error != nil {
+				t.Fatalf("handleDefinitionTool() error = %s", response.Error.Message)
+			}
+			result := response.Result.(map[string]interface{})
+			if result["definition"] != tt.definition {
+				t.Errorf("definition = %q, want %q", result["definition"], tt.definition)
+			}
+			if text := contentText(result); !strings.Contains(text, tt.definition) {
+				t.Errorf("handleDefinitionTool() content = %q, want the definition", text)
+			}
+		})
+	}
+}
+
+// contentText joins the text messages of a tool result.
+func contentText(result map[string]interface{}) string {
+	content, _ := result["content"].([]map[string]interface{})
+	var texts []string
+	for _, message := range content {
+		text, _ := message["text"].(string)
+		texts = append(texts, text)
+	}
+	return strings.Join(texts, "\n")
+}
+
+func TestValidateDDLKeepsOtherTablesOutOfTheShadow(t *testing.T) {
+	lookups := []fakeQuery{
+		{match: "SELECT COUNT(*) FROM information_schema.TABLES", columns: []string{"count"}, rows: [][]sqldriver.Value{{int64(1)}}},
+		{match: "information_schema.KEY_COLUMN_USAGE", columns: []string{"schema", "name", "detail"}},
+		{match: "information_schema.VIEWS", columns: []string{"schema", "name", "detail"}},
+		{match: "information_schema.TRIGGERS", columns: []string{"schema", "name", "detail"}},
+		{match: "information_schema.ROUTINES", columns: []string{"schema", "name", "detail"}},
+	}
+	tests := []struct {
+		name  string
+		sql   string
+		other string
+	}{
+		{name: "exchange partition", sql: "ALTER TABLE orders EXCHANGE PARTITION p2023 WITH TABLE orders_2023", other: "orders_2023"},
+		{name: "foreign key", sql: "ALTER TABLE items ADD FOREIGN KEY (order_id) REFERENCES shop.orders (id) ON DELETE CASCADE", other: "shop.orders"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewMCPServer()
+			server.readClient = fakeClient(t, lookups...)
+			// Any statement reaching the write account fails the test below
+			server.writeClient = fakeClient(t)
+
+			report := server.validateDDL(context.Background(), tt.sql)
+			if report == nil {
+				t.Fatal("validateDDL() = nil")
+			}
+			if report.Validated || report.Shadow != nil || report.Online != nil {
+				t.Errorf("validateDDL(%q) applied the statement to a shadow table: %+v", tt.sql, report)
+			}
+			if !strings.Contains(report.Note, "name other tables ("+tt.other+")") || strings.Contains(report.Note, "Shadow validation unavailable") {
+				t.Errorf("validateDDL(%q) note = %q, want it to name %s and not try the shadow table", tt.sql, report.Note, tt.other)
+			}
+		})
+	}
+}
+
+// memorySink keeps audit entries in memory, failing to write those with the
+// outcome fail.
+type memorySink struct {
+	entries []audit.Entry
+	fail    string
+}
+
+func (m *memorySink) Write(entry *audit.Entry) error {
+	if entry.Outcome == m.fail {
+		return errors.New("disk full")
+	}
+	m.entries = append(m.entries, *entry)
+	return nil
+}
+func (m *memorySink) Close() error { return nil }
+
+func TestExecuteHooksRecordPendingBeforeOutcome(t *testing.T) {
+	tests := []struct {
+		name          string
+		sql           string
+		transactional bool
+	}{
+		{name: "statement in a transaction", sql: "DELETE FROM orders WHERE id = 1", transactional: true},
+		{name: "DDL", sql: "ALTER TABLE orders ADD COLUMN note TEXT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &memorySink{}
+			server := NewMCPServer()
+			server.auditLog = audit.NewLogger(sink)
+
+			var beforeExec []audit.Entry
+			client := fakeClient(t, fakeQuery{match: tt.sql, affected: 1, exec: func() {
+				beforeExec = append(beforeExec, sink.entries...)
+			}})
+			entry := audit.Entry{Tool: "execute", Action: "execute", SQL: tt.sql}
+			if _, err := client.Execute(context.Background(), tt.sql, server.executeHooks(entry, time.Now(), nil, nil)); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+
+			if tt.transactional && len(beforeExec) != 0 {
+				t.Errorf("A statement in a transaction should be recorded once it ran, got %+v before", beforeExec)
+			}
+			if !tt.transactional && (len(beforeExec) != 1 || beforeExec[0].Outcome != audit.OutcomePending) {
+				t.Errorf("DDL should be recorded as pending before it runs, got %+v", beforeExec)
+			}
+
+			entry.Outcome = audit.OutcomeSuccess
+			if warning := server.recordOutcome(entry); warning != nil {
+				t.Errorf("recordOutcome() = %v, want no warning", warning)
+			}
+			if len(sink.entries) != 2 || sink.entries[0].Outcome != audit.OutcomePending || sink.entries[1].Outcome != audit.OutcomeSuccess {
+				t.Fatalf("Audit entries = %+v, want pending then success", sink.entries)
+			}
+			if got := sink.entries[0].ActualRows; (got != nil) != tt.transactional {
+				t.Errorf("Pending ActualRows = %v, want it set only once the statement ran", got)
+			}
+		})
+	}
+}
+
+func TestExecuteHooksAuditFailure(t *testing.T) {
+	sink := &memorySink{fail: audit.OutcomePending}
+	server := NewMCPServer()
+	server.auditLog = audit.NewLogger(sink)
+
+	ran := false
+	sql := "ALTER TABLE orders ADD COLUMN note TEXT"
+	client := fakeClient(t, fakeQuery{match: sql, exec: func() { ran = true }})
+	entry := audit.Entry{Tool: "execute", Action: "execute", SQL: sql}
+	if _, err := client.Execute(context.Background(), sql, server.executeHooks(entry, time.Now(), nil, nil)); err == nil {
+		t.Error("Execute() should fail when the pending entry cannot be written")
+	}
+	if ran {
+		t.Error("DDL should not run when its pending entry cannot be written")
+	}
+
+	// Once a write took effect, failing to record it only warns
+	sink.fail = audit.OutcomeSuccess
+	entry.Outcome = audit.OutcomeSuccess
+	warning := server.recordOutcome(entry)
+	if warning == nil || !strings.Contains(warning["text"].(string), "The change was applied") {
+		t.Errorf("recordOutcome() = %v, want a warning that the change was applied", warning)
+	}
+}
+
+func TestHandleCallTool(t *testing.T) {
+	routine := fakeQuery{match: "information_schema.ROUTINES", columns: []string{"ROUTINE_DEFINITION"},
+		rows: [][]sqldriver.Value{{"BEGIN SELECT region, SUM(amount) FROM orders WHERE month = m GROUP BY region; SELECT COUNT(*) INTO total FROM orders; END"}}}
+	call := fakeQuery{match: "CALL close_month(?, @total)", args: []sqldriver.Value{"2024-01"},
+		columns: []string{"region", "amount"}, rows: [][]sqldriver.Value{{"EU", int64(120)}, {"US", int64(80)}},
+		more: []fakeQuery{{columns: []string{"orders"}, rows: [][]sqldriver.Value{{int64(2)}}}}}
+	total := fakeQuery{match: "SELECT @total", columns: []string{"@total"}, rows: [][]sqldriver.Value{{int64(42)}}}
+	lockWait := fakeQuery{match: "SET SESSION innodb_lock_wait_timeout"}
+
+	client := fakeClient(t, routine, call, total, lockWait)
+	server := NewMCPServer()
+	server.readClient, server.writeClient = client, client
+
+	args := `{"sql": "CALL close_month(?, @total)", "params": ["2024-01"]}`
+	response := server.handleCallTool(1, json.RawMessage(args))
+	if response.Error != nil {
+		t.Fatalf("Dry run error = %v", response.Error.Message)
+	}
+	result := response.Result.(map[string]interface{})
+	if result["rolled_back"] != true {
+		t.Errorf("The dry run should roll the call back, got %v", result["rolled_back"])
+	}
+	if sets, _ := result["result_sets"].([]*mysql.ResultSet); len(sets) != 2 {
+		t.Errorf("The dry run should return both result sets, got %d", len(sets))
+	}
+	text := contentText(result)
+	for _, want := range []string{"Result set 1 (2 rows)", "Result set 2 (1 rows)", "OUT parameters", "42"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Dry run output should contain %q:\n%s", want, text)
+		}
+	}
+	token, _ := result["confirm_token"].(string)
+	if token == "" {
+		t.Fatal("The dry run should issue a confirm token")
+	}
+
+	// The token is bound to the parameters it was issued for
+	response = server.handleCallTool(2, json.RawMessage(`{"sql": "CALL close_month(?, @total)", "params": ["2024-02"], "dry_run": false, "confirm_token": "`+token+`"}`))
+	if response.Error == nil {
+		t.Error("A token should not confirm a call with other parameters")
+	}
+
+	response = server.handleCallTool(3, json.RawMessage(`{"sql": "CALL close_month(?, @total)", "params": ["2024-01"], "dry_run": false, "confirm_token": "`+token+`"}`))
+	if response.Error != nil {
+		t.Fatalf("Confirmed call error = %v", response.Error.Message)
+	}
+	result = response.Result.(map[string]interface{})
+	if result["success"] != true || !strings.Contains(contentText(result), "CALL close_month completed successfully") {
+		t.Errorf("Confirmed call result = %v", result)
+	}
+
+	response = server.handleCallTool(4, json.RawMessage(`{"sql": "CALL close_month(?, @total)", "params": ["2024-01"], "dry_run": false, "confirm_token": "`+token+`"}`))
+	if response.Error == nil {
+		t.Error("A token should only confirm one call")
+	}
+}
+
+func TestHandleCallToolDoesNotRunUnsafeProcedures(t *testing.T) {
+	// Without a canned answer for the CALL, running it would fail the dry run
+	client := fakeClient(t, fakeQuery{match: "information_schema.ROUTINES", columns: []string{"ROUTINE_DEFINITION"},
+		rows: [][]sqldriver.Value{{"BEGIN DELETE FROM orders WHERE month = m; COMMIT; END"}}})
+	server := NewMCPServer()
+	server.readClient, server.writeClient = client, client
+
+	response := server.handleCallTool(1, json.RawMessage(`{"sql": "CALL purge_month(?)", "params": ["2024-01"]}`))
+	if response.Error != nil {
+		t.Fatalf("Dry run error = %v", response.Error.Message)
+	}
+	result := response.Result.(map[string]interface{})
+	if result["rolled_back"] != false || !strings.Contains(fmt.Sprint(result["not_run_reason"]), "COMMIT") {
+		t.Errorf("A procedure that commits should not be dry run, got %v", result)
+	}
+	if token, _ := result["confirm_token"].(string); token == "" {
+		t.Error("The dry run should still issue a confirm token")
+	}
+}
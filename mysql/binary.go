@@ -0,0 +1,107 @@
+package mysql
+
+import (
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Binary encodings, as used by BinaryOptions.
+const (
+	EncodingHex    = "hex"
+	EncodingBase64 = "base64"
+)
+
+// BinaryOptions control how Binary values are rendered.
+type BinaryOptions struct {
+	// Encoding is EncodingHex (the default) or EncodingBase64
+	Encoding string
+	// UUID renders the values of BINARY(16) columns as UUIDs
+	UUID bool
+	// MaxBytes renders at most this many bytes of a value, followed by its
+	// size; 0 renders every byte
+	MaxBytes int
+}
+
+// binaryTypes are the column types whose values are always bytes.
+var binaryTypes = map[string]bool{
+	"BINARY": true, "VARBINARY": true,
+	"TINYBLOB": true, "BLOB": true, "MEDIUMBLOB": true, "LONGBLOB": true,
+	"GEOMETRY": true,
+}
+
+// Binary is the value of a binary column, or of a text column that is not
+// valid UTF-8. It keeps every byte, so it can be written back exactly as an
+// SQL literal or a query argument, while String and MarshalJSON render it as
+// text: 0x followed by hex digits, base64: followed by base64, or a UUID.
+type Binary struct {
+	Data []byte
+	// uuid is set for the values of BINARY(16) columns
+	uuid    bool
+	options *BinaryOptions
+}
+
+// Bytes returns the value's bytes.
+func (b Binary) Bytes() []byte {
+	return b.Data
+}
+
+// Value passes the bytes to the driver when a Binary is used as an argument.
+func (b Binary) Value() (driver.Value, error) {
+	return b.Data, nil
+}
+
+func (b Binary) String() string {
+	options := b.options
+	if options == nil {
+		options = &BinaryOptions{}
+	}
+	if b.uuid && options.UUID {
+		return formatUUID(b.Data)
+	}
+
+	data := b.Data
+	truncated := options.MaxBytes > 0 && len(data) > options.MaxBytes
+	if truncated {
+		data = data[:options.MaxBytes]
+	}
+
+	var s string
+	if options.Encoding == EncodingBase64 {
+		s = "base64:" + base64.StdEncoding.EncodeToString(data)
+	} else {
+		s = "0x" + strings.ToUpper(hex.EncodeToString(data))
+	}
+	if truncated {
+		s += fmt.Sprintf("… (%d bytes)", len(b.Data))
+	}
+	return s
+}
+
+func (b Binary) MarshalJSON() ([]byte, error) {
+	return json.Marshal(b.String())
+}
+
+func formatUUID(b []byte) string {
+	h := hex.EncodeToString(b)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// convertBinary wraps the bytes of binary columns in Binary, and decodes
+// BIT columns as unsigned integers.
+func convertBinary(databaseType string, b []byte, options *BinaryOptions) (interface{}, bool) {
+	switch {
+	case databaseType == "BIT":
+		var n uint64
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		return n, true
+	case binaryTypes[databaseType]:
+		return Binary{Data: b, uuid: databaseType == "BINARY" && len(b) == 16, options: options}, true
+	}
+	return nil, false
+}
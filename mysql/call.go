@@ -0,0 +1,155 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CallOptions configures Client.Call.
+type CallOptions struct {
+	// Variables are read after the call, such as @total passed for an OUT
+	// parameter
+	Variables []string
+	// Rollback rolls the call's transaction back instead of committing it
+	Rollback bool
+	// BeforeCommit can veto committing the call, as in ExecuteHooks
+	BeforeCommit func(result *CallResult) error
+}
+
+// CallResult is the outcome of a CALL statement.
+type CallResult struct {
+	// ResultSets holds every result set the procedure returned, in order
+	ResultSets []*ResultSet
+	// Variables holds one row with the values of CallOptions.Variables, or
+	// is nil if none were read
+	Variables *ResultSet
+}
+
+// Call runs a CALL statement in a transaction on one connection, binding args
+// to its ? placeholders, reads every result set the procedure returns and
+// then the requested user variables. Statements in the procedure that commit
+// implicitly, such as DDL or COMMIT, end the transaction early, so a rolled
+// back call only undoes what came after them.
+//
+// Rolled back calls are retried after transient errors. Other calls are only
+// retried when they failed before the CALL was sent, as the procedure may
+// commit on its own.
+func (c *Client) Call(ctx context.Context, query string, options *CallOptions, args ...interface{}) (*CallResult, error) {
+	if options == nil {
+		options = &CallOptions{}
+	}
+
+	var result *CallResult
+	err := c.withRetry(ctx, func() (err error) {
+		result, err = c.call(ctx, query, options, args...)
+		return err
+	})
+	return result, err
+}
+
+// call is one attempt of Call.
+func (c *Client) call(ctx context.Context, query string, options *CallOptions, args ...interface{}) (*CallResult, error) {
+	conn, release, err := c.writeConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", timeoutError(ctx, err))
+	}
+	defer tx.Rollback()
+
+	// Once the CALL was sent the procedure may have committed on its own, so
+	// only rolled back calls are retried after that
+	sent := func(err error) error {
+		if options.Rollback {
+			return err
+		}
+		return permanent(err)
+	}
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, sent(fmt.Errorf("call failed: %w", timeoutError(ctx, err)))
+	}
+	result := &CallResult{}
+	if result.ResultSets, err = c.scanResultSets(ctx, rows); err != nil {
+		return nil, sent(err)
+	}
+
+	if len(options.Variables) > 0 {
+		if result.Variables, err = c.capture(ctx, tx, "SELECT "+strings.Join(options.Variables, ", ")); err != nil {
+			return nil, sent(err)
+		}
+	}
+
+	if options.Rollback {
+		return result, nil
+	}
+	if options.BeforeCommit != nil {
+		if err := options.BeforeCommit(result); err != nil {
+			return nil, permanent(fmt.Errorf("rolled back: %w", err))
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, permanent(fmt.Errorf("commit failed: %w", timeoutError(ctx, err)))
+	}
+	return result, nil
+}
+
+// scanResultSets reads and closes rows with any number of result sets.
+// Result sets without columns, such as the status a CALL ends with, are
+// skipped.
+func (c *Client) scanResultSets(ctx context.Context, rows *sql.Rows) ([]*ResultSet, error) {
+	defer rows.Close()
+
+	var sets []*ResultSet
+	for {
+		cursor, err := newRows(ctx, rows, &c.binary)
+		if err != nil {
+			return nil, err
+		}
+		set, err := readAll(cursor)
+		if err != nil {
+			return nil, err
+		}
+		if len(set.Columns) > 0 {
+			sets = append(sets, set)
+		}
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", timeoutError(ctx, err))
+	}
+	return sets, nil
+}
+
+// GetRoutineDefinition returns the body of a stored procedure or function.
+// The body is empty when the account may not see it, and found is false when
+// there is no such routine.
+func (c *Client) GetRoutineDefinition(ctx context.Context, schema, name, routineType string) (body string, found bool, err error) {
+	var schemaArg interface{}
+	if schema != "" {
+		schemaArg = schema
+	}
+
+	var definition sql.NullString
+	err = c.handle().QueryRowContext(ctx, `SELECT ROUTINE_DEFINITION FROM information_schema.ROUTINES
+		WHERE ROUTINE_SCHEMA = COALESCE(?, DATABASE()) AND ROUTINE_NAME = ? AND ROUTINE_TYPE = ?`,
+		schemaArg, name, routineType).Scan(&definition)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get routine definition: %w", timeoutError(ctx, err))
+	}
+	return definition.String, true, nil
+}
@@ -1,16 +1,54 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"math"
+	"regexp"
 	"strings"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	driver "github.com/go-sql-driver/mysql"
 )
 
+// ErrTimeout is wrapped into errors for statements that were cut off by their
+// deadline, whether by the client-side context or by the server-side limits
+// derived from it (MAX_EXECUTION_TIME, innodb_lock_wait_timeout).
+var ErrTimeout = errors.New("statement timed out")
+
+// ErrNoTransaction is returned by ExecuteInTransaction when it cannot start
+// the transaction to run the statement in, or the account or server does not
+// allow the statement to change data at all.
+var ErrNoTransaction = errors.New("transaction unavailable")
+
+// deniedErrors are the MySQL error numbers for a change the account or server
+// does not allow: ER_DBACCESS_DENIED_ERROR, ER_TABLEACCESS_DENIED_ERROR,
+// ER_COLUMNACCESS_DENIED_ERROR, ER_SPECIFIC_ACCESS_DENIED_ERROR and
+// ER_OPTION_PREVENTS_STATEMENT (read_only).
+var deniedErrors = map[uint16]bool{1044: true, 1142: true, 1143: true, 1227: true, 1290: true}
+
+// isDenied reports whether err refuses a statement for lack of privileges
+// rather than for what the statement does.
+func isDenied(err error) bool {
+	var mysqlErr *driver.MySQLError
+	return errors.As(err, &mysqlErr) && deniedErrors[mysqlErr.Number]
+}
+
+// selectHintRegex locates the SELECT keyword (optionally behind EXPLAIN and
+// leading comments) where an optimizer hint comment may be placed, and any
+// hint comment already following it.
+var selectHintRegex = regexp.MustCompile(`(?is)^(\s*(?:(?:--[^\n]*\n|/\*.*?\*/)\s*)*(?:EXPLAIN\s+(?:ANALYZE\s+)?(?:FORMAT\s*=\s*\w+\s+)?)?SELECT)(\s*/\*\+)?`)
+
 type Client struct {
-	db *sql.DB
+	db       *sql.DB
+	readOnly bool
+	binary   BinaryOptions
+	retry    RetryPolicy
+	server   ServerInfo
+	// session is the connection every statement runs on, if set
+	session *Session
 }
 
 type Config struct {
@@ -19,6 +57,13 @@ type Config struct {
 	User     string
 	Password string
 	Database string
+	// ReadOnly runs Query in READ ONLY transactions, so the server rejects
+	// any data change made through the client's queries
+	ReadOnly bool
+	// Binary controls how the values of binary columns are rendered
+	Binary BinaryOptions
+	// Retry controls how transient errors are retried
+	Retry RetryPolicy
 }
 
 func NewClient(config *Config) (*Client, error) {
@@ -44,125 +89,588 @@ func NewClient(config *Config) (*Client, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	return &Client{db: db}, nil
+	var version string
+	if err := db.QueryRow("SELECT VERSION()").Scan(&version); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to detect server version: %w", err)
+	}
+
+	return &Client{db: db, readOnly: config.ReadOnly, binary: config.Binary, retry: config.Retry, server: ParseServerVersion(version)}, nil
+}
+
+// NewClientFromDB wraps an open connection pool, such as one of another
+// driver, with the ReadOnly, Binary and Retry settings of config. The server
+// is not contacted, so its version is unknown.
+func NewClientFromDB(db *sql.DB, config *Config) *Client {
+	return &Client{db: db, readOnly: config.ReadOnly, binary: config.Binary, retry: config.Retry}
 }
 
 func (c *Client) Close() error {
 	return c.db.Close()
 }
 
-func (c *Client) Query(query string) ([]map[string]interface{}, error) {
-	rows, err := c.db.Query(query)
+// DB exposes the connection pool for components that manage their own
+// statements, such as the audit table.
+func (c *Client) DB() *sql.DB {
+	return c.db
+}
+
+// Query runs a read statement, binding args to its ? placeholders. When ctx
+// carries a deadline, SELECT statements also get a MAX_EXECUTION_TIME hint,
+// or max_statement_time on MariaDB, so the server stops working on them once
+// the client has given up. Transient errors are retried under the client's
+// RetryPolicy.
+func (c *Client) Query(ctx context.Context, query string, args ...interface{}) (*ResultSet, error) {
+	var result *ResultSet
+	err := c.withRetry(ctx, func() error {
+		rows, err := c.queryStream(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		result, err = collect(rows)
+		return err
+	})
+	return result, err
+}
+
+func (c *Client) GetTables(ctx context.Context) ([]string, error) {
+	rows, err := c.handle().QueryContext(ctx, "SHOW TABLES")
 	if err != nil {
-		return nil, fmt.Errorf("query failed: %w", err)
+		return nil, fmt.Errorf("failed to show tables: %w", err)
 	}
 	defer rows.Close()
 
-	columns, err := rows.Columns()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get columns: %w", err)
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, fmt.Errorf("failed to scan table name: %w", err)
+		}
+		tables = append(tables, table)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
 	}
 
-	var results []map[string]interface{}
-	values := make([]interface{}, len(columns))
-	valuePtrs := make([]interface{}, len(columns))
+	return tables, nil
+}
 
+func (c *Client) GetTableSchema(ctx context.Context, tableName string) (*ResultSet, error) {
+	query := fmt.Sprintf("DESCRIBE `%s`", strings.ReplaceAll(tableName, "`", "``"))
+	return c.Query(ctx, query)
+}
+
+// PrimaryKey describes the primary key of a table.
+type PrimaryKey struct {
+	Columns       []string
+	AutoIncrement bool
+}
+
+// GetPrimaryKey looks up the primary key columns of a table in schema, or in
+// the current database when schema is empty. A table without a primary key
+// has no columns.
+func (c *Client) GetPrimaryKey(ctx context.Context, schema, table string) (*PrimaryKey, error) {
+	var schemaArg interface{}
+	if schema != "" {
+		schemaArg = schema
+	}
+
+	rows, err := c.handle().QueryContext(ctx, `SELECT k.COLUMN_NAME, col.EXTRA
+		FROM information_schema.KEY_COLUMN_USAGE k
+		JOIN information_schema.COLUMNS col
+			ON col.TABLE_SCHEMA = k.TABLE_SCHEMA AND col.TABLE_NAME = k.TABLE_NAME AND col.COLUMN_NAME = k.COLUMN_NAME
+		WHERE k.CONSTRAINT_NAME = 'PRIMARY' AND k.TABLE_SCHEMA = COALESCE(?, DATABASE()) AND k.TABLE_NAME = ?
+		ORDER BY k.ORDINAL_POSITION`, schemaArg, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get primary key: %w", timeoutError(ctx, err))
+	}
+	defer rows.Close()
+
+	pk := &PrimaryKey{}
 	for rows.Next() {
-		for i := range columns {
-			valuePtrs[i] = &values[i]
+		var column, extra string
+		if err := rows.Scan(&column, &extra); err != nil {
+			return nil, fmt.Errorf("failed to scan primary key column: %w", err)
 		}
+		pk.Columns = append(pk.Columns, column)
+		if strings.Contains(strings.ToLower(extra), "auto_increment") {
+			pk.AutoIncrement = true
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", timeoutError(ctx, err))
+	}
+
+	return pk, nil
+}
+
+// GetGeneratedColumns lists the generated columns of a table in schema, or in
+// the current database when schema is empty.
+func (c *Client) GetGeneratedColumns(ctx context.Context, schema, table string) ([]string, error) {
+	var schemaArg interface{}
+	if schema != "" {
+		schemaArg = schema
+	}
 
-		if err := rows.Scan(valuePtrs...); err != nil {
-			return nil, fmt.Errorf("failed to scan row: %w", err)
+	rows, err := c.handle().QueryContext(ctx, `SELECT COLUMN_NAME FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = COALESCE(?, DATABASE()) AND TABLE_NAME = ? AND EXTRA LIKE '%GENERATED%'`, schemaArg, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get generated columns: %w", timeoutError(ctx, err))
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, fmt.Errorf("failed to scan column: %w", err)
 		}
+		columns = append(columns, column)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", timeoutError(ctx, err))
+	}
+
+	return columns, nil
+}
+
+// Execute executes a non-SELECT query (INSERT, UPDATE, DELETE, etc.),
+// binding args to its ? placeholders.
+// Statements that can run in a transaction are only committed once
+// hooks.BeforeCommit accepts their result; if it returns an error the
+// statement is rolled back. Other statements take effect as soon as they run,
+// so they are only run once hooks.BeforeExec accepts them.
+//
+// Transient errors are only retried when the statement certainly did not
+// take effect: before it was sent, when its transaction was rolled back, or
+// when the server rejected it. Failures of the hooks or of the commit itself
+// are never retried.
+func (c *Client) Execute(ctx context.Context, query string, hooks *ExecuteHooks, args ...interface{}) (*ExecResult, error) {
+	var result *ExecResult
+	err := c.withRetry(ctx, func() (err error) {
+		result, err = c.execute(ctx, query, hooks, args...)
+		return err
+	})
+	return result, err
+}
 
-		row := make(map[string]interface{})
-		for i, col := range columns {
-			var v interface{}
-			val := values[i]
-			b, ok := val.([]byte)
-			if ok {
-				v = string(b)
-			} else {
-				v = val
+// execute is one attempt of Execute.
+func (c *Client) execute(ctx context.Context, query string, hooks *ExecuteHooks, args ...interface{}) (*ExecResult, error) {
+	if hooks == nil {
+		hooks = &ExecuteHooks{}
+	}
+
+	conn, release, err := c.writeConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if !c.CanUseTransaction(query) {
+		captured, err := c.capture(ctx, conn, hooks.Capture)
+		if err != nil {
+			return nil, err
+		}
+		if hooks.BeforeExec != nil {
+			if err := hooks.BeforeExec(captured); err != nil {
+				return nil, permanent(fmt.Errorf("not run: %w", err))
 			}
-			row[col] = v
 		}
-		results = append(results, row)
+		result, err := conn.ExecContext(ctx, query, args...)
+		if err != nil {
+			err = fmt.Errorf("execution failed: %w", timeoutError(ctx, err))
+			if !isServerError(err) {
+				// The statement may have been applied before the connection broke
+				err = permanent(err)
+			}
+			return nil, err
+		}
+		// The statement is applied, so failing to read its warnings does not
+		// fail it
+		execResult := &ExecResult{Result: result}
+		execResult.Warnings, execResult.WarningsErr = showWarnings(ctx, conn)
+		execResult.AutoIncrementIncrement = autoIncrementIncrement(ctx, conn, result)
+		return execResult, nil
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("row iteration error: %w", err)
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", timeoutError(ctx, err))
+	}
+	defer tx.Rollback()
+
+	captured, err := c.capture(ctx, tx, hooks.Capture)
+	if err != nil {
+		return nil, err
 	}
 
-	return results, nil
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("execution failed: %w", timeoutError(ctx, err))
+	}
+	warnings, err := showWarnings(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	increment := autoIncrementIncrement(ctx, tx, result)
+
+	if hooks.BeforeCommit != nil {
+		if err := hooks.BeforeCommit(result, captured); err != nil {
+			return nil, permanent(fmt.Errorf("rolled back: %w", err))
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, permanent(fmt.Errorf("commit failed: %w", timeoutError(ctx, err)))
+	}
+	return &ExecResult{Result: result, Warnings: warnings, AutoIncrementIncrement: increment}, nil
 }
 
-func (c *Client) GetTables() ([]string, error) {
-	rows, err := c.db.Query("SHOW TABLES")
+// autoIncrementIncrement reads @@auto_increment_increment on q, the
+// connection or transaction a statement with this result ran on, if the
+// statement generated ids. It returns 0 when it did not or the setting cannot
+// be read.
+func autoIncrementIncrement(ctx context.Context, q queryer, result sql.Result) int64 {
+	if id, err := result.LastInsertId(); err != nil || id == 0 {
+		return 0
+	}
+	rows, err := q.QueryContext(ctx, "SELECT @@auto_increment_increment")
 	if err != nil {
-		return nil, fmt.Errorf("failed to show tables: %w", err)
+		return 0
 	}
 	defer rows.Close()
 
-	var tables []string
-	for rows.Next() {
-		var table string
-		if err := rows.Scan(&table); err != nil {
-			return nil, fmt.Errorf("failed to scan table name: %w", err)
+	var increment int64
+	if !rows.Next() || rows.Scan(&increment) != nil {
+		return 0
+	}
+	return increment
+}
+
+// BatchStatement is one statement of an ExecuteBatch call.
+type BatchStatement struct {
+	SQL string
+	// Capture is queried right before the statement runs, as in ExecuteHooks
+	Capture string
+}
+
+// ExecuteBatch runs statements in order in a single transaction, which is
+// committed only if all of them succeed and beforeCommit accepts their
+// results; otherwise nothing is applied. All statements must be able to run
+// in a transaction. Transient errors are retried as in Execute.
+func (c *Client) ExecuteBatch(ctx context.Context, statements []BatchStatement,
+	beforeCommit func(results []sql.Result, captured []*ResultSet) error) ([]sql.Result, error) {
+	var results []sql.Result
+	err := c.withRetry(ctx, func() (err error) {
+		results, err = c.executeBatch(ctx, statements, beforeCommit)
+		return err
+	})
+	return results, err
+}
+
+// executeBatch is one attempt of ExecuteBatch.
+func (c *Client) executeBatch(ctx context.Context, statements []BatchStatement,
+	beforeCommit func(results []sql.Result, captured []*ResultSet) error) ([]sql.Result, error) {
+	for i, statement := range statements {
+		if !c.CanUseTransaction(statement.SQL) {
+			return nil, fmt.Errorf("statement %d cannot run in a transaction", i+1)
 		}
-		tables = append(tables, table)
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("row iteration error: %w", err)
+	conn, release, err := c.writeConn(ctx)
+	if err != nil {
+		return nil, err
 	}
+	defer release()
 
-	return tables, nil
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", timeoutError(ctx, err))
+	}
+	defer tx.Rollback()
+
+	results := make([]sql.Result, len(statements))
+	captured := make([]*ResultSet, len(statements))
+	for i, statement := range statements {
+		if captured[i], err = c.capture(ctx, tx, statement.Capture); err != nil {
+			return nil, fmt.Errorf("statement %d: %w", i+1, err)
+		}
+		if results[i], err = tx.ExecContext(ctx, statement.SQL); err != nil {
+			return nil, fmt.Errorf("statement %d failed, nothing was applied: %w", i+1, timeoutError(ctx, err))
+		}
+	}
+
+	if beforeCommit != nil {
+		if err := beforeCommit(results, captured); err != nil {
+			return nil, permanent(fmt.Errorf("rolled back: %w", err))
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, permanent(fmt.Errorf("commit failed: %w", timeoutError(ctx, err)))
+	}
+	return results, nil
 }
 
-func (c *Client) GetTableSchema(tableName string) ([]map[string]interface{}, error) {
-	query := fmt.Sprintf("DESCRIBE `%s`", strings.ReplaceAll(tableName, "`", "``"))
-	return c.Query(query)
+// ExecuteHooks let callers act on the statement of an Execute call before it
+// takes effect.
+type ExecuteHooks struct {
+	// Capture is queried before the statement runs, in the same transaction.
+	// Ending it with FOR UPDATE locks the captured rows until commit.
+	Capture string
+	// BeforeCommit receives the statement's result and the captured rows
+	// before a statement that runs in a transaction commits
+	BeforeCommit func(result sql.Result, captured *ResultSet) error
+	// BeforeExec receives the captured rows before a statement that cannot
+	// run in a transaction is applied. BeforeCommit is not called for these
+	// statements, as they cannot be undone once they ran.
+	BeforeExec func(captured *ResultSet) error
+}
+
+// queryer is implemented by *sql.Conn and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
 }
 
-// Execute executes a non-SELECT query (INSERT, UPDATE, DELETE, etc.)
-func (c *Client) Execute(query string) (sql.Result, error) {
-	result, err := c.db.Exec(query)
+func (c *Client) capture(ctx context.Context, q queryer, query string) (*ResultSet, error) {
+	if query == "" {
+		return nil, nil
+	}
+	rows, err := q.QueryContext(ctx, query)
 	if err != nil {
-		return nil, fmt.Errorf("execution failed: %w", err)
+		return nil, fmt.Errorf("failed to capture rows before the statement: %w", timeoutError(ctx, err))
 	}
-	return result, nil
+	return c.scanRows(ctx, rows)
+}
+
+// DryRunProbe captures rows around a statement run by ExecuteInTransaction,
+// inside the same (rolled back) transaction.
+type DryRunProbe struct {
+	// Before is queried before the statement runs
+	Before     string
+	BeforeArgs []interface{}
+	// After builds the query run after the statement, from the statement's
+	// result and the rows captured by Before. An empty query skips it.
+	After func(result sql.Result, before *ResultSet) (string, []interface{})
+}
+
+// DryRunResult is the outcome of a rolled-back statement.
+type DryRunResult struct {
+	AffectedRows int64
+	Before       *ResultSet
+	After        *ResultSet
+	// Warnings are those of the statement, such as data truncation
+	Warnings []Warning
 }
 
 // ExecuteInTransaction executes a query within a transaction and returns the affected rows
-// The transaction is always rolled back, making this perfect for dry-run operations
-func (c *Client) ExecuteInTransaction(query string) (int64, error) {
+// The transaction is always rolled back, making this perfect for dry-run operations.
+// A non-nil probe captures rows before and after the statement. args are
+// bound to the statement's ? placeholders. As nothing is committed,
+// transient errors are retried under the client's RetryPolicy.
+func (c *Client) ExecuteInTransaction(ctx context.Context, query string, probe *DryRunProbe, args ...interface{}) (*DryRunResult, error) {
+	var dryRun *DryRunResult
+	err := c.withRetry(ctx, func() (err error) {
+		dryRun, err = c.executeInTransaction(ctx, query, probe, args...)
+		return err
+	})
+	return dryRun, err
+}
+
+// executeInTransaction is one attempt of ExecuteInTransaction.
+func (c *Client) executeInTransaction(ctx context.Context, query string, probe *DryRunProbe, args ...interface{}) (*DryRunResult, error) {
+	conn, release, err := c.writeConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	// Start transaction
-	tx, err := c.db.Begin()
+	tx, err := conn.BeginTx(ctx, nil)
 	if err != nil {
-		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w: %w", ErrNoTransaction, timeoutError(ctx, err))
 	}
-	
+
 	// Ensure we always rollback
 	defer tx.Rollback()
-	
+
+	dryRun := &DryRunResult{}
+	if probe != nil && probe.Before != "" {
+		rows, err := tx.QueryContext(ctx, probe.Before, probe.BeforeArgs...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to capture rows before the statement: %w", timeoutError(ctx, err))
+		}
+		if dryRun.Before, err = c.scanRows(ctx, rows); err != nil {
+			return nil, err
+		}
+	}
+
 	// Execute the query
-	result, err := tx.Exec(query)
+	result, err := tx.ExecContext(ctx, query, args...)
 	if err != nil {
-		return 0, fmt.Errorf("execution failed: %w", err)
+		if isDenied(err) {
+			return nil, fmt.Errorf("execution failed: %w: %w", ErrNoTransaction, err)
+		}
+		return nil, fmt.Errorf("execution failed: %w", timeoutError(ctx, err))
 	}
-	
+
 	// Get affected rows
-	affected, err := result.RowsAffected()
+	dryRun.AffectedRows, err = result.RowsAffected()
 	if err != nil {
-		return 0, fmt.Errorf("failed to get affected rows: %w", err)
+		return nil, fmt.Errorf("failed to get affected rows: %w", err)
 	}
-	
+	if dryRun.Warnings, err = showWarnings(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	if probe != nil && probe.After != nil {
+		if after, args := probe.After(result, dryRun.Before); after != "" {
+			rows, err := tx.QueryContext(ctx, after, args...)
+			if err != nil {
+				return nil, fmt.Errorf("failed to capture rows after the statement: %w", timeoutError(ctx, err))
+			}
+			if dryRun.After, err = c.scanRows(ctx, rows); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Transaction will be rolled back by defer
+	return dryRun, nil
+}
+
+// ExecuteBatchInTransaction runs statements in order in one transaction that
+// is always rolled back, like ExecuteInTransaction, and returns the rows each
+// statement affected. Later statements see the changes of earlier ones.
+// Transient errors are retried as in ExecuteInTransaction.
+func (c *Client) ExecuteBatchInTransaction(ctx context.Context, queries []string) ([]int64, error) {
+	var affected []int64
+	err := c.withRetry(ctx, func() (err error) {
+		affected, err = c.executeBatchInTransaction(ctx, queries)
+		return err
+	})
+	return affected, err
+}
+
+// executeBatchInTransaction is one attempt of ExecuteBatchInTransaction.
+func (c *Client) executeBatchInTransaction(ctx context.Context, queries []string) ([]int64, error) {
+	conn, release, err := c.writeConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", timeoutError(ctx, err))
+	}
+
+	// Ensure we always rollback
+	defer tx.Rollback()
+
+	affected := make([]int64, len(queries))
+	for i, query := range queries {
+		result, err := tx.ExecContext(ctx, query)
+		if err != nil {
+			return nil, fmt.Errorf("statement %d failed: %w", i+1, timeoutError(ctx, err))
+		}
+		if affected[i], err = result.RowsAffected(); err != nil {
+			return nil, fmt.Errorf("failed to get affected rows of statement %d: %w", i+1, err)
+		}
+	}
+
 	// Transaction will be rolled back by defer
 	return affected, nil
 }
 
+// writeConn reserves a connection for a write. When ctx has a deadline the
+// session's innodb_lock_wait_timeout is lowered to fit inside it, so a statement
+// stuck on row locks fails on the server instead of outliving the caller. The
+// release func restores the server default, or a session's own value, before
+// returning the connection.
+func (c *Client) writeConn(ctx context.Context) (*sql.Conn, func(), error) {
+	conn, closeConn, err := c.conn(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return conn, closeConn, nil
+	}
+
+	// A session gets back the lock wait timeout it had chosen
+	restore := "DEFAULT"
+	if c.session != nil {
+		if err := conn.QueryRowContext(ctx, "SELECT @@SESSION.innodb_lock_wait_timeout").Scan(&restore); err != nil {
+			return nil, nil, fmt.Errorf("failed to read lock wait timeout: %w", timeoutError(ctx, err))
+		}
+	}
+
+	// innodb_lock_wait_timeout has a granularity of one second
+	seconds := int64(math.Ceil(time.Until(deadline).Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("SET SESSION innodb_lock_wait_timeout = %d", seconds)); err != nil {
+		closeConn()
+		return nil, nil, fmt.Errorf("failed to set lock wait timeout: %w", timeoutError(ctx, err))
+	}
+
+	release := func() {
+		conn.ExecContext(context.Background(), "SET SESSION innodb_lock_wait_timeout = "+restore)
+		closeConn()
+	}
+	return conn, release, nil
+}
+
+// withMaxExecutionTime adds a MAX_EXECUTION_TIME optimizer hint matching the
+// remaining time on ctx to SELECT statements. Other statements, statements that
+// already carry the hint and contexts without a deadline are left untouched.
+func withMaxExecutionTime(ctx context.Context, query string) string {
+	deadline, ok := ctx.Deadline()
+	if !ok || strings.Contains(strings.ToUpper(query), "MAX_EXECUTION_TIME") {
+		return query
+	}
+
+	loc := selectHintRegex.FindStringSubmatchIndex(query)
+	if loc == nil {
+		return query
+	}
+
+	ms := time.Until(deadline).Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	hint := fmt.Sprintf("MAX_EXECUTION_TIME(%d)", ms)
+
+	// MySQL only honours the first hint comment after SELECT, so merge into an
+	// existing one rather than adding a second
+	if loc[4] != -1 {
+		return query[:loc[5]] + " " + hint + " " + strings.TrimLeft(query[loc[5]:], " \t\n")
+	}
+	return query[:loc[3]] + " /*+ " + hint + " */" + query[loc[3]:]
+}
+
+// timeoutError marks deadline-related failures with ErrTimeout.
+func timeoutError(ctx context.Context, err error) error {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+
+	var mysqlErr *driver.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case 3024, 1205: // ER_QUERY_TIMEOUT, ER_LOCK_WAIT_TIMEOUT
+			return fmt.Errorf("%w: %w", ErrTimeout, err)
+		}
+	}
+	return err
+}
+
 // CanUseTransaction checks if a query can be executed in a transaction
 // Some statements like CREATE, DROP, ALTER cannot be rolled back in MySQL
 func (c *Client) CanUseTransaction(query string) bool {
@@ -0,0 +1,624 @@
+package mysql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	driver "github.com/go-sql-driver/mysql"
+)
+
+func TestWithMaxExecutionTime(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{
+			name:     "Simple SELECT",
+			query:    "SELECT * FROM users",
+			expected: `^SELECT /\*\+ MAX_EXECUTION_TIME\(\d+\) \*/ \* FROM users$`,
+		},
+		{
+			name:     "SELECT with comment",
+			query:    "-- comment\nselect id from users",
+			expected: `^-- comment\nselect /\*\+ MAX_EXECUTION_TIME\(\d+\) \*/ id from users$`,
+		},
+		{
+			name:     "Existing hint is merged",
+			query:    "SELECT /*+ BKA(u) */ * FROM users u",
+			expected: `^SELECT /\*\+ MAX_EXECUTION_TIME\(\d+\) BKA\(u\) \*/ \* FROM users u$`,
+		},
+		{
+			name:     "EXPLAIN ANALYZE",
+			query:    "EXPLAIN ANALYZE SELECT * FROM users",
+			expected: `^EXPLAIN ANALYZE SELECT /\*\+ MAX_EXECUTION_TIME\(\d+\) \*/ \* FROM users$`,
+		},
+		{
+			name:     "Explicit limit is kept",
+			query:    "SELECT /*+ MAX_EXECUTION_TIME(10) */ * FROM users",
+			expected: `^SELECT /\*\+ MAX_EXECUTION_TIME\(10\) \*/ \* FROM users$`,
+		},
+		{
+			name:     "SHOW is untouched",
+			query:    "SHOW TABLES",
+			expected: `^SHOW TABLES$`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := withMaxExecutionTime(ctx, tt.query)
+			if !regexp.MustCompile(tt.expected).MatchString(result) {
+				t.Errorf("withMaxExecutionTime(%q) = %q, want match for %q", tt.query, result, tt.expected)
+			}
+		})
+	}
+
+	if result := withMaxExecutionTime(context.Background(), "SELECT 1"); result != "SELECT 1" {
+		t.Errorf("Query without deadline should be untouched, got %q", result)
+	}
+}
+
+func TestConvertValue(t *testing.T) {
+	tests := []struct {
+		databaseType string
+		value        interface{}
+		expected     interface{}
+	}{
+		{"BIGINT", []byte("-42"), int64(-42)},
+		{"UNSIGNED BIGINT", []byte("18446744073709551615"), uint64(18446744073709551615)},
+		{"YEAR", []byte("2024"), int64(2024)},
+		{"DOUBLE", []byte("1.5"), 1.5},
+		{"DECIMAL", []byte("12345678901234567890.12"), json.Number("12345678901234567890.12")},
+		{"VARCHAR", []byte("007"), "007"},
+		{"INT", int64(7), int64(7)},
+		{"INT", nil, nil},
+		{"BIT", []byte{0x01, 0x00}, uint64(256)},
+	}
+
+	for _, tt := range tests {
+		if result := convertValue(tt.databaseType, tt.value, nil); result != tt.expected {
+			t.Errorf("convertValue(%q, %v) = %#v, want %#v", tt.databaseType, tt.value, result, tt.expected)
+		}
+	}
+}
+
+func TestBinaryValues(t *testing.T) {
+	uuid := []byte{0x3f, 0x2a, 0x1b, 0x4c, 0x5d, 0x6e, 0x4f, 0x70, 0x81, 0x92, 0xa3, 0xb4, 0xc5, 0xd6, 0xe7, 0xf8}
+	tests := []struct {
+		name         string
+		databaseType string
+		value        []byte
+		options      *BinaryOptions
+		expected     string
+	}{
+		{"Blob as hex", "BLOB", []byte("hi\x00"), nil, "0x686900"},
+		{"Invalid UTF-8 text", "VARCHAR", []byte{0xff, 0xfe}, nil, "0xFFFE"},
+		{"Base64", "VARBINARY", []byte("hi"), &BinaryOptions{Encoding: EncodingBase64}, "base64:aGk="},
+		{"Truncated", "LONGBLOB", []byte("abcdef"), &BinaryOptions{MaxBytes: 2}, "0x6162… (6 bytes)"},
+		{"UUID", "BINARY", uuid, &BinaryOptions{UUID: true}, "3f2a1b4c-5d6e-4f70-8192-a3b4c5d6e7f8"},
+		{"UUID disabled", "BINARY", uuid, nil, "0x3F2A1B4C5D6E4F708192A3B4C5D6E7F8"},
+		{"UUID only for BINARY(16)", "VARBINARY", uuid[:4], &BinaryOptions{UUID: true}, "0x3F2A1B4C"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, ok := convertValue(tt.databaseType, tt.value, tt.options).(Binary)
+			if !ok {
+				t.Fatalf("convertValue(%q) did not return a Binary", tt.databaseType)
+			}
+			if s := value.String(); s != tt.expected {
+				t.Errorf("String() = %q, want %q", s, tt.expected)
+			}
+			if data, _ := json.Marshal(value); string(data) != strconv.Quote(tt.expected) {
+				t.Errorf("MarshalJSON() = %s, want %q", data, tt.expected)
+			}
+			if !bytes.Equal(value.Bytes(), tt.value) {
+				t.Errorf("Bytes() = %v, want every byte %v", value.Bytes(), tt.value)
+			}
+		})
+	}
+}
+
+func TestResultSetDuplicateColumns(t *testing.T) {
+	results := &ResultSet{
+		Columns: []Column{{Name: "id"}, {Name: "id"}, {Name: "name"}},
+		Rows:    [][]interface{}{{int64(1), int64(2), "a"}},
+	}
+
+	if names := results.ColumnNames(); strings.Join(names, ",") != "id,id,name" {
+		t.Errorf("ColumnNames() = %v", names)
+	}
+	if v := results.Get(0, "id"); v != int64(1) {
+		t.Errorf("Get(0, id) = %v, want the first id column", v)
+	}
+	if v := results.Get(1, "id"); v != nil {
+		t.Errorf("Get(1, id) = %v, want nil for a missing row", v)
+	}
+	if maps := results.Maps(); len(maps) != 1 || maps[0]["id"] != int64(1) || maps[0]["name"] != "a" {
+		t.Errorf("Maps() = %v", maps)
+	}
+
+	var empty *ResultSet
+	if empty.Len() != 0 || empty.Maps() != nil {
+		t.Error("A nil result set should be empty")
+	}
+}
+
+func TestObjectTypesAreComplete(t *testing.T) {
+	for _, objectType := range []string{ObjectProcedure, ObjectFunction, ObjectTrigger, ObjectEvent} {
+		if objectListQueries[objectType] == "" || showCreateColumns[objectType] == "" {
+			t.Errorf("%s is missing a list query or SHOW CREATE column", objectType)
+		}
+	}
+}
+
+func TestParseServerVersion(t *testing.T) {
+	tests := []struct {
+		version  string
+		expected string
+	}{
+		{"8.0.36", "MySQL 8.0.36"},
+		{"5.7.44-log", "MySQL 5.7.44"},
+		{"10.6.12-MariaDB-log", "MariaDB 10.6.12"},
+		{"5.5.5-10.3.39-MariaDB-0+deb10u1", "MariaDB 10.3.39"},
+		{"unknown", "MySQL 0.0.0"},
+	}
+
+	for _, tt := range tests {
+		if result := ParseServerVersion(tt.version).String(); result != tt.expected {
+			t.Errorf("ParseServerVersion(%q) = %s, want %s", tt.version, result, tt.expected)
+		}
+	}
+}
+
+func TestExplainStatement(t *testing.T) {
+	tests := []struct {
+		version  string
+		analyze  bool
+		format   string
+		expected string
+		wantErr  bool
+	}{
+		{version: "8.0.36", expected: "EXPLAIN"},
+		{version: "8.0.36", format: ExplainTree, expected: "EXPLAIN FORMAT=TREE"},
+		{version: "8.0.36", analyze: true, expected: "EXPLAIN ANALYZE"},
+		{version: "8.0.36", analyze: true, format: ExplainJSON, wantErr: true},
+		{version: "8.0.17", analyze: true, wantErr: true},
+		{version: "5.7.44", format: ExplainJSON, expected: "EXPLAIN FORMAT=JSON"},
+		{version: "5.7.44", format: ExplainTree, wantErr: true},
+		{version: "10.6.12-MariaDB", analyze: true, expected: "ANALYZE"},
+		{version: "10.6.12-MariaDB", analyze: true, format: ExplainJSON, expected: "ANALYZE FORMAT=JSON"},
+		{version: "10.6.12-MariaDB", format: ExplainTree, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		result, err := ParseServerVersion(tt.version).ExplainStatement(tt.analyze, tt.format)
+		if (err != nil) != tt.wantErr || result != tt.expected {
+			t.Errorf("ExplainStatement(%s, analyze=%v, %q) = %q, %v", tt.version, tt.analyze, tt.format, result, err)
+		}
+	}
+}
+
+func TestLimitExecutionTime(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	mariadb := &Client{server: ParseServerVersion("10.6.12-MariaDB")}
+	if result := mariadb.limitExecutionTime(ctx, "SELECT 1"); !regexp.MustCompile(`^SET STATEMENT max_statement_time=\d+\.\d{3} FOR SELECT 1$`).MatchString(result) {
+		t.Errorf("MariaDB should get max_statement_time, got %q", result)
+	}
+	if result := mariadb.limitExecutionTime(ctx, "SHOW TABLES"); result != "SHOW TABLES" {
+		t.Errorf("Other statements should be untouched, got %q", result)
+	}
+
+	mysql := &Client{server: ParseServerVersion("8.0.36")}
+	if result := mysql.limitExecutionTime(ctx, "SELECT 1"); !strings.Contains(result, "MAX_EXECUTION_TIME") {
+		t.Errorf("MySQL should get the MAX_EXECUTION_TIME hint, got %q", result)
+	}
+	old := &Client{server: ParseServerVersion("5.6.51")}
+	if result := old.limitExecutionTime(ctx, "SELECT 1"); result != "SELECT 1" {
+		t.Errorf("MySQL 5.6 has no statement time limit, got %q", result)
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	c := &Client{retry: RetryPolicy{MaxAttempts: 3}}
+	deadlock := &driver.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+
+	tests := []struct {
+		name     string
+		errs     []error
+		attempts int
+		retries  int
+		wantErr  bool
+	}{
+		{"Success", []error{nil}, 1, 0, false},
+		{"Deadlock then success", []error{deadlock, nil}, 2, 1, false},
+		{"Lock wait timeout behind ErrTimeout", []error{timeoutError(context.Background(), &driver.MySQLError{Number: 1205}), nil}, 2, 1, false},
+		{"Lost connection then success", []error{driver.ErrInvalidConn, nil}, 2, 1, false},
+		{"Gives up", []error{deadlock, deadlock, deadlock}, 3, 2, true},
+		{"Other errors are not retried", []error{&driver.MySQLError{Number: 1146}}, 1, 0, true},
+		{"Permanent errors are not retried", []error{permanent(deadlock)}, 1, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := TrackRetries(context.Background())
+			attempts := 0
+			err := c.withRetry(ctx, func() error {
+				attempts++
+				return tt.errs[attempts-1]
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("withRetry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if attempts != tt.attempts || len(Retries(ctx)) != tt.retries {
+				t.Errorf("withRetry() made %d attempts and %d retries, want %d and %d", attempts, len(Retries(ctx)), tt.attempts, tt.retries)
+			}
+			var p *permanentError
+			if errors.As(err, &p) {
+				t.Errorf("withRetry() should unwrap permanent errors, got %v", err)
+			}
+		})
+	}
+
+	if err := c.withRetry(context.Background(), func() error { return deadlock }); !strings.Contains(err.Error(), "gave up after 3 attempts") {
+		t.Errorf("The error should tell how often it was tried, got %v", err)
+	}
+}
+
+func TestWithRetryInSession(t *testing.T) {
+	c := &Client{retry: RetryPolicy{MaxAttempts: 3}, session: &Session{}}
+
+	attempts := 0
+	err := c.withRetry(context.Background(), func() error {
+		attempts++
+		if attempts == 1 {
+			return &driver.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+		}
+		return nil
+	})
+	if err != nil || attempts != 2 || c.session.Lost() {
+		t.Errorf("deadlock in session: err = %v, attempts = %d, lost = %v; want it retried", err, attempts, c.session.Lost())
+	}
+
+	attempts = 0
+	err = c.withRetry(context.Background(), func() error {
+		attempts++
+		return driver.ErrInvalidConn
+	})
+	if !errors.Is(err, ErrSessionLost) || !errors.Is(err, driver.ErrInvalidConn) || attempts != 1 || !c.session.Lost() {
+		t.Errorf("lost connection in session: err = %v, attempts = %d, lost = %v; want ErrSessionLost after one attempt",
+			err, attempts, c.session.Lost())
+	}
+	if _, _, err := c.conn(context.Background()); !errors.Is(err, ErrSessionLost) {
+		t.Errorf("conn() of a lost session error = %v, want ErrSessionLost", err)
+	}
+}
+
+func TestShadowName(t *testing.T) {
+	name := shadowName(strings.Repeat("注文", 40))
+	if !utf8.ValidString(name) {
+		t.Errorf("shadowName() = %q, want valid UTF-8", name)
+	}
+	if n := utf8.RuneCountInString(name); n != 64 {
+		t.Errorf("shadowName() has %d characters, want 64", n)
+	}
+	if name := shadowName("orders"); !strings.HasPrefix(name, "orders_") || len(name) != len("orders_")+8 {
+		t.Errorf("shadowName(orders) = %q", name)
+	}
+}
+
+func TestIsDenied(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&driver.MySQLError{Number: 1142, Message: "UPDATE command denied to user"}, true},
+		{timeoutError(context.Background(), &driver.MySQLError{Number: 1290}), true},
+		{&driver.MySQLError{Number: 1062, Message: "Duplicate entry"}, false},
+		{errors.New("connection refused"), false},
+	}
+	for _, tt := range tests {
+		if got := isDenied(tt.err); got != tt.want {
+			t.Errorf("isDenied(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestCall(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *CallOptions
+		wantErr bool
+		wantEnd string
+	}{
+		{name: "committed", options: &CallOptions{Variables: []string{"@total"}}, wantEnd: "COMMIT"},
+		{name: "rolled back", options: &CallOptions{Variables: []string{"@total"}, Rollback: true}, wantEnd: "ROLLBACK"},
+		{name: "vetoed", options: &CallOptions{Variables: []string{"@total"}, BeforeCommit: func(*CallResult) error {
+			return errors.New("audit log unavailable")
+		}}, wantErr: true, wantEnd: "ROLLBACK"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := newFakeClient(t, &Config{},
+				fakeStatement{match: "CALL close_month", results: []fakeResult{
+					{columns: []string{"region", "amount"}, rows: [][]sqldriver.Value{{"EU", int64(120)}, {"US", int64(80)}}},
+					{columns: []string{"orders"}, rows: [][]sqldriver.Value{{int64(2)}}},
+					// The status a CALL ends with has no columns
+					{},
+				}},
+				fakeStatement{match: "SELECT @total", results: []fakeResult{
+					{columns: []string{"@total"}, rows: [][]sqldriver.Value{{int64(200)}}},
+				}})
+
+			result, err := client.Call(context.Background(), "CALL close_month(?, @total)", tt.options, "2024-01")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Call() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			want := []string{"BEGIN", "CALL close_month(?, @total) [2024-01]", "SELECT @total", tt.wantEnd}
+			if log := server.entries(); !reflect.DeepEqual(log, want) {
+				t.Errorf("Statements = %q, want %q", log, want)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if len(result.ResultSets) != 2 || result.ResultSets[0].Len() != 2 || result.ResultSets[1].Len() != 1 {
+				t.Fatalf("ResultSets = %+v, want both result sets with columns", result.ResultSets)
+			}
+			if names := result.ResultSets[0].ColumnNames(); !reflect.DeepEqual(names, []string{"region", "amount"}) {
+				t.Errorf("First result set columns = %v", names)
+			}
+			if got := result.Variables.Maps(); len(got) != 1 || got[0]["@total"] != int64(200) {
+				t.Errorf("Variables = %v, want @total = 200", got)
+			}
+		})
+	}
+}
+
+func TestQueryStream(t *testing.T) {
+	client, server := newFakeClient(t, &Config{ReadOnly: true}, fakeStatement{match: "SELECT id, name FROM users",
+		results: []fakeResult{{columns: []string{"id", "name"}, rows: [][]sqldriver.Value{{int64(1), "alice"}, {int64(2), "bob"}}}}})
+
+	rows, err := client.QueryStream(context.Background(), "SELECT id, name FROM users WHERE id > ?", 0)
+	if err != nil {
+		t.Fatalf("QueryStream() error = %v", err)
+	}
+	var read [][]interface{}
+	for rows.Next() {
+		read = append(read, rows.Row())
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("Err() = %v", err)
+	}
+	if want := [][]interface{}{{int64(1), "alice"}, {int64(2), "bob"}}; !reflect.DeepEqual(read, want) {
+		t.Errorf("Rows = %v, want %v", read, want)
+	}
+	if warnings, err := rows.Warnings(); warnings != nil || err != nil {
+		t.Errorf("Warnings() = %v, %v", warnings, err)
+	}
+	rows.Close()
+
+	want := []string{"BEGIN READ ONLY", "SELECT id, name FROM users WHERE id > ? [0]", "ROLLBACK"}
+	if log := server.entries(); !reflect.DeepEqual(log, want) {
+		t.Errorf("Statements = %q, want %q", log, want)
+	}
+}
+
+func TestQueryStreamErrorMidStream(t *testing.T) {
+	// A transient error, which is not retried once rows were read
+	lost := driver.ErrInvalidConn
+	client, server := newFakeClient(t, &Config{Retry: RetryPolicy{MaxAttempts: 3}}, fakeStatement{match: "SELECT id FROM users",
+		results: []fakeResult{{columns: []string{"id"}, rows: [][]sqldriver.Value{{int64(1)}, {int64(2)}}, err: lost}}})
+
+	rows, err := client.QueryStream(context.Background(), "SELECT id FROM users")
+	if err != nil {
+		t.Fatalf("QueryStream() error = %v", err)
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		count++
+	}
+	if count != 2 {
+		t.Errorf("Read %d rows before the error, want 2", count)
+	}
+	if err := rows.Err(); !errors.Is(err, lost) || !strings.Contains(err.Error(), "row iteration error") {
+		t.Errorf("Err() = %v, want the error that ended the result", err)
+	}
+	if rows.Next() {
+		t.Error("Next() should keep returning false after an error")
+	}
+
+	if log := server.entries(); !reflect.DeepEqual(log, []string{"SELECT id FROM users"}) {
+		t.Errorf("Statements = %q, want the query once", log)
+	}
+}
+
+func TestQueryStreamCancel(t *testing.T) {
+	client, server := newFakeClient(t, &Config{}, fakeStatement{match: "SELECT id FROM users",
+		results: []fakeResult{{columns: []string{"id"}, rows: [][]sqldriver.Value{{int64(1)}, {int64(2)}, {int64(3)}}}}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rows, err := client.QueryStream(ctx, "SELECT id FROM users")
+	if err != nil {
+		t.Fatalf("QueryStream() error = %v", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		t.Fatalf("Next() = false, err %v", rows.Err())
+	}
+	cancel()
+	// database/sql closes the result once it sees the cancellation
+	select {
+	case <-server.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The result was not closed after the context was canceled")
+	}
+
+	if rows.Next() {
+		t.Error("Next() should stop once the context is canceled")
+	}
+	if err := rows.Err(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Err() = %v, want context.Canceled", err)
+	}
+}
+
+// fakeResult is one result set of a fakeStatement. err, if set, ends it after
+// its rows, as a connection lost mid-stream would.
+type fakeResult struct {
+	columns []string
+	rows    [][]sqldriver.Value
+	err     error
+}
+
+// fakeStatement answers the statements containing match with its results.
+type fakeStatement struct {
+	match   string
+	results []fakeResult
+}
+
+// fakeServer is a database/sql connector answering statements with the first
+// fakeStatement that matches. It logs each statement with its arguments and
+// the transactions around them. Statements never have warnings.
+type fakeServer struct {
+	statements []fakeStatement
+	mu         sync.Mutex
+	log        []string
+	// closed receives a value whenever database/sql closes a result
+	closed chan struct{}
+}
+
+// newFakeClient returns a client with the settings of config whose
+// statements are answered by a fakeServer.
+func newFakeClient(t *testing.T, config *Config, statements ...fakeStatement) (*Client, *fakeServer) {
+	server := &fakeServer{statements: statements, closed: make(chan struct{}, 16)}
+	db := sql.OpenDB(server)
+	t.Cleanup(func() { db.Close() })
+	return NewClientFromDB(db, config), server
+}
+
+func (s *fakeServer) Connect(context.Context) (sqldriver.Conn, error) { return fakeConn{s}, nil }
+func (s *fakeServer) Driver() sqldriver.Driver                        { return s }
+func (s *fakeServer) Open(string) (sqldriver.Conn, error)             { return fakeConn{s}, nil }
+
+func (s *fakeServer) record(entry string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.log = append(s.log, entry)
+}
+
+// entries returns the log, leaving out the warning counts read after
+// statements.
+func (s *fakeServer) entries() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var entries []string
+	for _, entry := range s.log {
+		if entry != "SHOW COUNT(*) WARNINGS" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+type fakeConn struct{ server *fakeServer }
+
+func (c fakeConn) Prepare(string) (sqldriver.Stmt, error) {
+	return nil, errors.New("fakeConn does not prepare statements")
+}
+func (c fakeConn) Close() error { return nil }
+func (c fakeConn) Begin() (sqldriver.Tx, error) {
+	return c.BeginTx(context.Background(), sqldriver.TxOptions{})
+}
+func (c fakeConn) BeginTx(_ context.Context, options sqldriver.TxOptions) (sqldriver.Tx, error) {
+	if options.ReadOnly {
+		c.server.record("BEGIN READ ONLY")
+	} else {
+		c.server.record("BEGIN")
+	}
+	return fakeTx{c.server}, nil
+}
+func (c fakeConn) QueryContext(_ context.Context, query string, args []sqldriver.NamedValue) (sqldriver.Rows, error) {
+	entry := query
+	if len(args) > 0 {
+		values := make([]sqldriver.Value, len(args))
+		for i, arg := range args {
+			values[i] = arg.Value
+		}
+		entry += fmt.Sprint(" ", values)
+	}
+	c.server.record(entry)
+
+	for _, statement := range c.server.statements {
+		if strings.Contains(query, statement.match) {
+			// The rows read are dropped from a copy, so statements can be repeated
+			return &fakeRows{server: c.server, results: append([]fakeResult(nil), statement.results...)}, nil
+		}
+	}
+	if query == "SHOW COUNT(*) WARNINGS" {
+		return &fakeRows{server: c.server, results: []fakeResult{{columns: []string{"@@session.warning_count"}, rows: [][]sqldriver.Value{{int64(0)}}}}}, nil
+	}
+	return nil, fmt.Errorf("unexpected query %q", query)
+}
+
+type fakeTx struct{ server *fakeServer }
+
+func (tx fakeTx) Commit() error   { tx.server.record("COMMIT"); return nil }
+func (tx fakeTx) Rollback() error { tx.server.record("ROLLBACK"); return nil }
+
+type fakeRows struct {
+	server  *fakeServer
+	results []fakeResult
+}
+
+func (r *fakeRows) Columns() []string { return r.results[0].columns }
+func (r *fakeRows) Close() error {
+	select {
+	case r.server.closed <- struct{}{}:
+	default:
+	}
+	return nil
+}
+func (r *fakeRows) Next(dest []sqldriver.Value) error {
+	result := &r.results[0]
+	if len(result.rows) == 0 {
+		if result.err != nil {
+			return result.err
+		}
+		return io.EOF
+	}
+	copy(dest, result.rows[0])
+	result.rows = result.rows[1:]
+	return nil
+}
+func (r *fakeRows) HasNextResultSet() bool { return len(r.results) > 1 }
+func (r *fakeRows) NextResultSet() error {
+	if len(r.results) < 2 {
+		return io.EOF
+	}
+	r.results = r.results[1:]
+	return nil
+}
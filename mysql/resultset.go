@@ -0,0 +1,173 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Column describes a result column.
+type Column struct {
+	Name string `json:"name"`
+	// DatabaseType is the MySQL type, such as VARCHAR, DECIMAL or UNSIGNED BIGINT
+	DatabaseType string `json:"type"`
+	// Nullable is nil when the driver does not know
+	Nullable  *bool `json:"nullable,omitempty"`
+	Length    int64 `json:"length,omitempty"`
+	Precision int64 `json:"precision,omitempty"`
+	Scale     int64 `json:"scale,omitempty"`
+}
+
+// ResultSet holds the rows of a query in column order. Values are typed by
+// column: integers and BIT as int64 or uint64, FLOAT and DOUBLE as float64,
+// DECIMAL as json.Number so no digits are lost, temporal types as time.Time
+// where the driver parses them, binary columns and text that is not valid
+// UTF-8 as Binary, NULL as nil and everything else as string.
+type ResultSet struct {
+	Columns []Column        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+	// Warnings are those of the query, for results read by Query
+	Warnings []Warning `json:"-"`
+}
+
+// Len returns the number of rows.
+func (r *ResultSet) Len() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.Rows)
+}
+
+// ColumnNames returns the column names in order, including duplicates.
+func (r *ResultSet) ColumnNames() []string {
+	if r == nil {
+		return nil
+	}
+	names := make([]string, len(r.Columns))
+	for i, column := range r.Columns {
+		names[i] = column.Name
+	}
+	return names
+}
+
+// Get returns the value of the first column with the given name in a row, or
+// nil if there is no such row or column.
+func (r *ResultSet) Get(row int, column string) interface{} {
+	if row < 0 || row >= r.Len() {
+		return nil
+	}
+	for i, c := range r.Columns {
+		if c.Name == column {
+			return r.Rows[row][i]
+		}
+	}
+	return nil
+}
+
+// Maps returns the rows keyed by column name, for callers that look values
+// up by name. Of several columns with the same name, the first one is kept.
+func (r *ResultSet) Maps() []map[string]interface{} {
+	if r.Len() == 0 {
+		return nil
+	}
+	maps := make([]map[string]interface{}, len(r.Rows))
+	for i, row := range r.Rows {
+		m := make(map[string]interface{}, len(r.Columns))
+		for j, column := range r.Columns {
+			if _, exists := m[column.Name]; !exists {
+				m[column.Name] = row[j]
+			}
+		}
+		maps[i] = m
+	}
+	return maps
+}
+
+// scanRows reads and closes rows.
+func (c *Client) scanRows(ctx context.Context, rows *sql.Rows) (*ResultSet, error) {
+	cursor, err := newRows(ctx, rows, &c.binary)
+	if err != nil {
+		return nil, err
+	}
+	return collect(cursor)
+}
+
+// collect reads the rest of a cursor into a ResultSet, with the warnings of
+// the query, and closes it.
+func collect(rows *Rows) (*ResultSet, error) {
+	defer rows.Close()
+	result, err := readAll(rows)
+	if err != nil {
+		return nil, err
+	}
+	if result.Warnings, err = rows.Warnings(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// readAll reads the rest of the cursor's current result set.
+func readAll(rows *Rows) (*ResultSet, error) {
+	result := &ResultSet{Columns: rows.Columns(), Rows: [][]interface{}{}}
+	for rows.Next() {
+		result.Rows = append(result.Rows, rows.Row())
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func newColumn(t *sql.ColumnType) Column {
+	column := Column{Name: t.Name(), DatabaseType: t.DatabaseTypeName()}
+	if nullable, ok := t.Nullable(); ok {
+		column.Nullable = &nullable
+	}
+	if length, ok := t.Length(); ok {
+		column.Length = length
+	}
+	if precision, scale, ok := t.DecimalSize(); ok {
+		column.Precision, column.Scale = precision, scale
+	}
+	return column
+}
+
+// convertValue types a scanned value by its column type. The text protocol
+// returns every non-NULL value as bytes; the binary protocol of prepared
+// statements already returns numbers, which are kept.
+func convertValue(databaseType string, v interface{}, options *BinaryOptions) interface{} {
+	b, ok := v.([]byte)
+	if !ok {
+		return v
+	}
+	if value, ok := convertBinary(databaseType, b, options); ok {
+		return value
+	}
+	if !utf8.Valid(b) {
+		return Binary{Data: b, options: options}
+	}
+	s := string(b)
+
+	switch strings.TrimPrefix(databaseType, "UNSIGNED ") {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "YEAR":
+		if strings.HasPrefix(databaseType, "UNSIGNED ") {
+			if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+				return n
+			}
+		} else if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n
+		}
+	case "FLOAT", "DOUBLE":
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	case "DECIMAL":
+		if _, err := strconv.ParseFloat(s, 64); err == nil {
+			return json.Number(s)
+		}
+	}
+	return s
+}
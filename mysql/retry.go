@@ -0,0 +1,141 @@
+package mysql
+
+import (
+	"context"
+	sqldriver "database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"syscall"
+	"time"
+
+	driver "github.com/go-sql-driver/mysql"
+)
+
+// RetryPolicy controls how calls that failed with a transient error, such
+// as a deadlock or a lost connection, are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts including the first; 0 and 1
+	// disable retries
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled for every further
+	// one, with random jitter so deadlocked sessions do not collide again
+	Backoff time.Duration
+}
+
+// transientErrors are the MySQL error numbers worth retrying:
+// ER_LOCK_DEADLOCK, ER_LOCK_WAIT_TIMEOUT, CR_SERVER_GONE_ERROR and
+// CR_SERVER_LOST.
+var transientErrors = map[uint16]bool{1213: true, 1205: true, 2006: true, 2013: true}
+
+// isTransient reports whether err may succeed when the call is repeated.
+// Errors of the context itself are not transient.
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var mysqlErr *driver.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return transientErrors[mysqlErr.Number]
+	}
+	return errors.Is(err, driver.ErrInvalidConn) || errors.Is(err, sqldriver.ErrBadConn) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
+
+// isServerError reports whether the server answered with err, so the
+// statement it answered for was not applied.
+func isServerError(err error) bool {
+	var mysqlErr *driver.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number < 2000
+}
+
+// permanentError marks an error that is not retried even if it is
+// transient, because the failed attempt may already have changed data.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// permanent keeps err from being retried.
+func permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// withRetry runs attempt until it succeeds, fails with an error that is not
+// transient, or runs out of attempts or time. attempt must be safe to
+// repeat after any error it does not mark permanent.
+func (c *Client) withRetry(ctx context.Context, attempt func() error) error {
+	for n := 1; ; n++ {
+		err := attempt()
+		var p *permanentError
+		if errors.As(err, &p) {
+			return c.sessionError(ctx, p.err)
+		}
+		if err == nil || !isTransient(err) || ctx.Err() != nil {
+			return c.sessionError(ctx, err)
+		}
+		// A session cannot move to another connection, so only errors the
+		// server answered with are retried
+		if c.session != nil && !isServerError(err) {
+			return c.sessionError(ctx, err)
+		}
+		if n >= c.retry.MaxAttempts {
+			if n > 1 {
+				return fmt.Errorf("%w (gave up after %d attempts)", err, n)
+			}
+			return err
+		}
+
+		recordRetry(ctx, err)
+		delay := c.retry.Backoff << (n - 1)
+		if delay > 0 {
+			delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+type retryKey struct{}
+
+type retryLog struct {
+	mu     sync.Mutex
+	errors []error
+}
+
+// TrackRetries returns a context under which the client records the
+// transient errors it retried, for Retries to report.
+func TrackRetries(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryKey{}, &retryLog{})
+}
+
+// Retries returns the transient errors that calls under ctx were retried
+// after, in order.
+func Retries(ctx context.Context) []error {
+	log, ok := ctx.Value(retryKey{}).(*retryLog)
+	if !ok {
+		return nil
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	return append([]error(nil), log.errors...)
+}
+
+func recordRetry(ctx context.Context, err error) {
+	if log, ok := ctx.Value(retryKey{}).(*retryLog); ok {
+		log.mu.Lock()
+		log.errors = append(log.errors, err)
+		log.mu.Unlock()
+	}
+}
@@ -0,0 +1,97 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/koh-yoshimoto/mysql-mcp-server/sqlparse"
+)
+
+// Stored object types, as used by ListObjects and ShowCreate.
+const (
+	ObjectProcedure = "PROCEDURE"
+	ObjectFunction  = "FUNCTION"
+	ObjectTrigger   = "TRIGGER"
+	ObjectEvent     = "EVENT"
+)
+
+// objectListQueries list the stored objects of each type in a schema, or in
+// the current database when the argument is NULL.
+var objectListQueries = map[string]string{
+	ObjectProcedure: `SELECT ROUTINE_NAME AS name, SECURITY_TYPE AS security, DEFINER AS definer,
+		CREATED AS created, LAST_ALTERED AS last_altered, ROUTINE_COMMENT AS comment
+		FROM information_schema.ROUTINES
+		WHERE ROUTINE_SCHEMA = COALESCE(?, DATABASE()) AND ROUTINE_TYPE = 'PROCEDURE'
+		ORDER BY ROUTINE_NAME`,
+	ObjectFunction: `SELECT ROUTINE_NAME AS name, DTD_IDENTIFIER AS returns, IS_DETERMINISTIC AS deterministic,
+		SECURITY_TYPE AS security, DEFINER AS definer, CREATED AS created, LAST_ALTERED AS last_altered,
+		ROUTINE_COMMENT AS comment
+		FROM information_schema.ROUTINES
+		WHERE ROUTINE_SCHEMA = COALESCE(?, DATABASE()) AND ROUTINE_TYPE = 'FUNCTION'
+		ORDER BY ROUTINE_NAME`,
+	ObjectTrigger: `SELECT TRIGGER_NAME AS name, EVENT_OBJECT_TABLE AS ` + "`table`" + `,
+		ACTION_TIMING AS timing, EVENT_MANIPULATION AS event, ACTION_ORDER AS ` + "`order`" + `,
+		DEFINER AS definer, CREATED AS created
+		FROM information_schema.TRIGGERS
+		WHERE TRIGGER_SCHEMA = COALESCE(?, DATABASE())
+		ORDER BY EVENT_OBJECT_TABLE, ACTION_TIMING, EVENT_MANIPULATION, ACTION_ORDER`,
+	ObjectEvent: `SELECT EVENT_NAME AS name, STATUS AS status, EVENT_TYPE AS type, EXECUTE_AT AS execute_at,
+		INTERVAL_VALUE AS interval_value, INTERVAL_FIELD AS interval_field, STARTS AS starts, ENDS AS ends,
+		LAST_EXECUTED AS last_executed, DEFINER AS definer, EVENT_COMMENT AS comment
+		FROM information_schema.EVENTS
+		WHERE EVENT_SCHEMA = COALESCE(?, DATABASE())
+		ORDER BY EVENT_NAME`,
+}
+
+// showCreateColumns name the column of SHOW CREATE holding the statement.
+var showCreateColumns = map[string]string{
+	ObjectProcedure: "Create Procedure",
+	ObjectFunction:  "Create Function",
+	ObjectTrigger:   "SQL Original Statement",
+	ObjectEvent:     "Create Event",
+}
+
+// ListObjects lists the stored procedures, functions, triggers or events of
+// schema, or of the current database when schema is empty.
+func (c *Client) ListObjects(ctx context.Context, objectType, schema string) (*ResultSet, error) {
+	query, ok := objectListQueries[objectType]
+	if !ok {
+		return nil, fmt.Errorf("unknown object type %q", objectType)
+	}
+
+	var schemaArg interface{}
+	if schema != "" {
+		schemaArg = schema
+	}
+	results, err := c.Query(ctx, query, schemaArg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %ss: %w", strings.ToLower(objectType), err)
+	}
+	return results, nil
+}
+
+// ShowCreate returns the statement that creates a stored procedure,
+// function, trigger or event, from SHOW CREATE. The name is looked up in
+// schema, or in the current database when schema is empty.
+func (c *Client) ShowCreate(ctx context.Context, objectType, schema, name string) (string, error) {
+	column, ok := showCreateColumns[objectType]
+	if !ok {
+		return "", fmt.Errorf("unknown object type %q", objectType)
+	}
+
+	object := sqlparse.QuoteIdent(name)
+	if schema != "" {
+		object = sqlparse.QuoteIdent(schema) + "." + object
+	}
+	results, err := c.Query(ctx, "SHOW CREATE "+objectType+" "+object)
+	if err != nil {
+		return "", err
+	}
+
+	definition, _ := results.Get(0, column).(string)
+	if definition == "" {
+		return "", fmt.Errorf("the definition of %s %s is not visible to this account", strings.ToLower(objectType), name)
+	}
+	return definition, nil
+}
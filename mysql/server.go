@@ -0,0 +1,222 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Server flavors, as reported by ServerInfo.
+const (
+	FlavorMySQL   = "mysql"
+	FlavorMariaDB = "mariadb"
+)
+
+// Explain formats, as accepted by ExplainStatement.
+const (
+	ExplainTraditional = "traditional"
+	ExplainJSON        = "json"
+	ExplainTree        = "tree"
+)
+
+// Ways of passing a statement's deadline to the server, as in
+// Capabilities.StatementTimeout.
+const (
+	// TimeoutHint adds a MAX_EXECUTION_TIME optimizer hint to SELECT
+	TimeoutHint = "MAX_EXECUTION_TIME"
+	// TimeoutSetStatement prefixes SET STATEMENT max_statement_time=N FOR
+	TimeoutSetStatement = "max_statement_time"
+)
+
+// versionRegex finds the version number in the VERSION() string, skipping the
+// 5.5.5- prefix older MariaDB releases report for replication compatibility.
+var versionRegex = regexp.MustCompile(`^(?:5\.5\.5-)?(\d+)\.(\d+)\.(\d+)`)
+
+// statementTimeRegex locates statements that max_statement_time can limit,
+// behind any leading comments.
+var statementTimeRegex = regexp.MustCompile(`(?is)^\s*(?:(?:--[^\n]*\n|/\*.*?\*/)\s*)*(?:SELECT|WITH|EXPLAIN|ANALYZE)\b`)
+
+// ServerInfo identifies the server a client is connected to.
+type ServerInfo struct {
+	Flavor string `json:"flavor"`
+	// Version is the full version string from VERSION()
+	Version string `json:"version"`
+	Major   int    `json:"-"`
+	Minor   int    `json:"-"`
+	Patch   int    `json:"-"`
+}
+
+// ParseServerVersion identifies the server from the VERSION() string, such as
+// 8.0.36 or 10.6.12-MariaDB-log. Unparsable versions are taken as MySQL
+// 0.0.0, which supports none of the optional features.
+func ParseServerVersion(version string) ServerInfo {
+	info := ServerInfo{Flavor: FlavorMySQL, Version: version}
+	if strings.Contains(strings.ToLower(version), "mariadb") {
+		info.Flavor = FlavorMariaDB
+	}
+	if m := versionRegex.FindStringSubmatch(version); m != nil {
+		info.Major, _ = strconv.Atoi(m[1])
+		info.Minor, _ = strconv.Atoi(m[2])
+		info.Patch, _ = strconv.Atoi(m[3])
+	}
+	return info
+}
+
+func (s ServerInfo) String() string {
+	name := "MySQL"
+	if s.Flavor == FlavorMariaDB {
+		name = "MariaDB"
+	}
+	return fmt.Sprintf("%s %d.%d.%d", name, s.Major, s.Minor, s.Patch)
+}
+
+// AtLeast reports whether the server version is major.minor.patch or later.
+func (s ServerInfo) AtLeast(major, minor, patch int) bool {
+	if s.Major != major {
+		return s.Major > major
+	}
+	if s.Minor != minor {
+		return s.Minor > minor
+	}
+	return s.Patch >= patch
+}
+
+// Capabilities are the optional features of a server that tools adapt to.
+type Capabilities struct {
+	// ExplainAnalyze is the statement prefix that runs a query and reports
+	// its actual statistics: EXPLAIN ANALYZE on MySQL 8.0.18 and later,
+	// ANALYZE on MariaDB 10.1 and later. It is empty if there is none.
+	ExplainAnalyze string `json:"explain_analyze,omitempty"`
+	// ExplainFormats are the EXPLAIN formats the server accepts
+	ExplainFormats []string `json:"explain_formats"`
+	// AnalyzeFormats are the formats ExplainAnalyze accepts
+	AnalyzeFormats []string `json:"analyze_formats,omitempty"`
+	// StatementTimeout is how a deadline is passed to the server, or empty
+	// if only the client enforces it
+	StatementTimeout string `json:"statement_timeout,omitempty"`
+	// InstantDDL reports whether ALTER TABLE accepts ALGORITHM=INSTANT
+	InstantDDL bool `json:"instant_ddl"`
+	// InstantRowVersions is how many row versions INSTANT ADD and DROP
+	// COLUMN may create before the table must be rebuilt, as counted in
+	// INNODB_TABLES.TOTAL_ROW_VERSIONS since MySQL 8.0.29. It is 0 where
+	// there is no such limit.
+	InstantRowVersions int64 `json:"instant_row_versions,omitempty"`
+}
+
+// Capabilities returns what the server supports.
+func (s ServerInfo) Capabilities() Capabilities {
+	c := Capabilities{ExplainFormats: []string{ExplainTraditional}}
+	if s.Flavor == FlavorMariaDB {
+		if s.AtLeast(10, 1, 0) {
+			c.ExplainAnalyze = "ANALYZE"
+			c.ExplainFormats = append(c.ExplainFormats, ExplainJSON)
+			c.AnalyzeFormats = []string{ExplainTraditional, ExplainJSON}
+		}
+		if s.AtLeast(10, 1, 1) {
+			c.StatementTimeout = TimeoutSetStatement
+		}
+		c.InstantDDL = s.AtLeast(10, 3, 2)
+		return c
+	}
+
+	if s.AtLeast(5, 6, 5) {
+		c.ExplainFormats = append(c.ExplainFormats, ExplainJSON)
+	}
+	if s.AtLeast(8, 0, 16) {
+		c.ExplainFormats = append(c.ExplainFormats, ExplainTree)
+	}
+	if s.AtLeast(8, 0, 18) {
+		c.ExplainAnalyze = "EXPLAIN ANALYZE"
+		c.AnalyzeFormats = []string{ExplainTree}
+	}
+	if s.AtLeast(5, 7, 8) {
+		c.StatementTimeout = TimeoutHint
+	}
+	c.InstantDDL = s.AtLeast(8, 0, 12)
+	switch {
+	case s.AtLeast(9, 1, 0):
+		c.InstantRowVersions = 255
+	case s.AtLeast(8, 0, 29):
+		c.InstantRowVersions = 64
+	}
+	return c
+}
+
+// HasExplainFormat reports whether EXPLAIN accepts format.
+func (c Capabilities) HasExplainFormat(format string) bool {
+	return contains(c.ExplainFormats, format)
+}
+
+// ExplainStatement returns the prefix that explains a query in the given
+// format (ExplainTraditional when empty), or that analyzes it, or an error
+// naming what the server lacks.
+func (s ServerInfo) ExplainStatement(analyze bool, format string) (string, error) {
+	c := s.Capabilities()
+	prefix, formats := "EXPLAIN", c.ExplainFormats
+	if analyze {
+		if c.ExplainAnalyze == "" {
+			return "", fmt.Errorf("%s does not support analyzing queries; EXPLAIN ANALYZE needs MySQL 8.0.18 or MariaDB 10.1", s)
+		}
+		prefix, formats = c.ExplainAnalyze, c.AnalyzeFormats
+	}
+
+	if format == "" {
+		// MySQL's EXPLAIN ANALYZE only has the tree format
+		format = formats[0]
+	}
+	if !contains(formats, format) {
+		return "", fmt.Errorf("%s does not support %s format %s; use one of %s",
+			s, strings.ToLower(prefix), format, strings.Join(formats, ", "))
+	}
+	if format == ExplainTraditional || (analyze && s.Flavor == FlavorMySQL) {
+		return prefix, nil
+	}
+	return prefix + " FORMAT=" + strings.ToUpper(format), nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Server returns the server the client is connected to, as detected when it
+// connected.
+func (c *Client) Server() ServerInfo {
+	return c.server
+}
+
+// limitExecutionTime passes the deadline of ctx to the server for read
+// statements, in the way the server supports.
+func (c *Client) limitExecutionTime(ctx context.Context, query string) string {
+	switch c.server.Capabilities().StatementTimeout {
+	case TimeoutHint:
+		return withMaxExecutionTime(ctx, query)
+	case TimeoutSetStatement:
+		return withMaxStatementTime(ctx, query)
+	}
+	return query
+}
+
+// withMaxStatementTime prefixes SELECT, EXPLAIN and ANALYZE statements with
+// a MariaDB SET STATEMENT clause limiting them to the remaining time on ctx.
+// Statements that already set max_statement_time and contexts without a
+// deadline are left untouched.
+func withMaxStatementTime(ctx context.Context, query string) string {
+	deadline, ok := ctx.Deadline()
+	if !ok || strings.Contains(strings.ToLower(query), "max_statement_time") || !statementTimeRegex.MatchString(query) {
+		return query
+	}
+
+	seconds := time.Until(deadline).Seconds()
+	if seconds < 0.001 {
+		seconds = 0.001
+	}
+	return fmt.Sprintf("SET STATEMENT max_statement_time=%.3f FOR %s", seconds, query)
+}
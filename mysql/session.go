@@ -0,0 +1,163 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"errors"
+	"fmt"
+)
+
+// ErrSessionLost is returned when the connection of a session was closed,
+// which discards its session state.
+var ErrSessionLost = errors.New("the session's connection was lost, and its variables, settings and temporary tables with it")
+
+// Session is a connection reserved for one client session, so that session
+// state, such as user variables, SET SESSION settings, temporary tables and
+// the default database chosen with USE, carries over between statements.
+// A Session is not safe for concurrent use.
+type Session struct {
+	conn *sql.Conn
+	id   int64
+	lost bool
+}
+
+// OpenSession takes a connection out of the client's pool for a session. It
+// is not returned to the pool, as its session state would leak to the
+// pool's other users; Close closes it instead.
+func (c *Client) OpenSession(ctx context.Context) (*Session, error) {
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", timeoutError(ctx, err))
+	}
+
+	s := &Session{conn: conn}
+	if err := conn.QueryRowContext(ctx, "SELECT CONNECTION_ID()").Scan(&s.id); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to identify the session's connection: %w", timeoutError(ctx, err))
+	}
+	return s, nil
+}
+
+// ID returns the server's id for the session's connection, as shown by
+// CONNECTION_ID() and in the process list.
+func (s *Session) ID() int64 {
+	return s.id
+}
+
+// Lost reports whether the session's connection was lost, such as by a
+// network failure or by a statement cut off at its deadline.
+func (s *Session) Lost() bool {
+	return s.lost
+}
+
+// Close closes the session's connection.
+func (s *Session) Close() error {
+	// Failing Raw with ErrBadConn makes database/sql discard the connection
+	// instead of returning it to the pool
+	err := s.conn.Raw(func(interface{}) error { return sqldriver.ErrBadConn })
+	if errors.Is(err, sqldriver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return nil
+	}
+	return err
+}
+
+// InSession returns a copy of the client that runs every statement on the
+// session's connection instead of its pool. It keeps the client's other
+// settings, so a read-only client stays read-only.
+func (c *Client) InSession(s *Session) *Client {
+	pinned := *c
+	pinned.session = s
+	return &pinned
+}
+
+// sessionError marks the session lost when err came from its connection
+// rather than from the server, or from a statement cut off at the deadline
+// of ctx, which the driver stops by closing the connection.
+func (c *Client) sessionError(ctx context.Context, err error) error {
+	if c.session == nil || err == nil || isServerError(err) {
+		return err
+	}
+	if ctx.Err() != nil || errors.Is(err, sql.ErrConnDone) || isTransient(err) {
+		c.session.lost = true
+		return fmt.Errorf("%w: %w", ErrSessionLost, err)
+	}
+	return err
+}
+
+// dbHandle is implemented by *sql.DB and *sql.Conn.
+type dbHandle interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// handle returns where the client runs single statements: the session's
+// connection, or the pool.
+func (c *Client) handle() dbHandle {
+	if c.session != nil {
+		return c.session.conn
+	}
+	return c.db
+}
+
+// conn returns a connection for statements that need one, with the function
+// that gives it back: the session's connection, which stays open, or one from
+// the pool.
+func (c *Client) conn(ctx context.Context) (*sql.Conn, func(), error) {
+	if c.session != nil {
+		if c.session.lost {
+			return nil, nil, ErrSessionLost
+		}
+		return c.session.conn, func() {}, nil
+	}
+
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get connection: %w", timeoutError(ctx, err))
+	}
+	return conn, func() { conn.Close() }, nil
+}
+
+// ExecSession runs a statement that changes the state of the client's
+// session, such as SET, USE or CREATE TEMPORARY TABLE, on its connection.
+// With readOnly it runs in a READ ONLY transaction, so the server rejects
+// any data change made by a stored function the statement calls; session
+// state is not transactional and stays changed. It is not retried.
+func (c *Client) ExecSession(ctx context.Context, query string, readOnly bool, args ...interface{}) (*ExecResult, error) {
+	if c.session == nil {
+		return nil, errors.New("no session is open")
+	}
+	conn, release, err := c.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if !readOnly {
+		result, err := conn.ExecContext(ctx, query, args...)
+		if err != nil {
+			return nil, c.sessionError(ctx, fmt.Errorf("execution failed: %w", timeoutError(ctx, err)))
+		}
+		// The statement is applied, so failing to read its warnings does
+		// not fail it
+		execResult := &ExecResult{Result: result}
+		execResult.Warnings, execResult.WarningsErr = showWarnings(ctx, conn)
+		return execResult, nil
+	}
+
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, c.sessionError(ctx, fmt.Errorf("failed to begin read-only transaction: %w", timeoutError(ctx, err)))
+	}
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		tx.Rollback()
+		return nil, c.sessionError(ctx, fmt.Errorf("execution failed: %w", timeoutError(ctx, err)))
+	}
+	execResult := &ExecResult{Result: result}
+	execResult.Warnings, execResult.WarningsErr = showWarnings(ctx, tx)
+	if err := tx.Commit(); err != nil {
+		return nil, c.sessionError(ctx, fmt.Errorf("failed to commit: %w", timeoutError(ctx, err)))
+	}
+	return execResult, nil
+}
@@ -0,0 +1,250 @@
+package mysql
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/koh-yoshimoto/mysql-mcp-server/sqlparse"
+)
+
+// ShadowSchema is the scratch schema DDL statements are tried in.
+const ShadowSchema = "_mcp_shadow"
+
+var autoIncrementOption = regexp.MustCompile(` AUTO_INCREMENT=\d+`)
+
+// ShadowResult is the outcome of applying DDL to a shadow table.
+type ShadowResult struct {
+	// Before and After are SHOW CREATE TABLE of the shadow table, written
+	// with the original table name. Before is empty for CREATE TABLE.
+	Before string
+	After  string
+	// Err is the error the statement failed with on the shadow table
+	Err error
+}
+
+// ShadowDDL applies a DDL statement to a shadow table in ShadowSchema. When
+// like is set, the shadow table starts as an empty copy of it (CREATE TABLE
+// ... LIKE, which copies the structure but no data and no foreign keys);
+// otherwise the statement is expected to create the table. build returns the
+// statement rewritten to work on the given shadow table name. The shadow
+// table is always dropped again.
+func (c *Client) ShadowDDL(ctx context.Context, like, table string, build func(shadow string) string) (*ShadowResult, error) {
+	conn, release, err := c.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if _, err := conn.ExecContext(ctx, "CREATE DATABASE IF NOT EXISTS "+sqlparse.QuoteIdent(ShadowSchema)); err != nil {
+		return nil, fmt.Errorf("failed to create shadow schema %s: %w", ShadowSchema, timeoutError(ctx, err))
+	}
+
+	// A unique name keeps concurrent dry runs apart
+	name := shadowName(table)
+	shadow := sqlparse.QuoteIdent(ShadowSchema) + "." + sqlparse.QuoteIdent(name)
+	defer func() {
+		// Clean up even when ctx has expired
+		cleanup, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		conn.ExecContext(cleanup, "DROP TABLE IF EXISTS "+shadow)
+	}()
+
+	result := &ShadowResult{}
+	if like != "" {
+		if _, err := conn.ExecContext(ctx, fmt.Sprintf("CREATE TABLE %s LIKE %s", shadow, like)); err != nil {
+			return nil, fmt.Errorf("failed to copy the structure of %s: %w", like, timeoutError(ctx, err))
+		}
+		if result.Before, err = showCreateTable(ctx, conn, shadow, name, table); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := conn.ExecContext(ctx, build(shadow)); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("shadow statement failed: %w", timeoutError(ctx, err))
+		}
+		result.Err = err
+		return result, nil
+	}
+
+	if result.After, err = showCreateTable(ctx, conn, shadow, name, table); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// showCreateTable returns the definition of the shadow table under the
+// original table name, without the AUTO_INCREMENT counter.
+func showCreateTable(ctx context.Context, q queryer, shadow, name, table string) (string, error) {
+	rows, err := q.QueryContext(ctx, "SHOW CREATE TABLE "+shadow)
+	if err != nil {
+		return "", fmt.Errorf("failed to read shadow table definition: %w", timeoutError(ctx, err))
+	}
+	defer rows.Close()
+
+	var tableName, definition string
+	if rows.Next() {
+		if err := rows.Scan(&tableName, &definition); err != nil {
+			return "", fmt.Errorf("failed to read shadow table definition: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("failed to read shadow table definition: %w", timeoutError(ctx, err))
+	}
+
+	definition = strings.Replace(definition, sqlparse.QuoteIdent(name), sqlparse.QuoteIdent(table), 1)
+	return autoIncrementOption.ReplaceAllString(definition, ""), nil
+}
+
+// TableExists reports whether a table or view exists in schema, or in the
+// current database when schema is empty.
+func (c *Client) TableExists(ctx context.Context, schema, table string) (bool, error) {
+	var schemaArg interface{}
+	if schema != "" {
+		schemaArg = schema
+	}
+
+	var count int
+	err := c.handle().QueryRowContext(ctx, `SELECT COUNT(*) FROM information_schema.TABLES
+		WHERE TABLE_SCHEMA = COALESCE(?, DATABASE()) AND TABLE_NAME = ?`, schemaArg, table).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up table: %w", timeoutError(ctx, err))
+	}
+	return count > 0, nil
+}
+
+// TableSize is the storage footprint of a table according to
+// information_schema, which InnoDB only estimates.
+type TableSize struct {
+	Engine      string
+	Rows        int64
+	DataLength  int64
+	IndexLength int64
+}
+
+// GetTableSize looks up the size of a table in schema, or in the current
+// database when schema is empty.
+func (c *Client) GetTableSize(ctx context.Context, schema, table string) (*TableSize, error) {
+	var schemaArg interface{}
+	if schema != "" {
+		schemaArg = schema
+	}
+
+	size := &TableSize{}
+	err := c.handle().QueryRowContext(ctx, `SELECT COALESCE(ENGINE, ''), COALESCE(TABLE_ROWS, 0),
+		COALESCE(DATA_LENGTH, 0), COALESCE(INDEX_LENGTH, 0)
+		FROM information_schema.TABLES
+		WHERE TABLE_SCHEMA = COALESCE(?, DATABASE()) AND TABLE_NAME = ?`, schemaArg, table).
+		Scan(&size.Engine, &size.Rows, &size.DataLength, &size.IndexLength)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get table size: %w", timeoutError(ctx, err))
+	}
+	return size, nil
+}
+
+// GetRowVersions returns how many row versions INSTANT column changes have
+// created for a table in schema, or in the current database when schema is
+// empty, from INNODB_TABLES.TOTAL_ROW_VERSIONS (MySQL 8.0.29 and later).
+func (c *Client) GetRowVersions(ctx context.Context, schema, table string) (int64, error) {
+	var schemaArg interface{}
+	if schema != "" {
+		schemaArg = schema
+	}
+
+	var versions int64
+	err := c.handle().QueryRowContext(ctx, `SELECT TOTAL_ROW_VERSIONS FROM information_schema.INNODB_TABLES
+		WHERE NAME = CONCAT(COALESCE(?, DATABASE()), '/', ?)`, schemaArg, table).Scan(&versions)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get row versions: %w", timeoutError(ctx, err))
+	}
+	return versions, nil
+}
+
+// Dependent is an object that refers to a table.
+type Dependent struct {
+	Type   string // FOREIGN KEY, VIEW, TRIGGER, PROCEDURE or FUNCTION
+	Schema string
+	Name   string
+	Detail string
+}
+
+// GetDependents lists the foreign keys, views, triggers and routines that
+// refer to a table in schema, or in the current database when schema is
+// empty. Views and routines are matched by name in their definitions, so
+// they may include false positives.
+func (c *Client) GetDependents(ctx context.Context, schema, table string) ([]Dependent, error) {
+	var schemaArg interface{}
+	if schema != "" {
+		schemaArg = schema
+	}
+	pattern := "%" + escapeLike(table) + "%"
+
+	queries := []struct {
+		kind  string
+		query string
+		args  []interface{}
+	}{
+		{"FOREIGN KEY", `SELECT TABLE_SCHEMA, CONSTRAINT_NAME,
+			CONCAT(TABLE_NAME, '(', GROUP_CONCAT(COLUMN_NAME ORDER BY ORDINAL_POSITION), ')')
+			FROM information_schema.KEY_COLUMN_USAGE
+			WHERE REFERENCED_TABLE_SCHEMA = COALESCE(?, DATABASE()) AND REFERENCED_TABLE_NAME = ?
+			GROUP BY TABLE_SCHEMA, TABLE_NAME, CONSTRAINT_NAME`, []interface{}{schemaArg, table}},
+		{"VIEW", `SELECT TABLE_SCHEMA, TABLE_NAME, ''
+			FROM information_schema.VIEWS
+			WHERE VIEW_DEFINITION LIKE ?`, []interface{}{pattern}},
+		{"TRIGGER", `SELECT TRIGGER_SCHEMA, TRIGGER_NAME, CONCAT(ACTION_TIMING, ' ', EVENT_MANIPULATION)
+			FROM information_schema.TRIGGERS
+			WHERE EVENT_OBJECT_SCHEMA = COALESCE(?, DATABASE()) AND EVENT_OBJECT_TABLE = ?`, []interface{}{schemaArg, table}},
+		{"ROUTINE", `SELECT ROUTINE_SCHEMA, ROUTINE_NAME, ROUTINE_TYPE
+			FROM information_schema.ROUTINES
+			WHERE ROUTINE_DEFINITION LIKE ?`, []interface{}{pattern}},
+	}
+
+	var dependents []Dependent
+	for _, q := range queries {
+		rows, err := c.handle().QueryContext(ctx, q.query, q.args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up dependent objects: %w", timeoutError(ctx, err))
+		}
+		for rows.Next() {
+			dependent := Dependent{Type: q.kind}
+			if err := rows.Scan(&dependent.Schema, &dependent.Name, &dependent.Detail); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan dependent object: %w", err)
+			}
+			if q.kind == "ROUTINE" {
+				dependent.Type, dependent.Detail = dependent.Detail, ""
+			}
+			dependents = append(dependents, dependent)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("row iteration error: %w", timeoutError(ctx, err))
+		}
+	}
+
+	return dependents, nil
+}
+
+func shadowName(table string) string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	suffix := "_" + hex.EncodeToString(b)
+	// Identifiers are limited to 64 characters, not bytes
+	if runes := []rune(table); len(runes) > 64-len(suffix) {
+		table = string(runes[:64-len(suffix)])
+	}
+	return table + suffix
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,165 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Rows is a cursor over the result of QueryStream. Rows are read from the
+// connection one at a time as Next is called, so results of any size are
+// processed in constant memory.
+//
+// Close reads and discards the rows that were not consumed; to stop early on
+// a large result, cancel the context passed to QueryStream first.
+type Rows struct {
+	ctx  context.Context
+	rows *sql.Rows
+	// q is the connection or transaction the query ran on, for Warnings
+	q       queryer
+	release func()
+	tx      *sql.Tx
+	columns []Column
+	values  []interface{}
+	ptrs    []interface{}
+	row     []interface{}
+	binary  *BinaryOptions
+	err     error
+}
+
+// QueryStream runs a read statement like Query, but returns a cursor instead
+// of reading the whole result. The caller must Close it. The query keeps its
+// connection until then, so its warnings can be read. Transient errors are
+// retried until the first row is read; later ones end the iteration.
+func (c *Client) QueryStream(ctx context.Context, query string, args ...interface{}) (*Rows, error) {
+	var rows *Rows
+	err := c.withRetry(ctx, func() (err error) {
+		rows, err = c.queryStream(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+// queryStream is one attempt of QueryStream.
+func (c *Client) queryStream(ctx context.Context, query string, args ...interface{}) (*Rows, error) {
+	conn, release, err := c.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var q queryer = conn
+	var tx *sql.Tx
+	if c.readOnly {
+		tx, err = conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+		if err != nil {
+			release()
+			return nil, fmt.Errorf("failed to begin read-only transaction: %w", timeoutError(ctx, err))
+		}
+		q = tx
+	}
+
+	rows, err := q.QueryContext(ctx, c.limitExecutionTime(ctx, query), args...)
+	if err != nil {
+		if tx != nil {
+			tx.Rollback()
+		}
+		release()
+		return nil, fmt.Errorf("query failed: %w", timeoutError(ctx, err))
+	}
+	r, err := newRows(ctx, rows, &c.binary)
+	if err != nil {
+		if tx != nil {
+			tx.Rollback()
+		}
+		release()
+		return nil, err
+	}
+	r.q, r.release, r.tx = q, release, tx
+	return r, nil
+}
+
+func newRows(ctx context.Context, rows *sql.Rows, binary *BinaryOptions) (*Rows, error) {
+	r := &Rows{ctx: ctx, rows: rows, binary: binary}
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		r.Close()
+		return nil, fmt.Errorf("failed to get columns: %w", err)
+	}
+
+	r.columns = make([]Column, len(types))
+	for i, t := range types {
+		r.columns[i] = newColumn(t)
+	}
+	r.values = make([]interface{}, len(types))
+	r.ptrs = make([]interface{}, len(types))
+	for i := range r.values {
+		r.ptrs[i] = &r.values[i]
+	}
+	return r, nil
+}
+
+// Columns describes the columns of the result, in order.
+func (r *Rows) Columns() []Column {
+	return r.columns
+}
+
+// Next reads the next row, returning false at the end of the result or on
+// an error, which Err then reports.
+func (r *Rows) Next() bool {
+	if r.err != nil {
+		return false
+	}
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			r.err = fmt.Errorf("row iteration error: %w", timeoutError(r.ctx, err))
+		}
+		return false
+	}
+	if err := r.rows.Scan(r.ptrs...); err != nil {
+		r.err = fmt.Errorf("failed to scan row: %w", err)
+		return false
+	}
+
+	r.row = make([]interface{}, len(r.values))
+	for i, v := range r.values {
+		r.row[i] = convertValue(r.columns[i].DatabaseType, v, r.binary)
+	}
+	return true
+}
+
+// Row returns the current row, typed as in ResultSet. The slice is not reused
+// by later calls to Next, so it may be kept.
+func (r *Rows) Row() []interface{} {
+	return r.row
+}
+
+// Err returns the error that ended the iteration, if any.
+func (r *Rows) Err() error {
+	return r.err
+}
+
+// Warnings returns the warnings of the query once all its rows were read.
+// They are read from the query's connection, so Warnings must be called
+// before Close. Cursors that do not own their connection have none.
+func (r *Rows) Warnings() ([]Warning, error) {
+	if r.q == nil {
+		return nil, nil
+	}
+	if err := r.rows.Close(); err != nil {
+		return nil, err
+	}
+	return showWarnings(r.ctx, r.q)
+}
+
+// Close releases the cursor and its connection.
+func (r *Rows) Close() error {
+	err := r.rows.Close()
+	if r.tx != nil {
+		r.tx.Rollback()
+	}
+	if r.release != nil {
+		r.release()
+	}
+	return err
+}
@@ -0,0 +1,84 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Warning is a note, warning or error that MySQL reported for a statement,
+// such as data truncated on insert or an implicit type conversion.
+type Warning struct {
+	Level   string `json:"level"`
+	Code    int64  `json:"code"`
+	Message string `json:"message"`
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s %d: %s", w.Level, w.Code, w.Message)
+}
+
+// ExecResult is the result of Execute, with the warnings the statement
+// produced.
+type ExecResult struct {
+	sql.Result
+	Warnings []Warning
+	// WarningsErr is why the warnings of a statement that was already
+	// applied could not be read
+	WarningsErr error
+	// AutoIncrementIncrement is @@auto_increment_increment of the connection
+	// the statement ran on, the step between the ids it generated, or 0 when
+	// it generated none or the setting could not be read
+	AutoIncrementIncrement int64
+}
+
+// showWarnings returns the warnings of the last statement run on q, which
+// must be the connection or transaction the statement ran on. The count is
+// read first, so SHOW WARNINGS only runs when there are any; neither is a
+// statement that clears them.
+func showWarnings(ctx context.Context, q queryer) ([]Warning, error) {
+	count, err := warningCount(ctx, q)
+	if err != nil || count == 0 {
+		return nil, err
+	}
+
+	rows, err := q.QueryContext(ctx, "SHOW WARNINGS")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read warnings: %w", timeoutError(ctx, err))
+	}
+	defer rows.Close()
+
+	var warnings []Warning
+	for rows.Next() {
+		var w Warning
+		if err := rows.Scan(&w.Level, &w.Code, &w.Message); err != nil {
+			return nil, fmt.Errorf("failed to scan warning: %w", err)
+		}
+		warnings = append(warnings, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read warnings: %w", timeoutError(ctx, err))
+	}
+	return warnings, nil
+}
+
+// warningCount returns how many warnings the last statement run on q left.
+// The driver does not expose the count of the statement's own OK packet.
+func warningCount(ctx context.Context, q queryer) (int64, error) {
+	rows, err := q.QueryContext(ctx, "SHOW COUNT(*) WARNINGS")
+	if err != nil {
+		return 0, fmt.Errorf("failed to count warnings: %w", timeoutError(ctx, err))
+	}
+	defer rows.Close()
+
+	var count int64
+	if rows.Next() {
+		if err := rows.Scan(&count); err != nil {
+			return 0, fmt.Errorf("failed to count warnings: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to count warnings: %w", timeoutError(ctx, err))
+	}
+	return count, nil
+}
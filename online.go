@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/koh-yoshimoto/mysql-mcp-server/mysql"
+	"github.com/koh-yoshimoto/mysql-mcp-server/sqlparse"
+)
+
+// rebuildBytesPerSecond is a deliberately conservative rate for estimating
+// how long rebuilding a table takes; real rates depend on hardware and load.
+const rebuildBytesPerSecond = 50 << 20
+
+// onlineProbes are tried in order on shadow tables until one succeeds.
+var onlineProbes = []string{
+	"ALGORITHM=INSTANT",
+	"ALGORITHM=INPLACE, LOCK=NONE",
+	"ALGORITHM=INPLACE",
+	"ALGORITHM=COPY",
+}
+
+// OnlineReport tells how MySQL can carry out an ALTER: which algorithm it
+// supports and whether concurrent writes continue meanwhile.
+type OnlineReport struct {
+	// Probes maps each tried option set to the error it failed with, or ""
+	Probes    map[string]string
+	Algorithm string // INSTANT, INPLACE or COPY; empty if undetermined
+	LockNone  bool
+	Size      *mysql.TableSize
+	// RowVersions and RowVersionLimit are the INSTANT row versions the real
+	// table has used and may use, when the server counts them
+	RowVersions     int64
+	RowVersionLimit int64
+	Note            string
+}
+
+// analyzeOnline probes the algorithms MySQL supports for an ALTER TABLE,
+// CREATE INDEX or DROP INDEX by applying it to shadow tables with explicit
+// ALGORITHM and LOCK clauses. An empty table supports the same algorithms as
+// the real one, as MySQL decides by operation and table definition, except
+// that a fresh copy has used none of the row versions INSTANT changes are
+// limited to; those of the real table are checked separately. The caller
+// makes sure the statement names no table but its own.
+func (s *MCPServer) analyzeOnline(ctx context.Context, ddl *sqlparse.DDL, query string) *OnlineReport {
+	report := &OnlineReport{Probes: map[string]string{}}
+	schema, name := sqlparse.SplitTableName(ddl.Table)
+
+	size, err := s.currentReadClient().GetTableSize(ctx, schema, name)
+	if err != nil {
+		report.Note = err.Error()
+	}
+	report.Size = size
+
+	if ddl.SetsAlgorithm {
+		report.Note = strings.TrimSpace(report.Note + " The statement sets ALGORITHM or LOCK itself; the shadow validation shows whether MySQL supports them")
+		return report
+	}
+
+	server := s.currentReadClient().Server()
+	instant := server.Capabilities().InstantDDL
+	if !instant {
+		report.Note = strings.TrimSpace(report.Note + fmt.Sprintf(" ALGORITHM=INSTANT was not tried, as %s does not support it.", server))
+	}
+	if limit := server.Capabilities().InstantRowVersions; instant && limit > 0 {
+		versions, err := s.currentReadClient().GetRowVersions(ctx, schema, name)
+		switch {
+		case err != nil:
+			report.Note = strings.TrimSpace(report.Note + fmt.Sprintf(" The INSTANT result is only indicative, as the row versions of the table are unknown: %v.", err))
+		case versions >= limit:
+			// MySQL refuses INSTANT column changes until the table is rebuilt
+			report.Probes["ALGORITHM=INSTANT"] = fmt.Sprintf("the table has used all %d row versions of INSTANT changes; adding or dropping columns needs a rebuild first", limit)
+			instant = false
+		default:
+			report.RowVersions, report.RowVersionLimit = versions, limit
+		}
+	}
+	for _, options := range onlineProbes {
+		if options == "ALGORITHM=INSTANT" && !instant {
+			continue
+		}
+		result, err := s.shadowClient().ShadowDDL(ctx, ddl.Table, name, func(shadow string) string {
+			return ddl.WithOptions(ddl.WithTable(query, shadow), options)
+		})
+		if err != nil {
+			report.Note = strings.TrimSpace(report.Note + fmt.Sprintf(" Online DDL analysis unavailable: %v", err))
+			return report
+		}
+		if result.Err != nil {
+			report.Probes[options] = result.Err.Error()
+			continue
+		}
+
+		report.Probes[options] = ""
+		report.Algorithm = strings.TrimPrefix(strings.Split(options, ",")[0], "ALGORITHM=")
+		report.LockNone = report.Algorithm == "INSTANT" || strings.Contains(options, "LOCK=NONE")
+		break
+	}
+
+	return report
+}
+
+// BlocksWrites reports whether the ALTER blocks concurrent writes.
+func (r *OnlineReport) BlocksWrites() bool {
+	return r.Algorithm != "" && !r.LockNone
+}
+
+// Render describes the report as text and structured data.
+func (r *OnlineReport) Render() (string, map[string]interface{}) {
+	var text strings.Builder
+	data := map[string]interface{}{
+		"algorithm": r.Algorithm,
+		"lock_none": r.LockNone,
+	}
+
+	text.WriteString("⚙️  Online DDL analysis:\n")
+	probes := make([]map[string]interface{}, 0, len(r.Probes))
+	for _, options := range onlineProbes {
+		failure, tried := r.Probes[options]
+		if !tried {
+			continue
+		}
+		if failure == "" {
+			fmt.Fprintf(&text, "- %s: ✅ supported\n", options)
+		} else {
+			fmt.Fprintf(&text, "- %s: ❌ not supported (%s)\n", options, failure)
+		}
+		probes = append(probes, map[string]interface{}{"options": options, "supported": failure == "", "error": failure})
+	}
+	data["probes"] = probes
+
+	switch {
+	case r.Algorithm == "INSTANT":
+		text.WriteString("✅ INSTANT: only the table metadata changes; no rebuild and no blocking, whatever the table size\n")
+		if r.RowVersionLimit > 0 {
+			fmt.Fprintf(&text, "The table has used %d of %d row versions; each INSTANT ADD or DROP COLUMN uses one more\n", r.RowVersions, r.RowVersionLimit)
+			data["row_versions"] = r.RowVersions
+			data["row_version_limit"] = r.RowVersionLimit
+		}
+	case r.Algorithm == "INPLACE" && r.LockNone:
+		text.WriteString("✅ INPLACE with LOCK=NONE: reads and writes continue during the change, though InnoDB may still rebuild the table in place\n")
+	case r.Algorithm == "INPLACE":
+		text.WriteString("⚠️  INPLACE, but LOCK=NONE is not supported: concurrent writes are blocked until the change finishes\n")
+	case r.Algorithm == "COPY":
+		text.WriteString("🚨 COPY: the table is copied row by row and writes are blocked until the copy finishes\n")
+	}
+
+	if r.Size != nil {
+		fmt.Fprintf(&text, "📦 Table size: about %d rows, %s of data and %s of indexes (%s)\n",
+			r.Size.Rows, formatBytes(r.Size.DataLength), formatBytes(r.Size.IndexLength), r.Size.Engine)
+		data["table_rows"] = r.Size.Rows
+		data["data_bytes"] = r.Size.DataLength
+		data["index_bytes"] = r.Size.IndexLength
+
+		if r.Algorithm == "INPLACE" || r.Algorithm == "COPY" {
+			estimate := rebuildEstimate(r.Size.DataLength + r.Size.IndexLength)
+			fmt.Fprintf(&text, "⏱️  Estimated rebuild time: %s (at about %s/s; the real speed depends on hardware and load)\n",
+				formatEstimate(estimate), formatBytes(rebuildBytesPerSecond))
+			data["estimated_rebuild_seconds"] = int64(estimate.Seconds())
+		}
+	}
+
+	switch {
+	case r.Algorithm == "INSTANT":
+		text.WriteString("💡 Append ALGORITHM=INSTANT to the statement so MySQL refuses it rather than falling back to a slower algorithm\n")
+	case r.Algorithm == "INPLACE" && r.LockNone:
+		text.WriteString("💡 Append ALGORITHM=INPLACE, LOCK=NONE to the statement so MySQL refuses it rather than blocking writes\n")
+	}
+
+	if r.Note != "" {
+		text.WriteString(r.Note + "\n")
+		data["note"] = r.Note
+	}
+
+	return strings.TrimRight(text.String(), "\n"), data
+}
+
+func rebuildEstimate(bytes int64) time.Duration {
+	return time.Duration(float64(bytes) / rebuildBytesPerSecond * float64(time.Second))
+}
+
+func formatEstimate(d time.Duration) string {
+	if d < time.Second {
+		return "less than a second"
+	}
+	return "about " + d.Round(time.Second).String()
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
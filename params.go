@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/koh-yoshimoto/mysql-mcp-server/sqlparse"
+	"github.com/tidwall/gjson"
+)
+
+// parseParams reads the params argument: the values bound to the statement's
+// ? placeholders, in order. Strings, numbers, booleans and null map to their
+// SQL counterparts, and strings stay strings whatever they hold. Integers are
+// bound as integers and other numbers as exact decimal text. A date and time
+// is asked for with {"type": "datetime", "value": <RFC 3339>}, and bound in
+// UTC, the time zone of the connection.
+func parseParams(args json.RawMessage) ([]interface{}, error) {
+	value := gjson.GetBytes(args, "params")
+	if !value.Exists() {
+		return nil, nil
+	}
+	if !value.IsArray() {
+		return nil, fmt.Errorf("params must be an array of values for the ? placeholders")
+	}
+
+	var params []interface{}
+	for i, item := range value.Array() {
+		switch item.Type {
+		case gjson.Null:
+			params = append(params, nil)
+		case gjson.True, gjson.False:
+			params = append(params, item.Bool())
+		case gjson.Number:
+			if n, err := strconv.ParseInt(item.Raw, 10, 64); err == nil {
+				params = append(params, n)
+			} else if n, err := strconv.ParseUint(item.Raw, 10, 64); err == nil {
+				params = append(params, n)
+			} else {
+				params = append(params, json.Number(item.Raw))
+			}
+		case gjson.String:
+			params = append(params, item.String())
+		default:
+			if !item.IsObject() {
+				return nil, fmt.Errorf("param %d must be a string, number, boolean, null or typed value", i+1)
+			}
+			t, err := parseTypedParam(item)
+			if err != nil {
+				return nil, fmt.Errorf("param %d: %w", i+1, err)
+			}
+			params = append(params, t)
+		}
+	}
+	return params, nil
+}
+
+// parseTypedParam reads a param given as {"type": ..., "value": ...}. The
+// only type is datetime, whose value is an RFC 3339 timestamp.
+func parseTypedParam(item gjson.Result) (time.Time, error) {
+	if kind := item.Get("type").String(); kind != "datetime" {
+		return time.Time{}, fmt.Errorf(`unknown type %q, the only typed value is {"type": "datetime", "value": "2024-05-01T10:00:00Z"}`, kind)
+	}
+	t, err := time.Parse(time.RFC3339Nano, item.Get("value").String())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("datetime value %s is not an RFC 3339 timestamp such as 2024-05-01T10:00:00Z", item.Get("value").Raw)
+	}
+	return t.UTC(), nil
+}
+
+// bindParams checks the params against the statement's placeholders and
+// returns the statement with the values inlined, which is what the dry run
+// analyzes and the audit log and responses show. The statement itself is
+// always sent with its placeholders and the values bound separately.
+func bindParams(sql string, params []interface{}) (string, error) {
+	if len(params) == 0 {
+		return sql, nil
+	}
+	return sqlparse.Bind(sql, params)
+}
+
+// statementKey is the text a confirm token or cache entry is bound to, so it
+// only applies to the same statement with the same values.
+func statementKey(sql string, params []interface{}) string {
+	if len(params) == 0 {
+		return sql
+	}
+	key, _ := json.Marshal([]interface{}{sql, params})
+	return string(key)
+}
+
+// isParameterizable reports whether params can be bound to the statement.
+// DDL and other statements outside the DML do not take placeholders.
+func isParameterizable(sql string) bool {
+	switch detectQueryOperation(sql) {
+	case "INSERT", "UPDATE", "DELETE", "REPLACE":
+		return true
+	}
+	return false
+}
+
+// paramsSchema describes the params argument in the tool list.
+var paramsSchema = map[string]interface{}{
+	"type": "array",
+	"items": map[string]interface{}{
+		"anyOf": []map[string]interface{}{
+			{"type": []string{"string", "number", "boolean", "null"}},
+			{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"type":  map[string]interface{}{"type": "string", "enum": []string{"datetime"}},
+					"value": map[string]interface{}{"type": "string", "description": "RFC 3339 timestamp, such as 2024-05-01T10:00:00Z"},
+				},
+				"required": []string{"type", "value"},
+			},
+		},
+	},
+	"description": "Values for the ? placeholders in the statement, in order. Pass values here instead of writing them into the SQL. Strings are bound as strings; for a date and time value converted to UTC, pass {\"type\": \"datetime\", \"value\": \"2024-05-01T10:00:00+02:00\"}.",
+}
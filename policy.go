@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/koh-yoshimoto/mysql-mcp-server/sqlparse"
+)
+
+// Policy outcomes, from least to most restrictive.
+const (
+	policyAllow        = "allow"
+	policyConfirm      = "confirm"
+	policyConfirmTwice = "confirm_twice"
+	policyDeny         = "deny"
+)
+
+var policyOutcomes = []string{policyAllow, policyConfirm, policyConfirmTwice, policyDeny}
+
+var policyDays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Policy decides how a statement has to be approved before it is executed.
+// Rules are checked in order and the first matching one applies.
+type Policy struct {
+	// Default is the outcome when no rule matches (default: confirm)
+	Default string `json:"default"`
+	// Timezone for the hours and days of rules (default: local time)
+	Timezone string       `json:"timezone"`
+	Rules    []PolicyRule `json:"rules"`
+
+	location *time.Location
+}
+
+// PolicyRule matches statements on every condition it sets; unset conditions
+// match everything.
+type PolicyRule struct {
+	Name string `json:"name"`
+	// Operations such as UPDATE or DROP
+	Operations []string `json:"operations"`
+	// Tables are patterns such as "orders" or "shop.*"; * matches any text
+	Tables []string `json:"tables"`
+	// MinRows and MaxRows bound the affected rows of the dry run, inclusive
+	MinRows *int64 `json:"min_rows"`
+	MaxRows *int64 `json:"max_rows"`
+	// Connections are patterns for user@host:port/database
+	Connections []string `json:"connections"`
+	// Hours is a time range such as "09:00-18:00"; it may wrap past midnight
+	Hours string `json:"hours"`
+	// Days such as "mon" or "sat"
+	Days    []string `json:"days"`
+	Outcome string   `json:"outcome"`
+	Message string   `json:"message"`
+
+	from, to int // Hours in minutes since midnight
+}
+
+// PolicyDecision is the outcome of evaluating the policy for a statement.
+type PolicyDecision struct {
+	Outcome string
+	Rule    string // name of the matching rule; empty for the default
+	Message string
+}
+
+// PolicyStatement is what a policy is evaluated against.
+type PolicyStatement struct {
+	Operation    string
+	Table        string // unquoted, possibly schema-qualified; empty if unknown
+	AffectedRows int64  // -1 if unknown
+	Connection   string
+	Time         time.Time
+}
+
+func defaultPolicy() *Policy {
+	return &Policy{Default: policyConfirm, location: time.Local}
+}
+
+// loadPolicy reads the policy file named by MYSQL_POLICY_FILE. Without one,
+// every statement needs a single confirmation.
+func loadPolicy() (*Policy, error) {
+	path := os.Getenv("MYSQL_POLICY_FILE")
+	if path == "" {
+		return defaultPolicy(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+	policy, err := parsePolicy(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %w", path, err)
+	}
+	return policy, nil
+}
+
+// parsePolicy parses and validates a JSON policy.
+func parsePolicy(data []byte) (*Policy, error) {
+	policy := defaultPolicy()
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(policy); err != nil {
+		return nil, err
+	}
+
+	if policy.Default == "" {
+		policy.Default = policyConfirm
+	}
+	if policyRank(policy.Default) < 0 {
+		return nil, fmt.Errorf("unknown default outcome %q", policy.Default)
+	}
+	if policy.Timezone != "" {
+		location, err := time.LoadLocation(policy.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("unknown timezone %q", policy.Timezone)
+		}
+		policy.location = location
+	}
+
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if policyRank(rule.Outcome) < 0 {
+			return nil, fmt.Errorf("%s: outcome must be one of %s", rule.Name, strings.Join(policyOutcomes, ", "))
+		}
+		if rule.Hours != "" {
+			var fromH, fromM, toH, toM int
+			if n, _ := fmt.Sscanf(rule.Hours, "%d:%d-%d:%d", &fromH, &fromM, &toH, &toM); n != 4 ||
+				fromH > 24 || toH > 24 || fromM > 59 || toM > 59 || fromH < 0 || toH < 0 || fromM < 0 || toM < 0 {
+				return nil, fmt.Errorf("%s: hours must look like 09:00-18:00", rule.Name)
+			}
+			rule.from, rule.to = fromH*60+fromM, toH*60+toM
+		}
+		for _, day := range rule.Days {
+			if _, ok := policyDays[strings.ToLower(day)]; !ok {
+				return nil, fmt.Errorf("%s: unknown day %q, use mon, tue, wed, thu, fri, sat or sun", rule.Name, day)
+			}
+		}
+	}
+
+	return policy, nil
+}
+
+// Evaluate returns the decision of the first matching rule, or the default.
+func (p *Policy) Evaluate(stmt PolicyStatement) PolicyDecision {
+	for i := range p.Rules {
+		if rule := &p.Rules[i]; rule.matches(stmt, p.location) {
+			return PolicyDecision{Outcome: rule.Outcome, Rule: rule.Name, Message: rule.Message}
+		}
+	}
+	return PolicyDecision{Outcome: p.Default}
+}
+
+// matches reports whether the rule applies. A statement whose table or row
+// count is unknown matches table and row conditions, except in allow rules,
+// so it cannot slip past a stricter rule.
+func (r *PolicyRule) matches(stmt PolicyStatement, location *time.Location) bool {
+	matchUnknown := r.Outcome != policyAllow
+
+	if len(r.Operations) > 0 && !matchAny(r.Operations, stmt.Operation) {
+		return false
+	}
+
+	if len(r.Tables) > 0 {
+		if stmt.Table == "" {
+			if !matchUnknown {
+				return false
+			}
+		} else if !matchAny(r.Tables, stmt.Table) {
+			return false
+		}
+	}
+
+	if r.MinRows != nil || r.MaxRows != nil {
+		if stmt.AffectedRows < 0 {
+			if !matchUnknown {
+				return false
+			}
+		} else if (r.MinRows != nil && stmt.AffectedRows < *r.MinRows) ||
+			(r.MaxRows != nil && stmt.AffectedRows > *r.MaxRows) {
+			return false
+		}
+	}
+
+	if len(r.Connections) > 0 && !matchAny(r.Connections, stmt.Connection) {
+		return false
+	}
+
+	now := stmt.Time.In(location)
+	if len(r.Days) > 0 {
+		matched := false
+		for _, day := range r.Days {
+			if policyDays[strings.ToLower(day)] == now.Weekday() {
+				matched = true
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if r.Hours != "" {
+		minute := now.Hour()*60 + now.Minute()
+		if r.from <= r.to {
+			if minute < r.from || minute >= r.to {
+				return false
+			}
+		} else if minute < r.from && minute >= r.to {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchAny matches value against patterns case-insensitively; * matches any
+// text.
+func matchAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		expr := "(?i)^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$"
+		if matched, _ := regexp.MatchString(expr, value); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// policyRank orders outcomes by restrictiveness; it is -1 for unknown ones.
+func policyRank(outcome string) int {
+	for i, o := range policyOutcomes {
+		if o == outcome {
+			return i
+		}
+	}
+	return -1
+}
+
+// RequiresConfirmation reports whether the user has to approve the statement.
+func (d PolicyDecision) RequiresConfirmation() bool {
+	return d.Outcome != policyAllow
+}
+
+// Describe explains the decision in one line.
+func (d PolicyDecision) Describe() string {
+	source := "the default outcome"
+	if d.Rule != "" {
+		source = fmt.Sprintf("rule %q", d.Rule)
+	}
+
+	var text string
+	switch d.Outcome {
+	case policyAllow:
+		text = "📋 Policy: allowed without asking the user (" + source + ")"
+	case policyConfirm:
+		text = "📋 Policy: requires the user's confirmation (" + source + ")"
+	case policyConfirmTwice:
+		text = "📋 Policy: requires the user's confirmation TWICE; executing with the confirm token returns a second token to confirm again (" + source + ")"
+	case policyDeny:
+		text = "📋 Policy: denied (" + source + ")"
+	}
+	if d.Message != "" {
+		text += ": " + d.Message
+	}
+	return text
+}
+
+func (d PolicyDecision) data() map[string]interface{} {
+	return map[string]interface{}{
+		"outcome": d.Outcome,
+		"rule":    d.Rule,
+		"message": d.Message,
+	}
+}
+
+// statementTable returns the unquoted table a statement works on, or an empty
+// string if it cannot be determined.
+func statementTable(sql string) string {
+	var table string
+	switch operation := detectQueryOperation(sql); operation {
+	case "UPDATE", "DELETE":
+		if dml, err := sqlparse.ParseDML(sql); err == nil {
+			table = dml.Table
+		}
+	case "INSERT", "REPLACE":
+		table = sqlparse.InsertTarget(sql)
+	default:
+		if ddl := sqlparse.ParseDDL(sql); ddl != nil {
+			table = ddl.Table
+		}
+	}
+
+	schema, name := sqlparse.SplitTableName(table)
+	if schema != "" {
+		return schema + "." + name
+	}
+	return name
+}
+
+// evaluatePolicy decides how a statement affecting the given number of rows
+// has to be approved.
+func (s *MCPServer) evaluatePolicy(sql string, affectedRows int64) PolicyDecision {
+	return s.policy.Evaluate(PolicyStatement{
+		Operation:    detectQueryOperation(sql),
+		Table:        statementTable(sql),
+		AffectedRows: affectedRows,
+		Connection:   s.connection,
+		Time:         time.Now(),
+	})
+}
+
+// evaluateBatchPolicy returns the most restrictive decision over the
+// statements of a batch.
+func (s *MCPServer) evaluateBatchPolicy(statements []string, counts []int64) PolicyDecision {
+	var decision PolicyDecision
+	for i, statement := range statements {
+		d := s.evaluatePolicy(statement, counts[i])
+		if i == 0 || policyRank(d.Outcome) > policyRank(decision.Outcome) {
+			decision = d
+		}
+	}
+	return decision
+}
+
+// checkPolicyAtExecute re-evaluates the policy when a confirmed statement is
+// executed, as the time of day or the policy may differ from the dry run.
+func checkPolicyAtExecute(confirmed, current PolicyDecision) error {
+	if current.Outcome == policyDeny {
+		message := "the approval policy denies this statement"
+		if current.Message != "" {
+			message += ": " + current.Message
+		}
+		return fmt.Errorf("%s", message)
+	}
+	if policyRank(current.Outcome) > policyRank(confirmed.Outcome) {
+		return fmt.Errorf("the approval policy now requires %s instead of %s. Please run with dry_run=true again",
+			current.Outcome, confirmed.Outcome)
+	}
+	return nil
+}
+
+// secondConfirmation answers the first confirmed execution of a
+// confirm_twice statement with a new token for the tool instead of executing
+// it.
+func (s *MCPServer) secondConfirmation(id interface{}, tool string, confirmation *ExecuteConfirmation, describe string) *Response {
+	second := *confirmation
+	second.CreatedAt = time.Time{}
+	second.SecondConfirmation = true
+	token := s.confirmations.Issue(&second)
+
+	question := fmt.Sprintf("The policy requires a second confirmation. Are you REALLY SURE you want to execute %s affecting %d rows?",
+		describe, confirmation.AffectedRows)
+
+	return &Response{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result: map[string]interface{}{
+			"content": []map[string]interface{}{
+				{
+					"type": "text",
+					"text": "✋ SECOND CONFIRMATION REQUIRED - nothing was executed yet",
+				},
+				{
+					"type": "text",
+					"text": confirmation.Policy.Describe(),
+				},
+				{
+					"type": "text",
+					"text": fmt.Sprintf("Use the %s tool again with dry_run=false and confirm_token='%s' (single use, valid for %s) once the user confirms a second time",
+						tool, token, s.confirmations.TTL()),
+				},
+			},
+			"operation":                  confirmation.Operation,
+			"affected_rows":              confirmation.AffectedRows,
+			"confirm_token":              token,
+			"policy":                     confirmation.Policy.data(),
+			"requires_user_confirmation": true,
+			"confirmation_prompt":        question,
+			"ai_instruction": fmt.Sprintf(`IMPORTANT: Nothing was executed yet. You MUST:
+1. Ask the user again, separately from the first confirmation: "%s"
+2. Only execute with the new confirm token if the user clearly confirms again
+3. Never pass the new token without asking the user`, question),
+		},
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/koh-yoshimoto/mysql-mcp-server/mysql"
+	"github.com/koh-yoshimoto/mysql-mcp-server/sqlparse"
+)
+
+// previewRowLimit caps the number of rows captured for a dry-run preview.
+const previewRowLimit = 10
+
+// RowPreview captures sample rows around a rolled-back statement so the
+// dry run can show what execute would change.
+type RowPreview struct {
+	Operation string
+	Table     string
+	Key       []string
+	Probe     *mysql.DryRunProbe
+	Note      string
+}
+
+// buildRowPreview prepares the probe for previewing an UPDATE, DELETE or
+// INSERT. Statements that cannot be previewed get a preview with only a Note
+// explaining why, or nil when previews do not apply at all.
+func (s *MCPServer) buildRowPreview(ctx context.Context, query string) *RowPreview {
+	operation := detectQueryOperation(query)
+
+	switch operation {
+	case "UPDATE", "DELETE":
+		dml, err := sqlparse.ParseDML(query)
+		if err != nil {
+			return &RowPreview{Operation: operation, Note: fmt.Sprintf("Preview unavailable: %v", err)}
+		}
+		if dml.MultiTable {
+			return &RowPreview{Operation: operation, Note: "Preview unavailable for multi-table statements"}
+		}
+
+		preview := &RowPreview{Operation: operation, Table: dml.Table}
+		pk, err := s.lookupPrimaryKey(ctx, dml.Table)
+		if err != nil {
+			return &RowPreview{Operation: operation, Table: dml.Table, Note: fmt.Sprintf("Preview unavailable: %v", err)}
+		}
+		preview.Key = pk.Columns
+
+		limit := previewRowLimit
+		if n, err := strconv.Atoi(strings.TrimSpace(dml.Limit)); err == nil && n < limit {
+			limit = n
+		}
+
+		preview.Probe = &mysql.DryRunProbe{Before: selectAffectedRows(dml, strconv.Itoa(limit))}
+
+		if operation == "UPDATE" {
+			if len(pk.Columns) == 0 {
+				preview.Note = "The table has no primary key, so only the rows before the change are shown"
+			} else {
+				preview.Probe.After = func(_ sql.Result, rows *mysql.ResultSet) (string, []interface{}) {
+					return selectByKey(dml.Table, pk.Columns, rows.Maps())
+				}
+			}
+		}
+		return preview
+
+	case "INSERT", "REPLACE":
+		table := sqlparse.InsertTarget(query)
+		if table == "" {
+			return &RowPreview{Operation: operation, Note: "Preview unavailable: could not determine the target table"}
+		}
+
+		pk, err := s.lookupPrimaryKey(ctx, table)
+		if err != nil {
+			return &RowPreview{Operation: operation, Table: table, Note: fmt.Sprintf("Preview unavailable: %v", err)}
+		}
+		if !pk.AutoIncrement || len(pk.Columns) != 1 {
+			return &RowPreview{Operation: operation, Table: table,
+				Note: "Preview unavailable: inserted rows can only be located through an AUTO_INCREMENT primary key"}
+		}
+
+		column := sqlparse.QuoteIdent(pk.Columns[0])
+		// INSERT ... SELECT does not say how many rows it inserts until it runs
+		var rows int64
+		if insert := sqlparse.ParseInsert(query); insert != nil && insert.Rows > 0 {
+			rows = int64(insert.Rows)
+		}
+		return &RowPreview{
+			Operation: operation,
+			Table:     table,
+			Key:       pk.Columns,
+			Probe: &mysql.DryRunProbe{
+				After: func(result sql.Result, _ *mysql.ResultSet) (string, []interface{}) {
+					firstID, err := result.LastInsertId()
+					if err != nil || firstID == 0 {
+						return "", nil
+					}
+					n := rows
+					if n == 0 {
+						n, _ = result.RowsAffected()
+					}
+					// The ids reserved for the statement, one increment apart,
+					// so rows other sessions committed meanwhile stay out
+					return fmt.Sprintf("SELECT * FROM %s WHERE %s BETWEEN ? AND ? + ? * @@auto_increment_increment ORDER BY %s LIMIT %d",
+						table, column, column, previewRowLimit), []interface{}{firstID, firstID, n - 1}
+				},
+			},
+		}
+	}
+
+	return nil
+}
+
+// selectAffectedRows builds a SELECT for the rows a single-table UPDATE or
+// DELETE touches. An empty limit keeps the statement's own LIMIT, if any.
+func selectAffectedRows(dml *sqlparse.DML, limit string) string {
+	query := "SELECT * FROM " + dml.Table
+	if dml.With != "" {
+		query = dml.With + " " + query
+	}
+	if dml.Alias != "" {
+		query += " " + dml.Alias
+	}
+	if dml.HasWhere() {
+		query += " WHERE " + dml.Where
+	}
+	if dml.OrderBy != "" {
+		query += " ORDER BY " + dml.OrderBy
+	}
+	if limit == "" {
+		limit = dml.Limit
+	}
+	if limit != "" {
+		query += " LIMIT " + limit
+	}
+	return query
+}
+
+func (s *MCPServer) lookupPrimaryKey(ctx context.Context, table string) (*mysql.PrimaryKey, error) {
+	schema, name := sqlparse.SplitTableName(table)
+	return s.currentReadClient().GetPrimaryKey(ctx, schema, name)
+}
+
+// selectByKey builds a query re-reading rows by their primary key values.
+func selectByKey(table string, key []string, rows []map[string]interface{}) (string, []interface{}) {
+	if len(rows) == 0 {
+		return "", nil
+	}
+
+	columns := make([]string, len(key))
+	for i, column := range key {
+		columns[i] = sqlparse.QuoteIdent(column)
+	}
+	tuple := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(key)), ", ") + ")"
+
+	var args []interface{}
+	tuples := make([]string, len(rows))
+	for i, row := range rows {
+		tuples[i] = tuple
+		for _, column := range key {
+			args = append(args, row[column])
+		}
+	}
+
+	return fmt.Sprintf("SELECT * FROM %s WHERE (%s) IN (%s)",
+		table, strings.Join(columns, ", "), strings.Join(tuples, ", ")), args
+}
+
+// Render describes the captured rows as text for the dry-run response and as
+// structured data for the result.
+func (p *RowPreview) Render(s *MCPServer, result *mysql.DryRunResult, affectedRows int64) (string, map[string]interface{}) {
+	data := map[string]interface{}{
+		"operation": p.Operation,
+		"table":     p.Table,
+	}
+	if p.Note != "" {
+		data["note"] = p.Note
+	}
+	if result == nil || p.Probe == nil {
+		return p.Note, data
+	}
+
+	var text strings.Builder
+	switch p.Operation {
+	case "UPDATE":
+		changes := diffRows(p.Key, result.Before.Maps(), result.After.Maps())
+		data["rows_before"] = result.Before.Maps()
+		data["rows_after"] = result.After.Maps()
+		data["changes"] = changes
+
+		fmt.Fprintf(&text, "🔎 Preview of changes (%d of %d rows):\n", result.Before.Len(), affectedRows)
+		if result.After.Len() == 0 {
+			text.WriteString(s.formatResults(result.Before, "table"))
+			break
+		}
+		for _, change := range changes {
+			fmt.Fprintf(&text, "\n%s\n", change["row"])
+			columns, _ := change["columns"].(map[string]map[string]interface{})
+			if len(columns) == 0 {
+				text.WriteString("  (no change)\n")
+				continue
+			}
+			for _, name := range sortedKeys(columns) {
+				fmt.Fprintf(&text, "  %s: %s → %s\n", name,
+					previewValue(columns[name]["before"]), previewValue(columns[name]["after"]))
+			}
+		}
+
+	case "DELETE":
+		data["rows_before"] = result.Before.Maps()
+		fmt.Fprintf(&text, "🔎 Sample of rows that would be deleted (%d of %d rows):\n", result.Before.Len(), affectedRows)
+		text.WriteString(s.formatResults(result.Before, "table"))
+
+	default:
+		data["rows_after"] = result.After.Maps()
+		fmt.Fprintf(&text, "🔎 Rows as they would be stored, including defaults and generated values (%d of %d rows):\n",
+			result.After.Len(), affectedRows)
+		text.WriteString(s.formatResults(result.After, "table"))
+	}
+
+	if p.Note != "" {
+		text.WriteString("\n" + p.Note)
+	}
+	return strings.TrimRight(text.String(), "\n"), data
+}
+
+// diffRows pairs rows before and after an UPDATE by primary key and lists
+// the columns whose values changed.
+func diffRows(key []string, before, after []map[string]interface{}) []map[string]interface{} {
+	afterByKey := make(map[string]map[string]interface{}, len(after))
+	for _, row := range after {
+		afterByKey[rowKey(key, row)] = row
+	}
+
+	changes := make([]map[string]interface{}, 0, len(before))
+	for _, old := range before {
+		label := rowLabel(key, old)
+		updated, found := afterByKey[rowKey(key, old)]
+		if !found {
+			changes = append(changes, map[string]interface{}{
+				"row":  label + " (primary key changed, new values not shown)",
+				"key":  keyValues(key, old),
+				"note": "primary key changed",
+			})
+			continue
+		}
+
+		columns := map[string]map[string]interface{}{}
+		for name, oldValue := range old {
+			// Compared as literals, as previews of long binary values are cut short
+			if sqlparse.Literal(oldValue) != sqlparse.Literal(updated[name]) {
+				columns[name] = map[string]interface{}{"before": oldValue, "after": updated[name]}
+			}
+		}
+		changes = append(changes, map[string]interface{}{
+			"row":     label,
+			"key":     keyValues(key, old),
+			"columns": columns,
+		})
+	}
+	return changes
+}
+
+func rowKey(key []string, row map[string]interface{}) string {
+	parts := make([]string, len(key))
+	for i, column := range key {
+		parts[i] = previewValue(row[column])
+	}
+	return strings.Join(parts, "\x00")
+}
+
+func rowLabel(key []string, row map[string]interface{}) string {
+	parts := make([]string, len(key))
+	for i, column := range key {
+		parts[i] = fmt.Sprintf("%s=%s", column, previewValue(row[column]))
+	}
+	return "Row " + strings.Join(parts, ", ")
+}
+
+func keyValues(key []string, row map[string]interface{}) map[string]interface{} {
+	values := make(map[string]interface{}, len(key))
+	for _, column := range key {
+		values[column] = row[column]
+	}
+	return values
+}
+
+func previewValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return "'" + val + "'"
+	case time.Time:
+		return "'" + val.Format("2006-01-02 15:04:05") + "'"
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
+
+func sortedKeys(m map[string]map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/koh-yoshimoto/mysql-mcp-server/mysql"
+)
+
+// reportRetries adds the transient errors that were retried during a tool
+// call to its result, so a slow answer is explained.
+func reportRetries(ctx context.Context, result map[string]interface{}) {
+	retries := mysql.Retries(ctx)
+	if len(retries) == 0 {
+		return
+	}
+
+	var reasons []string
+	seen := map[string]bool{}
+	for _, err := range retries {
+		if reason := err.Error(); !seen[reason] {
+			seen[reason] = true
+			reasons = append(reasons, reason)
+		}
+	}
+	content, _ := result["content"].([]map[string]interface{})
+	result["content"] = append(content, map[string]interface{}{
+		"type": "text",
+		"text": fmt.Sprintf("🔁 Retried %d times after transient errors: %s", len(retries), strings.Join(reasons, "; ")),
+	})
+	result["retries"] = len(retries)
+}
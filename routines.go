@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/koh-yoshimoto/mysql-mcp-server/mysql"
+	"github.com/koh-yoshimoto/mysql-mcp-server/sqlparse"
+	"github.com/tidwall/gjson"
+)
+
+// objectTypes are the stored object types of the routines and definition
+// tools in listing order, with the value of their type argument.
+var objectTypes = []struct {
+	arg, objectType, title string
+}{
+	{"procedure", mysql.ObjectProcedure, "Stored procedures"},
+	{"function", mysql.ObjectFunction, "Stored functions"},
+	{"trigger", mysql.ObjectTrigger, "Triggers"},
+	{"event", mysql.ObjectEvent, "Events"},
+}
+
+var objectTypeArgs = []string{"procedure", "function", "trigger", "event"}
+
+// handleRoutinesTool lists the stored procedures, functions, triggers and
+// events of a schema, or only those of one type.
+func (s *MCPServer) handleRoutinesTool(id interface{}, args json.RawMessage) *Response {
+	only := strings.ToLower(gjson.GetBytes(args, "type").String())
+	schema := gjson.GetBytes(args, "schema").String()
+
+	ctx, cancel, _ := s.callContext(args)
+	defer cancel()
+
+	var contentMessages []map[string]interface{}
+	result := map[string]interface{}{}
+	for _, t := range objectTypes {
+		if only != "" && only != t.arg {
+			continue
+		}
+		objects, err := s.currentReadClient().ListObjects(ctx, t.objectType, schema)
+		if err != nil {
+			return &Response{
+				JSONRPC: "2.0",
+				ID:      id,
+				Error: &Error{
+					Code:    -32603,
+					Message: fmt.Sprintf("Failed to list routines: %v", err),
+				},
+			}
+		}
+		contentMessages = append(contentMessages, map[string]interface{}{
+			"type": "text",
+			"text": fmt.Sprintf("%s (%d):\n%s", t.title, objects.Len(), s.formatResults(objects, "table")),
+		})
+		result[t.arg+"s"] = objects
+	}
+
+	if contentMessages == nil {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: fmt.Sprintf("Unknown type %q: use one of %s", only, strings.Join(objectTypeArgs, ", ")),
+			},
+		}
+	}
+
+	contentMessages = append(contentMessages, map[string]interface{}{
+		"type": "text",
+		"text": "💡 Use the definition tool with a type and name to see the full definition.",
+	})
+	result["content"] = contentMessages
+	return &Response{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result:  result,
+	}
+}
+
+// handleDefinitionTool shows the full definition of a stored procedure,
+// function, trigger or event.
+func (s *MCPServer) handleDefinitionTool(id interface{}, args json.RawMessage) *Response {
+	arg := strings.ToLower(gjson.GetBytes(args, "type").String())
+	name := gjson.GetBytes(args, "name").String()
+
+	objectType := ""
+	for _, t := range objectTypes {
+		if t.arg == arg {
+			objectType = t.objectType
+		}
+	}
+	if objectType == "" || name == "" {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: fmt.Sprintf("type (one of %s) and name are required", strings.Join(objectTypeArgs, ", ")),
+			},
+		}
+	}
+
+	ctx, cancel, _ := s.callContext(args)
+	defer cancel()
+
+	schema, object := sqlparse.SplitTableName(name)
+	definition, err := s.currentReadClient().ShowCreate(ctx, objectType, schema, object)
+	if err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32603,
+				Message: fmt.Sprintf("Failed to get definition: %v", err),
+			},
+		}
+	}
+
+	return &Response{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result: map[string]interface{}{
+			"content": []map[string]interface{}{
+				{
+					"type": "text",
+					"text": fmt.Sprintf("Definition of %s %s:", arg, name),
+				},
+				{
+					"type": "text",
+					"text": definition,
+				},
+			},
+			"type":       arg,
+			"name":       name,
+			"definition": definition,
+		},
+	}
+}
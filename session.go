@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/koh-yoshimoto/mysql-mcp-server/audit"
+	"github.com/koh-yoshimoto/mysql-mcp-server/mysql"
+	"github.com/koh-yoshimoto/mysql-mcp-server/sqlparse"
+	"github.com/tidwall/gjson"
+)
+
+// defaultSessionIdleTimeout applies unless overridden with
+// MYSQL_SESSION_IDLE_TIMEOUT_SECONDS.
+const defaultSessionIdleTimeout = 10 * time.Minute
+
+// loadSessionIdleTimeout reads how long a session may stay unused from the
+// environment.
+func loadSessionIdleTimeout() time.Duration {
+	if v, err := strconv.Atoi(os.Getenv("MYSQL_SESSION_IDLE_TIMEOUT_SECONDS")); err == nil && v > 0 {
+		return time.Duration(v) * time.Second
+	}
+	return defaultSessionIdleTimeout
+}
+
+// session is a pair of connections pinned by session_open. While it is open
+// the read tools and session statements run on a connection of the read
+// account, so user variables, session settings, temporary tables and the
+// database chosen with USE carry over between calls. Confirmed statements
+// run on a connection of the write account, which follows USE.
+type session struct {
+	conn      *mysql.Session
+	writeConn *mysql.Session
+	// read and write are the read and write clients pinned to conn and
+	// writeConn
+	read  *mysql.Client
+	write *mysql.Client
+	// database is the database last chosen with USE, if any
+	database    string
+	opened      time.Time
+	lastUsed    time.Time
+	calls       int
+	idleTimeout time.Duration
+	timer       *time.Timer
+}
+
+// currentReadClient returns the client the read tools use: the session's,
+// if one is open, or the read pool.
+func (s *MCPServer) currentReadClient() *mysql.Client {
+	if s.session != nil {
+		return s.session.read
+	}
+	return s.readClient
+}
+
+// currentWriteClient returns the client confirmed statements run on: the
+// session's, if one is open, or the write pool.
+func (s *MCPServer) currentWriteClient() *mysql.Client {
+	if s.session != nil {
+		return s.session.write
+	}
+	return s.writeClient
+}
+
+// tokenConnection returns what confirm tokens are bound to besides the
+// statement: the connection, and while a session is open the database chosen
+// with USE, as unqualified table names resolve against it.
+func (s *MCPServer) tokenConnection() string {
+	if s.session != nil && s.session.database != "" {
+		return s.connection + " USE " + s.session.database
+	}
+	return s.connection
+}
+
+func (s *MCPServer) handleSessionOpenTool(id interface{}, args json.RawMessage) *Response {
+	if s.session != nil {
+		return s.sessionResponse(id, fmt.Sprintf("📌 A session is already open on connection %d. Close it with session_close to start a new one.",
+			s.session.conn.ID()))
+	}
+
+	// The server's idle timeout can only be lowered per session
+	idleTimeout := s.sessionIdleTimeout
+	if seconds := gjson.GetBytes(args, "idle_timeout_seconds").Int(); seconds > 0 && time.Duration(seconds)*time.Second < idleTimeout {
+		idleTimeout = time.Duration(seconds) * time.Second
+	}
+
+	ctx, cancel, timeout := s.callContext(args)
+	defer cancel()
+
+	conn, err := s.readClient.OpenSession(ctx)
+	var writeConn *mysql.Session
+	if err == nil {
+		if writeConn, err = s.writeClient.OpenSession(ctx); err != nil {
+			conn.Close()
+		}
+	}
+	if err != nil {
+		s.logAudit(audit.Entry{Tool: "session_open", Action: "open", Outcome: audit.OutcomeError, Error: err.Error()})
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32603,
+				Message: errorMessage("Failed to open session", err, timeout),
+			},
+		}
+	}
+
+	now := time.Now()
+	current := &session{
+		conn:        conn,
+		writeConn:   writeConn,
+		read:        s.readClient.InSession(conn),
+		write:       s.writeClient.InSession(writeConn),
+		opened:      now,
+		lastUsed:    now,
+		idleTimeout: idleTimeout,
+	}
+	current.timer = time.AfterFunc(idleTimeout, func() { s.expireSession(current) })
+	s.session = current
+	s.sessionNotice = ""
+	s.logAudit(audit.Entry{Tool: "session_open", Action: "open", Outcome: audit.OutcomeSuccess})
+
+	return s.sessionResponse(id, fmt.Sprintf("📌 Session opened on connection %d. Until session_close, or after %s without a tool call, "+
+		"the read tools run on this connection, so SET, USE and temporary tables carry over between calls. "+
+		"Run them with the 'query' tool. 'execute' and 'call' run on connection %d of the write account, which follows USE "+
+		"but does not see the session's variables, settings or temporary tables.", conn.ID(), idleTimeout, writeConn.ID()))
+}
+
+// sessionResponse describes the open session after text.
+func (s *MCPServer) sessionResponse(id interface{}, text string) *Response {
+	return &Response{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result: map[string]interface{}{
+			"content": []map[string]interface{}{
+				{
+					"type": "text",
+					"text": text,
+				},
+			},
+			"connection_id":        s.session.conn.ID(),
+			"write_connection_id":  s.session.writeConn.ID(),
+			"idle_timeout_seconds": int64(s.session.idleTimeout.Seconds()),
+			"opened_at":            s.session.opened.Format(time.RFC3339),
+		},
+	}
+}
+
+func (s *MCPServer) handleSessionCloseTool(id interface{}) *Response {
+	if s.session == nil {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: "No session is open.",
+			},
+		}
+	}
+
+	connectionID, calls, duration := s.session.conn.ID(), s.session.calls, time.Since(s.session.opened)
+	s.closeSession("")
+	return &Response{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result: map[string]interface{}{
+			"content": []map[string]interface{}{
+				{
+					"type": "text",
+					"text": fmt.Sprintf("📌 Session on connection %d closed after %s and %d tool calls. Its variables, settings and temporary tables are gone; tools use the connection pool again.",
+						connectionID, duration.Round(time.Second), calls),
+				},
+			},
+			"connection_id": connectionID,
+			"duration_ms":   duration.Milliseconds(),
+		},
+	}
+}
+
+// closeSession closes the open session, if any. A non-empty reason is
+// passed on to the next tool call. The caller holds sessionMu.
+func (s *MCPServer) closeSession(reason string) {
+	if s.session == nil {
+		return
+	}
+	s.session.timer.Stop()
+	for _, conn := range []*mysql.Session{s.session.conn, s.session.writeConn} {
+		if err := conn.Close(); err != nil {
+			log.Printf("Warning: failed to close session connection %d: %v", conn.ID(), err)
+		}
+	}
+	entry := audit.Entry{Tool: "session_close", Action: "close", Outcome: audit.OutcomeSuccess}
+	if reason != "" {
+		entry.Error = reason
+		s.sessionNotice = fmt.Sprintf("📌 The session on connection %d was closed because %s. Its variables, settings and temporary tables are gone, and tools use the connection pool again. Use session_open to start a new session.",
+			s.session.conn.ID(), reason)
+	}
+	s.session = nil
+	s.logAudit(entry)
+}
+
+// expireSession closes current once it has been idle for its timeout.
+func (s *MCPServer) expireSession(current *session) {
+	s.sessionMu.Lock()
+	defer s.sessionMu.Unlock()
+	if s.session != current {
+		return
+	}
+	if idle := time.Since(current.lastUsed); idle < current.idleTimeout {
+		current.timer.Reset(current.idleTimeout - idle)
+		return
+	}
+	s.closeSession(fmt.Sprintf("it was idle for %s", current.idleTimeout))
+}
+
+// afterToolCall keeps the session alive after a tool call, or closes it if
+// its connection was lost, and passes on why an earlier session ended. The
+// caller holds sessionMu.
+func (s *MCPServer) afterToolCall(response *Response) {
+	if s.session != nil {
+		if s.session.conn.Lost() || s.session.writeConn.Lost() {
+			s.closeSession("its connection was lost")
+			// The failed call explains itself; later ones need not
+			s.sessionNotice = ""
+			return
+		}
+		s.session.calls++
+		s.session.lastUsed = time.Now()
+		s.session.timer.Reset(s.session.idleTimeout)
+		return
+	}
+
+	if s.sessionNotice == "" || response == nil {
+		return
+	}
+	if response.Error != nil {
+		response.Error.Message += " " + s.sessionNotice
+	} else if result, ok := response.Result.(map[string]interface{}); ok {
+		content, _ := result["content"].([]map[string]interface{})
+		result["content"] = append(content, map[string]interface{}{
+			"type": "text",
+			"text": s.sessionNotice,
+		})
+	}
+	s.sessionNotice = ""
+}
+
+// handleSessionStatement runs a statement that changes the state of the open
+// session, such as SET, USE or CREATE TEMPORARY TABLE, for the query tool.
+func (s *MCPServer) handleSessionStatement(id interface{}, args json.RawMessage, query, statement string, params []interface{}) *Response {
+	// CREATE TEMPORARY TABLE ... SELECT reads like any query
+	if err := s.guardrails.CheckRead(query); err != nil {
+		s.logAudit(audit.Entry{Tool: "query", Action: "session", SQL: statement, Outcome: audit.OutcomeRejected, Error: err.Error()})
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: fmt.Sprintf("Refusing to run this statement: %v.", err),
+			},
+		}
+	}
+
+	ctx, cancel, timeout := s.callContext(args)
+	defer cancel()
+
+	start := time.Now()
+	// Statements that evaluate expressions run in a read-only transaction, so
+	// a stored function they call cannot change data
+	result, err := s.session.read.ExecSession(ctx, query, sqlparse.EvaluatesExpressions(query), params...)
+	if database := sqlparse.UseDatabase(query); err == nil && database != "" {
+		// Confirmed statements resolve table names in the same database. A
+		// session whose connections disagree on it cannot go on.
+		if _, err = s.session.write.ExecSession(ctx, query, false); err != nil {
+			s.closeSession(fmt.Sprintf("its write connection could not switch to database %s", database))
+		} else {
+			s.session.database = database
+		}
+	}
+	if err != nil {
+		s.logAudit(audit.Entry{Tool: "query", Action: "session", SQL: statement, Outcome: audit.OutcomeError,
+			Error: err.Error(), DurationMs: time.Since(start).Milliseconds()})
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32603,
+				Message: errorMessage("Session statement failed", err, timeout),
+			},
+		}
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	executionTime := time.Since(start)
+	s.logAudit(audit.Entry{Tool: "query", Action: "session", SQL: statement, Outcome: audit.OutcomeSuccess,
+		ActualRows: int64Ptr(rowsAffected), DurationMs: executionTime.Milliseconds()})
+
+	contentMessages := []map[string]interface{}{
+		{
+			"type": "text",
+			"text": fmt.Sprintf("✅ Session statement executed in %dms on connection %d. Rows affected: %d",
+				executionTime.Milliseconds(), s.session.conn.ID(), rowsAffected),
+		},
+	}
+	if message := warningsMessage(result.Warnings); message != nil {
+		contentMessages = append(contentMessages, message)
+	}
+	if message := unreadWarningsMessage(result.WarningsErr); message != nil {
+		contentMessages = append(contentMessages, message)
+	}
+	response := map[string]interface{}{
+		"content":       contentMessages,
+		"rows_affected": rowsAffected,
+		"connection_id": s.session.conn.ID(),
+	}
+	if len(result.Warnings) > 0 {
+		response["warnings"] = result.Warnings
+	}
+	return &Response{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result:  response,
+	}
+}
@@ -0,0 +1,235 @@
+package sqlparse
+
+import "strings"
+
+// DDL describes the table a DDL statement works on.
+type DDL struct {
+	Kind  string   // e.g. ALTER TABLE, CREATE INDEX, DROP TABLE
+	Table string   // first table as written, e.g. `db`.`orders`
+	Other []string // further tables, for DROP TABLE and RENAME TABLE
+	// References are the other tables the statement names, in REFERENCES,
+	// EXCHANGE PARTITION ... WITH TABLE or CREATE TABLE ... LIKE
+	References []string
+	// Renames reports whether the statement gives a table a new name
+	Renames bool
+	// CopiesData reports a CREATE TABLE ... SELECT
+	CopiesData bool
+	// SetsAlgorithm reports explicit ALGORITHM or LOCK clauses
+	SetsAlgorithm bool
+	// Temporary reports CREATE and DROP of a TEMPORARY table
+	Temporary bool
+	// ForeignKeys reports statements that add, drop or reference foreign keys
+	ForeignKeys bool
+
+	start, end int // byte span of Table in the statement
+}
+
+// ParseDDL recognizes ALTER TABLE, CREATE TABLE, CREATE INDEX, DROP INDEX,
+// DROP TABLE, TRUNCATE TABLE and RENAME TABLE statements. It returns nil for
+// other statements.
+func ParseDDL(sql string) *DDL {
+	tokens := Significant(Tokenize(sql))
+	if len(tokens) > 0 && tokens[len(tokens)-1].Text == ";" {
+		tokens = tokens[:len(tokens)-1]
+	}
+	if len(tokens) < 2 {
+		return nil
+	}
+
+	i := 1
+	skip := func(words ...string) {
+		for i < len(tokens) && tokens[i].Is(words...) {
+			i++
+		}
+	}
+	expect := func(words ...string) bool {
+		if i < len(tokens) && tokens[i].Is(words...) {
+			i++
+			return true
+		}
+		return false
+	}
+	skipIfExists := func(word string) {
+		if i+1 < len(tokens) && tokens[i].Is("IF") && tokens[i+1].Is(word) {
+			i += 2
+			if word == "NOT" {
+				expect("EXISTS")
+			}
+		}
+	}
+
+	ddl := &DDL{}
+	switch {
+	case tokens[0].Is("ALTER"):
+		skip("ONLINE", "OFFLINE", "IGNORE")
+		if !expect("TABLE") {
+			return nil
+		}
+		ddl.Kind = "ALTER TABLE"
+
+	case tokens[0].Is("CREATE"):
+		ddl.Temporary = i < len(tokens) && tokens[i].Is("TEMPORARY")
+		skip("OR", "REPLACE", "TEMPORARY", "UNIQUE", "FULLTEXT", "SPATIAL", "ONLINE", "OFFLINE")
+		switch {
+		case expect("TABLE"):
+			ddl.Kind = "CREATE TABLE"
+			skipIfExists("NOT")
+		case expect("INDEX"):
+			ddl.Kind = "CREATE INDEX"
+			if !skipToOn(tokens, &i) {
+				return nil
+			}
+		default:
+			return nil
+		}
+
+	case tokens[0].Is("DROP"):
+		ddl.Temporary = i < len(tokens) && tokens[i].Is("TEMPORARY")
+		skip("TEMPORARY", "ONLINE", "OFFLINE")
+		switch {
+		case expect("TABLE"):
+			ddl.Kind = "DROP TABLE"
+			skipIfExists("EXISTS")
+		case expect("INDEX"):
+			ddl.Kind = "DROP INDEX"
+			if !skipToOn(tokens, &i) {
+				return nil
+			}
+		default:
+			return nil
+		}
+
+	case tokens[0].Is("TRUNCATE"):
+		expect("TABLE")
+		ddl.Kind = "TRUNCATE TABLE"
+
+	case tokens[0].Is("RENAME"):
+		if !expect("TABLE") {
+			return nil
+		}
+		ddl.Kind = "RENAME TABLE"
+		ddl.Renames = true
+
+	default:
+		return nil
+	}
+
+	table, start, end, next := qualifiedName(sql, tokens, i)
+	if table == "" {
+		return nil
+	}
+	ddl.Table, ddl.start, ddl.end = table, start, end
+	i = next
+
+	// Collect the remaining table names of DROP TABLE a, b and
+	// RENAME TABLE a TO b, c TO d
+	if ddl.Kind == "DROP TABLE" || ddl.Kind == "RENAME TABLE" {
+		for i < len(tokens) && (tokens[i].Text == "," || tokens[i].Is("TO")) {
+			name, _, _, next := qualifiedName(sql, tokens, i+1)
+			if name == "" {
+				break
+			}
+			ddl.Other = append(ddl.Other, name)
+			i = next
+		}
+	}
+
+	// ALTER TABLE ... RENAME [TO|AS] renames the table, unlike RENAME COLUMN
+	// and RENAME INDEX
+	depth := 0
+	for j := i; j < len(tokens); j++ {
+		switch tok := tokens[j]; {
+		case tok.Text == "(":
+			depth++
+		case tok.Text == ")":
+			depth--
+		case depth != 0:
+		case ddl.Kind == "ALTER TABLE" && tok.Is("RENAME"):
+			if j+1 < len(tokens) && !tokens[j+1].Is("COLUMN", "INDEX", "KEY") {
+				ddl.Renames = true
+			}
+		case tok.Is("ALGORITHM", "LOCK"):
+			ddl.SetsAlgorithm = true
+		}
+		if tokens[j].Is("FOREIGN", "REFERENCES") {
+			ddl.ForeignKeys = true
+		}
+		switch {
+		case tokens[j].Is("REFERENCES"):
+			ddl.References = append(ddl.References, referencedName(sql, tokens, j+1))
+		case tokens[j].Is("WITH") && j+1 < len(tokens) && tokens[j+1].Is("TABLE"):
+			ddl.References = append(ddl.References, referencedName(sql, tokens, j+2))
+		case ddl.Kind == "CREATE TABLE" && tokens[j].Is("LIKE") && (j == i || j == i+1 && tokens[i].Text == "("):
+			ddl.References = append(ddl.References, referencedName(sql, tokens, j+1))
+		}
+	}
+	// The query of CREATE TABLE ... SELECT may be parenthesized
+	if ddl.Kind == "CREATE TABLE" {
+		for _, tok := range tokens[i:] {
+			if tok.Is("SELECT") {
+				ddl.CopiesData = true
+			}
+		}
+	}
+
+	return ddl
+}
+
+// WithTable returns sql with the statement's table replaced by name.
+func (d *DDL) WithTable(sql, name string) string {
+	return sql[:d.start] + name + sql[d.end:]
+}
+
+// WithOptions returns sql with ALTER TABLE options such as
+// "ALGORITHM=INPLACE, LOCK=NONE" appended, as an extra clause of ALTER TABLE
+// or after the index definition of CREATE INDEX and DROP INDEX.
+func (d *DDL) WithOptions(sql, options string) string {
+	sql = strings.TrimRight(strings.TrimSpace(sql), ";")
+	if d.Kind == "ALTER TABLE" {
+		return sql + ", " + options
+	}
+	return sql + " " + strings.ReplaceAll(options, ",", "")
+}
+
+// referencedName returns the table name at token i, or the token itself when
+// it is not a name, so a reference is never lost.
+func referencedName(sql string, tokens []Token, i int) string {
+	if name, _, _, _ := qualifiedName(sql, tokens, i); name != "" {
+		return name
+	}
+	if i < len(tokens) {
+		return tokens[i].Text
+	}
+	return "?"
+}
+
+// skipToOn advances past an index name to the token after ON.
+func skipToOn(tokens []Token, i *int) bool {
+	for *i < len(tokens) {
+		tok := tokens[*i]
+		*i++
+		if tok.Is("ON") {
+			return true
+		}
+	}
+	return false
+}
+
+// qualifiedName reads a possibly schema-qualified name starting at token i,
+// returning it with its byte span and the index of the following token.
+func qualifiedName(sql string, tokens []Token, i int) (name string, start, end, next int) {
+	if i >= len(tokens) || (tokens[i].Kind != Word && tokens[i].Kind != QuotedIdent) {
+		return "", 0, 0, i
+	}
+	start = tokens[i].Pos
+	for i < len(tokens) && (tokens[i].Kind == Word || tokens[i].Kind == QuotedIdent) {
+		end = tokens[i].Pos + len(tokens[i].Text)
+		i++
+		if i+1 < len(tokens) && tokens[i].Text == "." {
+			i++
+			continue
+		}
+		break
+	}
+	return strings.TrimSpace(sql[start:end]), start, end, i
+}
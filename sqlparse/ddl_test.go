@@ -0,0 +1,114 @@
+package sqlparse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDDL(t *testing.T) {
+	tests := []struct {
+		sql        string
+		kind       string
+		table      string
+		renames    bool
+		copiesData bool
+	}{
+		{"ALTER TABLE orders ADD COLUMN note TEXT", "ALTER TABLE", "orders", false, false},
+		{"alter online table `shop`.`orders` drop index idx_a;", "ALTER TABLE", "`shop`.`orders`", false, false},
+		{"ALTER TABLE orders RENAME COLUMN a TO b", "ALTER TABLE", "orders", false, false},
+		{"ALTER TABLE orders RENAME TO orders_old", "ALTER TABLE", "orders", true, false},
+		{"CREATE TABLE IF NOT EXISTS t (id INT PRIMARY KEY)", "CREATE TABLE", "t", false, false},
+		{"CREATE TABLE t2 AS (SELECT * FROM t)", "CREATE TABLE", "t2", false, true},
+		{"CREATE UNIQUE INDEX idx_email ON users (email)", "CREATE INDEX", "users", false, false},
+		{"DROP INDEX idx_email ON shop.users", "DROP INDEX", "shop.users", false, false},
+		{"DROP TABLE IF EXISTS a, b", "DROP TABLE", "a", false, false},
+		{"TRUNCATE orders", "TRUNCATE TABLE", "orders", false, false},
+		{"RENAME TABLE a TO b", "RENAME TABLE", "a", true, false},
+	}
+
+	for _, tt := range tests {
+		ddl := ParseDDL(tt.sql)
+		if ddl == nil {
+			t.Errorf("ParseDDL(%q) returned nil", tt.sql)
+			continue
+		}
+		if ddl.Kind != tt.kind || ddl.Table != tt.table || ddl.Renames != tt.renames || ddl.CopiesData != tt.copiesData {
+			t.Errorf("ParseDDL(%q) = %+v", tt.sql, ddl)
+		}
+	}
+}
+
+func TestParseDDLForeignKeys(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want bool
+	}{
+		{"ALTER TABLE orders DROP FOREIGN KEY fk_customer", true},
+		{"ALTER TABLE orders ADD CONSTRAINT fk_customer FOREIGN KEY (customer_id) REFERENCES customers (id)", true},
+		{"CREATE TABLE items (id INT PRIMARY KEY, order_id INT REFERENCES orders (id))", true},
+		{"ALTER TABLE orders ADD COLUMN note TEXT", false},
+	}
+
+	for _, tt := range tests {
+		if got := ParseDDL(tt.sql).ForeignKeys; got != tt.want {
+			t.Errorf("ParseDDL(%q).ForeignKeys = %v, want %v", tt.sql, got, tt.want)
+		}
+	}
+
+	for _, sql := range []string{"UPDATE t SET a = 1", "CREATE VIEW v AS SELECT 1", "ALTER DATABASE d CHARACTER SET utf8mb4"} {
+		if ddl := ParseDDL(sql); ddl != nil {
+			t.Errorf("ParseDDL(%q) = %+v, want nil", sql, ddl)
+		}
+	}
+
+	if ddl := ParseDDL("DROP TABLE a, b"); len(ddl.Other) != 1 || ddl.Other[0] != "b" {
+		t.Errorf("DROP TABLE should list the other tables, got %v", ddl.Other)
+	}
+}
+
+func TestParseDDLReferences(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want []string
+	}{
+		{"ALTER TABLE orders EXCHANGE PARTITION p2023 WITH TABLE orders_2023", []string{"orders_2023"}},
+		{"ALTER TABLE orders EXCHANGE PARTITION p2023 WITH TABLE `archive`.`orders_2023` WITHOUT VALIDATION", []string{"`archive`.`orders_2023`"}},
+		{"ALTER TABLE orders ADD CONSTRAINT fk_customer FOREIGN KEY (customer_id) REFERENCES shop.customers (id) ON DELETE CASCADE", []string{"shop.customers"}},
+		{"CREATE TABLE items (id INT PRIMARY KEY, order_id INT REFERENCES orders (id))", []string{"orders"}},
+		{"CREATE TABLE orders_copy LIKE orders", []string{"orders"}},
+		{"CREATE TABLE orders_copy (LIKE orders)", []string{"orders"}},
+		{"ALTER TABLE orders ADD FULLTEXT INDEX ft (note) WITH PARSER ngram", nil},
+		{"ALTER TABLE orders DROP FOREIGN KEY fk_customer", nil},
+		{"CREATE TABLE t (name VARCHAR(10), CHECK (name LIKE 'a%'))", nil},
+	}
+
+	for _, tt := range tests {
+		if got := ParseDDL(tt.sql).References; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseDDL(%q).References = %q, want %q", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestDDLWithTable(t *testing.T) {
+	sql := "CREATE INDEX idx ON `shop`.`users` (email)"
+	ddl := ParseDDL(sql)
+	if got := ddl.WithTable(sql, "`_mcp_shadow`.`users_1`"); got != "CREATE INDEX idx ON `_mcp_shadow`.`users_1` (email)" {
+		t.Errorf("WithTable = %q", got)
+	}
+}
+
+func TestDDLWithOptions(t *testing.T) {
+	sql := "ALTER TABLE orders ADD COLUMN note TEXT;"
+	if got := ParseDDL(sql).WithOptions(sql, "ALGORITHM=INPLACE, LOCK=NONE"); got != "ALTER TABLE orders ADD COLUMN note TEXT, ALGORITHM=INPLACE, LOCK=NONE" {
+		t.Errorf("WithOptions = %q", got)
+	}
+
+	sql = "CREATE INDEX idx ON orders (created_at)"
+	if got := ParseDDL(sql).WithOptions(sql, "ALGORITHM=INPLACE, LOCK=NONE"); got != "CREATE INDEX idx ON orders (created_at) ALGORITHM=INPLACE LOCK=NONE" {
+		t.Errorf("WithOptions = %q", got)
+	}
+
+	if !ParseDDL("ALTER TABLE orders ADD INDEX (a), ALGORITHM=INPLACE").SetsAlgorithm {
+		t.Error("SetsAlgorithm should detect an explicit ALGORITHM clause")
+	}
+}
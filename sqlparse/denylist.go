@@ -0,0 +1,83 @@
+package sqlparse
+
+import "strings"
+
+// Match is a denied function call or clause found in a statement.
+type Match struct {
+	Name string // as listed, e.g. SLEEP or INTO OUTFILE
+	Pos  int    // byte offset in the statement
+}
+
+// FindFunction returns the first call of one of the functions, ignoring
+// case. Schema-qualified calls such as mysql.sleep(1) match too.
+func FindFunction(sql string, functions []string) *Match {
+	tokens := executableTokens(sql)
+	for i := 0; i+1 < len(tokens); i++ {
+		tok := tokens[i]
+		if tokens[i+1].Text != "(" || (tok.Kind != Word && tok.Kind != QuotedIdent) {
+			continue
+		}
+		name := tok.Text
+		if tok.Kind == QuotedIdent && len(name) >= 2 {
+			name = strings.ReplaceAll(name[1:len(name)-1], "``", "`")
+		}
+		for _, function := range functions {
+			if strings.EqualFold(name, function) {
+				return &Match{Name: function, Pos: tok.Pos}
+			}
+		}
+	}
+	return nil
+}
+
+// FindClause returns the first occurrence of one of the clauses, each a
+// sequence of keywords such as "FOR UPDATE", ignoring case and spacing.
+func FindClause(sql string, clauses []string) *Match {
+	tokens := executableTokens(sql)
+	for i := range tokens {
+		for _, clause := range clauses {
+			words := strings.Fields(clause)
+			if len(words) == 0 || i+len(words) > len(tokens) {
+				continue
+			}
+			matched := true
+			for j, word := range words {
+				if !tokens[i+j].Is(word) {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				return &Match{Name: clause, Pos: tokens[i].Pos}
+			}
+		}
+	}
+	return nil
+}
+
+// executableTokens returns the significant tokens of a statement, including
+// those inside executable comments such as /*!50000 ... */ and /*M! ... */,
+// which MySQL and MariaDB run as part of the statement. Positions inside
+// comments are those of the comment.
+func executableTokens(sql string) []Token {
+	var result []Token
+	for _, tok := range Tokenize(sql) {
+		switch tok.Kind {
+		case Whitespace:
+		case Comment:
+			body := strings.TrimPrefix(tok.Text, "/*")
+			if body == tok.Text || !(strings.HasPrefix(body, "!") || strings.HasPrefix(body, "M!")) {
+				continue
+			}
+			body = strings.TrimLeft(strings.TrimPrefix(strings.TrimPrefix(body, "M"), "!"), "0123456789")
+			body = strings.TrimSuffix(body, "*/")
+			for _, inner := range executableTokens(body) {
+				inner.Pos = tok.Pos
+				result = append(result, inner)
+			}
+		default:
+			result = append(result, tok)
+		}
+	}
+	return result
+}
@@ -0,0 +1,52 @@
+package sqlparse
+
+import "testing"
+
+func TestFindFunction(t *testing.T) {
+	functions := []string{"SLEEP", "LOAD_FILE", "BENCHMARK"}
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT LOAD_FILE('/etc/passwd')", "LOAD_FILE"},
+		{"SELECT id FROM t WHERE sleep (10) = 0", "SLEEP"},
+		{"SELECT mysql.`Sleep`(1)", "SLEEP"},
+		{"SELECT 1 /*!50000 , BENCHMARK(1000000, MD5('x')) */", "BENCHMARK"},
+		{"SELECT 'SLEEP(10)' AS note, sleep FROM t", ""},
+		{"SELECT 1 /* SLEEP(10) */", ""},
+	}
+	for _, tt := range tests {
+		match := FindFunction(tt.query, functions)
+		got := ""
+		if match != nil {
+			got = match.Name
+		}
+		if got != tt.want {
+			t.Errorf("FindFunction(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestFindClause(t *testing.T) {
+	clauses := []string{"INTO OUTFILE", "FOR UPDATE", "LOCK IN SHARE MODE"}
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT * FROM t INTO OUTFILE '/tmp/t.csv'", "INTO OUTFILE"},
+		{"SELECT * FROM t WHERE id = 1 for\n  update", "FOR UPDATE"},
+		{"SELECT * FROM t LOCK IN SHARE MODE", "LOCK IN SHARE MODE"},
+		{"SELECT 'FOR UPDATE' FROM t", ""},
+		{"SELECT * FROM t FOR SHARE", ""},
+	}
+	for _, tt := range tests {
+		match := FindClause(tt.query, clauses)
+		got := ""
+		if match != nil {
+			got = match.Name
+		}
+		if got != tt.want {
+			t.Errorf("FindClause(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package sqlparse
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TokenKind classifies a lexical token of a MySQL statement.
+type TokenKind int
+
+const (
+	Whitespace  TokenKind = iota
+	Comment               // -- ..., # ..., /* ... */ (including hints and executable comments)
+	Word                  // keywords and unquoted identifiers
+	QuotedIdent           // `identifier`
+	String                // 'text', "text" and prefixed literals such as X'..' or _utf8mb4'..'
+	Number                // integer, decimal, float and hex literals
+	Placeholder           // ?
+	Variable              // @user_var, @@system_var
+	Punct                 // operators and punctuation
+)
+
+type Token struct {
+	Kind TokenKind
+	Text string
+	Pos  int
+}
+
+// Is reports whether the token is a word matching one of the keywords,
+// ignoring case.
+func (t Token) Is(keywords ...string) bool {
+	if t.Kind != Word {
+		return false
+	}
+	for _, kw := range keywords {
+		if strings.EqualFold(t.Text, kw) {
+			return true
+		}
+	}
+	return false
+}
+
+// multiCharOperators are matched longest first.
+var multiCharOperators = []string{"<=>", "->>", "<=", ">=", "<>", "!=", ":=", "||", "&&", "<<", ">>", "->"}
+
+// Tokenize splits a statement into tokens. Concatenating the Text of every
+// token reproduces the input exactly; unterminated strings and comments run
+// to the end of the input.
+func Tokenize(sql string) []Token {
+	var tokens []Token
+	pos := 0
+
+	for pos < len(sql) {
+		start := pos
+		r, size := utf8.DecodeRuneInString(sql[pos:])
+		kind := Punct
+
+		switch {
+		case unicode.IsSpace(r):
+			kind = Whitespace
+			for pos < len(sql) {
+				r, size := utf8.DecodeRuneInString(sql[pos:])
+				if !unicode.IsSpace(r) {
+					break
+				}
+				pos += size
+			}
+
+		case r == '#' || strings.HasPrefix(sql[pos:], "--") && (pos+2 == len(sql) || isSpaceByte(sql[pos+2])):
+			kind = Comment
+			if end := strings.IndexByte(sql[pos:], '\n'); end >= 0 {
+				pos += end + 1
+			} else {
+				pos = len(sql)
+			}
+
+		case strings.HasPrefix(sql[pos:], "/*"):
+			kind = Comment
+			if end := strings.Index(sql[pos+2:], "*/"); end >= 0 {
+				pos += end + 4
+			} else {
+				pos = len(sql)
+			}
+
+		case r == '\'' || r == '"':
+			kind = String
+			pos = scanQuoted(sql, pos, byte(r))
+
+		case r == '`':
+			kind = QuotedIdent
+			pos = scanQuoted(sql, pos, '`')
+
+		case r == '?':
+			kind = Placeholder
+			pos++
+
+		case r == '@':
+			kind = Variable
+			pos++
+			if pos < len(sql) && sql[pos] == '@' {
+				pos++
+			}
+			switch {
+			case pos < len(sql) && (sql[pos] == '\'' || sql[pos] == '"' || sql[pos] == '`'):
+				pos = scanQuoted(sql, pos, sql[pos])
+			default:
+				pos = scanWord(sql, pos, true)
+			}
+
+		case r >= '0' && r <= '9' || r == '.' && pos+1 < len(sql) && sql[pos+1] >= '0' && sql[pos+1] <= '9':
+			kind = Number
+			pos = scanNumber(sql, pos)
+			// Identifiers may start with digits, e.g. 1st_column
+			if pos < len(sql) && isWordRune(rune(sql[pos])) {
+				kind = Word
+				pos = scanWord(sql, pos, false)
+			}
+
+		case isWordRune(r):
+			kind = Word
+			pos = scanWord(sql, pos, false)
+			// Prefixed string literals: X'0A', B'01', N'text', _utf8mb4'text'
+			word := sql[start:pos]
+			if pos < len(sql) && sql[pos] == '\'' &&
+				(strings.EqualFold(word, "X") || strings.EqualFold(word, "B") || strings.EqualFold(word, "N") || strings.HasPrefix(word, "_")) {
+				kind = String
+				pos = scanQuoted(sql, pos, '\'')
+			}
+
+		default:
+			pos += size
+			for _, op := range multiCharOperators {
+				if strings.HasPrefix(sql[start:], op) {
+					pos = start + len(op)
+					break
+				}
+			}
+		}
+
+		tokens = append(tokens, Token{Kind: kind, Text: sql[start:pos], Pos: start})
+	}
+
+	return tokens
+}
+
+// Significant returns the tokens that are neither whitespace nor comments.
+func Significant(tokens []Token) []Token {
+	result := make([]Token, 0, len(tokens))
+	for _, tok := range tokens {
+		if tok.Kind != Whitespace && tok.Kind != Comment {
+			result = append(result, tok)
+		}
+	}
+	return result
+}
+
+func scanQuoted(sql string, pos int, quote byte) int {
+	pos++
+	for pos < len(sql) {
+		switch sql[pos] {
+		case '\\':
+			if quote != '`' {
+				pos += 2
+				continue
+			}
+		case quote:
+			// A doubled quote is an escaped quote
+			if pos+1 < len(sql) && sql[pos+1] == quote {
+				pos += 2
+				continue
+			}
+			return pos + 1
+		}
+		pos++
+	}
+	return len(sql)
+}
+
+func scanWord(sql string, pos int, allowDot bool) int {
+	for pos < len(sql) {
+		r, size := utf8.DecodeRuneInString(sql[pos:])
+		if !isWordRune(r) && !(allowDot && r == '.') {
+			break
+		}
+		pos += size
+	}
+	return pos
+}
+
+func scanNumber(sql string, pos int) int {
+	if strings.HasPrefix(sql[pos:], "0x") || strings.HasPrefix(sql[pos:], "0b") {
+		pos += 2
+		for pos < len(sql) && isHexByte(sql[pos]) {
+			pos++
+		}
+		return pos
+	}
+
+	for pos < len(sql) && (sql[pos] >= '0' && sql[pos] <= '9' || sql[pos] == '.') {
+		pos++
+	}
+	if pos < len(sql) && (sql[pos] == 'e' || sql[pos] == 'E') {
+		next := pos + 1
+		if next < len(sql) && (sql[next] == '+' || sql[next] == '-') {
+			next++
+		}
+		if next < len(sql) && sql[next] >= '0' && sql[next] <= '9' {
+			pos = next
+			for pos < len(sql) && sql[pos] >= '0' && sql[pos] <= '9' {
+				pos++
+			}
+		}
+	}
+	return pos
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r) || r > unicode.MaxASCII && !unicode.IsSpace(r)
+}
+
+func isSpaceByte(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\f' || b == '\v'
+}
+
+func isHexByte(b byte) bool {
+	return b >= '0' && b <= '9' || b >= 'a' && b <= 'f' || b >= 'A' && b <= 'F'
+}
@@ -0,0 +1,80 @@
+package sqlparse
+
+import "testing"
+
+func TestTokenizeRoundTrip(t *testing.T) {
+	queries := []string{
+		"SELECT * FROM users WHERE name = 'O''Brien' AND note = \"a \\\" b\"",
+		"-- comment\nUPDATE `my``table` SET x = x + 1.5e3 # trailing",
+		"SELECT /*+ BKA(t) */ @@version, @var, X'0A', _utf8mb4'text' FROM t WHERE a <=> ? AND b->>'$.c'",
+		"INSERT INTO t VALUES ('unterminated",
+	}
+
+	for _, query := range queries {
+		var rebuilt string
+		for _, tok := range Tokenize(query) {
+			rebuilt += tok.Text
+		}
+		if rebuilt != query {
+			t.Errorf("Tokenize(%q) does not round-trip, got %q", query, rebuilt)
+		}
+	}
+}
+
+func TestTokenizeKinds(t *testing.T) {
+	tokens := Significant(Tokenize("SELECT `a`, 'x', 42, ?, @v FROM t -- done"))
+	expected := []TokenKind{Word, QuotedIdent, Punct, String, Punct, Number, Punct, Placeholder, Punct, Variable, Word, Word}
+
+	if len(tokens) != len(expected) {
+		t.Fatalf("got %d tokens, want %d: %v", len(tokens), len(expected), tokens)
+	}
+	for i, kind := range expected {
+		if tokens[i].Kind != kind {
+			t.Errorf("token %d (%q) kind = %v, want %v", i, tokens[i].Text, tokens[i].Kind, kind)
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{
+			name:     "Literals are replaced",
+			query:    "SELECT * FROM users WHERE id = 42 AND name = 'bob'",
+			expected: "select * from users where id = ? and name = ?",
+		},
+		{
+			name:     "IN lists collapse",
+			query:    "SELECT * FROM users WHERE id IN (1, 2, 3)",
+			expected: "select * from users where id in ( ?+ )",
+		},
+		{
+			name:     "Multi-row VALUES collapse",
+			query:    "INSERT INTO t (a, b) VALUES (1, 'x'), (2, 'y'), (3, 'z');",
+			expected: "insert into t ( a , b ) values ( ?+ )",
+		},
+		{
+			name:     "Comments and whitespace are ignored",
+			query:    "/* app */ DELETE   FROM t\nWHERE id = 7",
+			expected: "delete from t where id = ?",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := Fingerprint(tt.query); result != tt.expected {
+				t.Errorf("Fingerprint(%q) = %q, want %q", tt.query, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	result := Normalize("  UPDATE users\n\tSET a = 'x  y'\nWHERE id = 1;  ")
+	if result != "UPDATE users SET a = 'x  y' WHERE id = 1" {
+		t.Errorf("Normalize returned %q", result)
+	}
+}
@@ -0,0 +1,100 @@
+package sqlparse
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Literal renders a value scanned from MySQL as an SQL literal that
+// reproduces it exactly. Strings that are not valid UTF-8, or that contain
+// backslashes or control characters, are written as hex literals, so binary
+// data survives a round trip through JSON and the result does not depend on
+// the NO_BACKSLASH_ESCAPES SQL mode. Values with a Bytes method, such as
+// binary column values, are written as hex literals of those bytes.
+func Literal(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if val {
+			return "TRUE"
+		}
+		return "FALSE"
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case int:
+		return strconv.Itoa(val)
+	case uint64:
+		return strconv.FormatUint(val, 10)
+	case float64:
+		return strconv.FormatFloat(val, 'g', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(val), 'g', -1, 32)
+	case json.Number:
+		if isDecimal(string(val)) {
+			return string(val)
+		}
+		return Literal(string(val))
+	case []byte:
+		return hexLiteral(val)
+	case string:
+		if !utf8.ValidString(val) || strings.IndexFunc(val, needsHex) >= 0 {
+			return hexLiteral([]byte(val))
+		}
+		return "'" + strings.ReplaceAll(val, "'", "''") + "'"
+	case time.Time:
+		if val.IsZero() {
+			return "'0000-00-00 00:00:00'"
+		}
+		return "'" + val.Format("2006-01-02 15:04:05.999999") + "'"
+	case interface{ Bytes() []byte }:
+		return hexLiteral(val.Bytes())
+	default:
+		return Literal(fmt.Sprintf("%v", val))
+	}
+}
+
+func hexLiteral(b []byte) string {
+	if len(b) == 0 {
+		return "''"
+	}
+	return "X'" + hex.EncodeToString(b) + "'"
+}
+
+// isDecimal reports whether s is a plain decimal number such as -12.50.
+func isDecimal(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	digits := strings.Trim(s, "0123456789")
+	return s != "" && s != "." && (digits == "" || digits == ".")
+}
+
+func needsHex(r rune) bool {
+	return r == '\\' || r < 0x20 || r == 0x7f
+}
+
+// Bind returns the statement with its ? placeholders replaced by the values
+// as literals, in order. It fails unless there is exactly one value per
+// placeholder.
+func Bind(sql string, args []interface{}) (string, error) {
+	var bound strings.Builder
+	n := 0
+	for _, tok := range Tokenize(sql) {
+		if tok.Kind != Placeholder {
+			bound.WriteString(tok.Text)
+			continue
+		}
+		if n < len(args) {
+			bound.WriteString(Literal(args[n]))
+		}
+		n++
+	}
+	if n != len(args) {
+		return "", fmt.Errorf("the statement has %d placeholders but %d params were given", n, len(args))
+	}
+	return bound.String(), nil
+}
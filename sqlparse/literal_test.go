@@ -0,0 +1,81 @@
+package sqlparse
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestBind(t *testing.T) {
+	tests := []struct {
+		name     string
+		sql      string
+		args     []interface{}
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "Values in order",
+			sql:      "UPDATE users SET name = ?, score = ? WHERE id = ?",
+			args:     []interface{}{"O'Brien", json.Number("1.50"), int64(7)},
+			expected: "UPDATE users SET name = 'O''Brien', score = 1.50 WHERE id = 7",
+		},
+		{
+			name:     "Question marks in strings and comments are kept",
+			sql:      "SELECT '?' /* ? */ FROM t WHERE a = ? AND b IS ?",
+			args:     []interface{}{true, nil},
+			expected: "SELECT '?' /* ? */ FROM t WHERE a = TRUE AND b IS NULL",
+		},
+		{
+			name:     "Dates",
+			sql:      "DELETE FROM logs WHERE created_at < ?",
+			args:     []interface{}{time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)},
+			expected: "DELETE FROM logs WHERE created_at < '2024-05-01 10:00:00'",
+		},
+		{
+			name:    "Too few values",
+			sql:     "SELECT * FROM t WHERE a = ? AND b = ?",
+			args:    []interface{}{1},
+			wantErr: true,
+		},
+		{
+			name:    "Too many values",
+			sql:     "SELECT * FROM t",
+			args:    []interface{}{1},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Bind(tt.sql, tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Bind() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if result != tt.expected {
+				t.Errorf("Bind() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLiteralNumber(t *testing.T) {
+	if result := Literal(json.Number("-12.50")); result != "-12.50" {
+		t.Errorf("Literal(-12.50) = %q", result)
+	}
+	if result := Literal(json.Number("1e3")); result != "'1e3'" {
+		t.Errorf("Literal(1e3) = %q, want a quoted string", result)
+	}
+}
+
+type rawBytes []byte
+
+func (b rawBytes) Bytes() []byte { return b }
+
+func (b rawBytes) String() string { return "0x…" }
+
+func TestLiteralBytes(t *testing.T) {
+	if result := Literal(rawBytes{0x00, 0xff}); result != "X'00ff'" {
+		t.Errorf("Literal(bytes) = %q, want a hex literal of every byte", result)
+	}
+}
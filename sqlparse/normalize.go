@@ -0,0 +1,115 @@
+package sqlparse
+
+import "strings"
+
+// Normalize collapses runs of whitespace into single spaces and drops a
+// trailing semicolon, keeping literals and comments intact.
+func Normalize(sql string) string {
+	var output strings.Builder
+	for _, tok := range Tokenize(sql) {
+		if tok.Kind == Whitespace {
+			output.WriteString(" ")
+			continue
+		}
+		output.WriteString(tok.Text)
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(output.String()), ";"))
+}
+
+// Fingerprint abstracts a statement into its shape: comments are removed,
+// literals and placeholders become ?, keywords and identifiers are lowercased,
+// and lists of values such as IN (1, 2, 3) or multi-row VALUES collapse into
+// a single ?+ entry. Statements that differ only in their values share the
+// same fingerprint.
+func Fingerprint(sql string) string {
+	var parts []string
+	for _, tok := range Significant(Tokenize(sql)) {
+		switch tok.Kind {
+		case String, Number, Placeholder:
+			parts = append(parts, "?")
+		case Word:
+			parts = append(parts, strings.ToLower(tok.Text))
+		default:
+			parts = append(parts, tok.Text)
+		}
+	}
+	if len(parts) > 0 && parts[len(parts)-1] == ";" {
+		parts = parts[:len(parts)-1]
+	}
+
+	return strings.Join(collapseRepeatedGroups(collapseValueLists(parts)), " ")
+}
+
+// collapseValueLists turns "? , ? , ?" into "?+".
+func collapseValueLists(parts []string) []string {
+	result := make([]string, 0, len(parts))
+	for i := 0; i < len(parts); i++ {
+		if parts[i] != "?" {
+			result = append(result, parts[i])
+			continue
+		}
+		j := i
+		for j+2 < len(parts) && parts[j+1] == "," && (parts[j+2] == "?" || parts[j+2] == "?+") {
+			j += 2
+		}
+		if j > i {
+			result = append(result, "?+")
+			i = j
+		} else {
+			result = append(result, "?")
+		}
+	}
+	return result
+}
+
+// collapseRepeatedGroups turns "( ?+ ) , ( ?+ )" into a single "( ?+ )".
+func collapseRepeatedGroups(parts []string) []string {
+	result := make([]string, 0, len(parts))
+	for i := 0; i < len(parts); i++ {
+		result = append(result, parts[i])
+		if parts[i] != "(" {
+			continue
+		}
+		end := matchingParen(parts, i)
+		if end < 0 {
+			continue
+		}
+		group := parts[i : end+1]
+		result = append(result, parts[i+1:end+1]...)
+
+		next := end + 1
+		for next+len(group) < len(parts) && parts[next] == "," && equalParts(parts[next+1:next+1+len(group)], group) {
+			next += 1 + len(group)
+		}
+		i = next - 1
+	}
+	return result
+}
+
+func matchingParen(parts []string, open int) int {
+	depth := 0
+	for i := open; i < len(parts); i++ {
+		switch parts[i] {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func equalParts(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
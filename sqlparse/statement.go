@@ -0,0 +1,563 @@
+package sqlparse
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DML describes the clauses of an UPDATE or DELETE statement. Clause texts
+// are taken verbatim from the statement, without their leading keywords.
+type DML struct {
+	Operation  string // UPDATE or DELETE
+	With       string // leading WITH clause, including the keyword; empty without one
+	Table      string // target table as written, e.g. `db`.`orders`; empty for multi-table statements
+	Alias      string
+	Set        string // UPDATE assignments
+	Where      string // empty when the statement has no WHERE clause
+	OrderBy    string
+	Limit      string
+	MultiTable bool
+}
+
+// HasWhere reports whether the statement restricts the rows it touches.
+func (d *DML) HasWhere() bool {
+	return strings.TrimSpace(d.Where) != ""
+}
+
+// SetColumns returns the unqualified names of the columns an UPDATE assigns
+// to in its SET clause.
+func (d *DML) SetColumns() []string {
+	var columns []string
+	var target strings.Builder
+	depth, inValue := 0, false
+	for _, tok := range Significant(Tokenize(d.Set)) {
+		switch {
+		case tok.Text == "(":
+			depth++
+		case tok.Text == ")":
+			depth--
+		case depth != 0:
+		case tok.Text == ",":
+			inValue = false
+		case inValue:
+		case tok.Text == "=" || tok.Text == ":=":
+			_, column := SplitTableName(target.String())
+			columns = append(columns, column)
+			target.Reset()
+			inValue = true
+		default:
+			target.WriteString(tok.Text)
+		}
+	}
+	return columns
+}
+
+// ParseDML splits an UPDATE or DELETE statement into its clauses. Keywords
+// inside parentheses (subqueries) are not treated as clause boundaries.
+func ParseDML(sql string) (*DML, error) {
+	tokens := Significant(Tokenize(sql))
+	if len(tokens) > 0 && tokens[len(tokens)-1].Text == ";" {
+		tokens = tokens[:len(tokens)-1]
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty statement")
+	}
+
+	var with string
+	if main := mainStatement(tokens); main > 0 {
+		with = strings.TrimSpace(sql[tokens[0].Pos : tokens[main-1].Pos+len(tokens[main-1].Text)])
+		tokens = tokens[main:]
+	}
+
+	dml := &DML{Operation: strings.ToUpper(tokens[0].Text), With: with}
+	if dml.Operation != "UPDATE" && dml.Operation != "DELETE" {
+		return nil, fmt.Errorf("not an UPDATE or DELETE statement")
+	}
+
+	// Locate the top-level clause keywords
+	clauses := map[string]int{}
+	depth := 0
+	for i, tok := range tokens {
+		switch {
+		case tok.Text == "(":
+			depth++
+		case tok.Text == ")":
+			depth--
+		case depth != 0:
+		case tok.Is("SET", "FROM", "USING", "WHERE", "LIMIT"):
+			if _, seen := clauses[strings.ToUpper(tok.Text)]; !seen {
+				clauses[strings.ToUpper(tok.Text)] = i
+			}
+		case tok.Is("ORDER") && i+1 < len(tokens) && tokens[i+1].Is("BY"):
+			if _, seen := clauses["ORDER"]; !seen {
+				clauses["ORDER"] = i
+			}
+		}
+	}
+
+	// clauseText returns the text from after the keyword at index start
+	// (skip tokens long) up to the next clause keyword.
+	clauseText := func(name string, skip int) string {
+		start, ok := clauses[name]
+		if !ok {
+			return ""
+		}
+		end := len(tokens)
+		for _, other := range clauses {
+			if other > start && other < end {
+				end = other
+			}
+		}
+		if start+skip >= end {
+			return ""
+		}
+		from := tokens[start+skip].Pos
+		to := tokens[end-1].Pos + len(tokens[end-1].Text)
+		return sql[from:to]
+	}
+
+	dml.Where = clauseText("WHERE", 1)
+	dml.OrderBy = clauseText("ORDER", 2)
+	dml.Limit = clauseText("LIMIT", 1)
+
+	// The table references sit between the modifiers and SET (UPDATE) or
+	// after FROM (DELETE)
+	var refStart, refEnd int
+	if dml.Operation == "UPDATE" {
+		setIndex, ok := clauses["SET"]
+		if !ok {
+			return nil, fmt.Errorf("UPDATE statement has no SET clause")
+		}
+		dml.Set = clauseText("SET", 1)
+		refStart, refEnd = 1, setIndex
+	} else {
+		fromIndex, ok := clauses["FROM"]
+		if !ok {
+			return nil, fmt.Errorf("DELETE statement has no FROM clause")
+		}
+		// DELETE t1, t2 FROM ... names its targets before FROM
+		for _, tok := range tokens[1:fromIndex] {
+			if !tok.Is("LOW_PRIORITY", "QUICK", "IGNORE") {
+				dml.MultiTable = true
+			}
+		}
+		if _, ok := clauses["USING"]; ok {
+			dml.MultiTable = true
+		}
+		refStart, refEnd = fromIndex+1, len(tokens)
+		for _, name := range []string{"USING", "WHERE", "ORDER", "LIMIT"} {
+			if index, ok := clauses[name]; ok && index < refEnd {
+				refEnd = index
+			}
+		}
+	}
+
+	for refStart < refEnd && tokens[refStart].Is("LOW_PRIORITY", "IGNORE", "QUICK") {
+		refStart++
+	}
+	refs := tokens[refStart:refEnd]
+
+	// PARTITION (...) does not make a statement multi-table
+	for i := 0; i < len(refs); i++ {
+		if refs[i].Is("PARTITION") {
+			refs = refs[:i]
+			break
+		}
+	}
+
+	for _, tok := range refs {
+		if tok.Text == "," || tok.Is("JOIN") {
+			dml.MultiTable = true
+		}
+	}
+	if dml.MultiTable || len(refs) == 0 {
+		return dml, nil
+	}
+
+	// table [AS] [alias], where table may be qualified as schema.table
+	i := 0
+	var table strings.Builder
+	for i < len(refs) {
+		if refs[i].Kind != Word && refs[i].Kind != QuotedIdent {
+			break
+		}
+		table.WriteString(refs[i].Text)
+		i++
+		if i < len(refs) && refs[i].Text == "." {
+			table.WriteString(".")
+			i++
+			continue
+		}
+		break
+	}
+	dml.Table = table.String()
+
+	if i < len(refs) && refs[i].Is("AS") {
+		i++
+	}
+	if i < len(refs) && (refs[i].Kind == Word || refs[i].Kind == QuotedIdent) {
+		dml.Alias = refs[i].Text
+	}
+
+	return dml, nil
+}
+
+// SkipWith returns sql from the statement a leading WITH clause belongs to,
+// such as "DELETE ..." for "WITH old AS (...) DELETE ...", or sql itself
+// when it has no WITH clause.
+func SkipWith(sql string) string {
+	tokens := Significant(Tokenize(sql))
+	if main := mainStatement(tokens); main > 0 {
+		return sql[tokens[main].Pos:]
+	}
+	return sql
+}
+
+// mainStatement returns the index of the keyword starting the statement a
+// leading WITH clause belongs to: the first SELECT, UPDATE or DELETE outside
+// the parenthesized common table expressions. It returns 0 when there is no
+// WITH clause or no such keyword.
+func mainStatement(tokens []Token) int {
+	if len(tokens) == 0 || !tokens[0].Is("WITH") {
+		return 0
+	}
+	depth := 0
+	for i, tok := range tokens {
+		switch {
+		case tok.Text == "(":
+			depth++
+		case tok.Text == ")":
+			depth--
+		case depth == 0 && tok.Is("SELECT", "TABLE", "VALUES", "UPDATE", "DELETE", "INSERT", "REPLACE"):
+			return i
+		}
+	}
+	return 0
+}
+
+// InsertTarget returns the table an INSERT or REPLACE statement writes to,
+// as written, or an empty string if sql is not such a statement.
+func InsertTarget(sql string) string {
+	tokens := Significant(Tokenize(sql))
+	if len(tokens) == 0 || !tokens[0].Is("INSERT", "REPLACE") {
+		return ""
+	}
+
+	i := 1
+	for i < len(tokens) && tokens[i].Is("LOW_PRIORITY", "DELAYED", "HIGH_PRIORITY", "IGNORE", "INTO") {
+		i++
+	}
+
+	var table strings.Builder
+	for i < len(tokens) && (tokens[i].Kind == Word || tokens[i].Kind == QuotedIdent) {
+		table.WriteString(tokens[i].Text)
+		i++
+		if i < len(tokens) && tokens[i].Text == "." {
+			table.WriteString(".")
+			i++
+			continue
+		}
+		break
+	}
+	return table.String()
+}
+
+// SplitTableName splits a possibly qualified and quoted table name such as
+// `shop`.`orders` into its unquoted schema and table parts.
+func SplitTableName(name string) (schema, table string) {
+	var parts []string
+	for _, tok := range Significant(Tokenize(name)) {
+		switch tok.Kind {
+		case QuotedIdent:
+			parts = append(parts, strings.ReplaceAll(tok.Text[1:len(tok.Text)-1], "``", "`"))
+		case Word:
+			parts = append(parts, tok.Text)
+		}
+	}
+
+	switch len(parts) {
+	case 0:
+		return "", ""
+	case 1:
+		return "", parts[0]
+	default:
+		return parts[len(parts)-2], parts[len(parts)-1]
+	}
+}
+
+// QuoteIdent quotes an identifier with backticks.
+func QuoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// Call is a parsed CALL statement.
+type Call struct {
+	Procedure string // as written, e.g. `shop`.close_month
+	// Variables are the user variables passed as whole arguments, such as
+	// @total, which receive the values of OUT and INOUT parameters
+	Variables []string
+}
+
+// ParseCall parses a single CALL statement.
+func ParseCall(sql string) (*Call, error) {
+	tokens := Significant(Tokenize(sql))
+	if len(tokens) > 0 && tokens[len(tokens)-1].Text == ";" {
+		tokens = tokens[:len(tokens)-1]
+	}
+	if len(tokens) == 0 || !tokens[0].Is("CALL") {
+		return nil, fmt.Errorf("not a CALL statement")
+	}
+
+	name, _, _, i := qualifiedName(sql, tokens, 1)
+	if name == "" {
+		return nil, fmt.Errorf("missing procedure name")
+	}
+	call := &Call{Procedure: name}
+	if i == len(tokens) {
+		return call, nil
+	}
+	if tokens[i].Text != "(" {
+		return nil, fmt.Errorf("unexpected %q after the procedure name", tokens[i].Text)
+	}
+
+	seen := map[string]bool{}
+	depth := 0
+	for ; i < len(tokens); i++ {
+		tok := tokens[i]
+		switch tok.Text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		}
+		if depth == 0 {
+			break
+		}
+		whole := depth == 1 && (tokens[i-1].Text == "(" || tokens[i-1].Text == ",") &&
+			i+1 < len(tokens) && (tokens[i+1].Text == "," || tokens[i+1].Text == ")")
+		if tok.Kind == Variable && !strings.HasPrefix(tok.Text, "@@") && whole && !seen[tok.Text] {
+			seen[tok.Text] = true
+			call.Variables = append(call.Variables, tok.Text)
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced parentheses in the argument list")
+	}
+	if i+1 < len(tokens) {
+		return nil, fmt.Errorf("unexpected %q after the argument list", tokens[i+1].Text)
+	}
+	return call, nil
+}
+
+// Insert describes an INSERT or REPLACE statement.
+type Insert struct {
+	Replace bool
+	Ignore  bool
+	// Rows is the number of rows the statement lists, in VALUES or SET, or
+	// -1 when they come from a SELECT or TABLE statement
+	Rows int
+	// Columns are the unquoted names of the column list, or nil when the
+	// statement has none and so gives a value for every column
+	Columns              []string
+	OnDuplicateKeyUpdate bool
+}
+
+// ParseInsert parses an INSERT or REPLACE statement, or returns nil if sql is
+// not one.
+func ParseInsert(sql string) *Insert {
+	tokens := Significant(Tokenize(sql))
+	if len(tokens) == 0 || !tokens[0].Is("INSERT", "REPLACE") {
+		return nil
+	}
+
+	insert := &Insert{Replace: tokens[0].Is("REPLACE"), Rows: -1}
+	depth := 0
+	for i := 1; i < len(tokens); i++ {
+		tok := tokens[i]
+		switch {
+		case tok.Text == "(" && depth == 0 && insert.Rows < 0 && insert.Columns == nil && isColumnList(tokens, i):
+			insert.Columns = []string{}
+			for i++; i < len(tokens) && tokens[i].Text != ")"; i++ {
+				if tokens[i].Kind == Word || tokens[i].Kind == QuotedIdent {
+					_, column := SplitTableName(tokens[i].Text)
+					insert.Columns = append(insert.Columns, column)
+				}
+			}
+		case tok.Text == "(":
+			depth++
+		case tok.Text == ")":
+			depth--
+		case depth > 0:
+		case tok.Is("IGNORE") && insert.Rows < 0:
+			insert.Ignore = true
+		case tok.Is("VALUES", "VALUE") && insert.Rows < 0:
+			insert.Rows, i = countRows(tokens, i+1)
+			i--
+		case tok.Is("SET") && insert.Rows < 0:
+			insert.Rows = 1
+		case tok.Is("ON") && i+3 < len(tokens) && tokens[i+1].Is("DUPLICATE") && tokens[i+2].Is("KEY") && tokens[i+3].Is("UPDATE"):
+			insert.OnDuplicateKeyUpdate = true
+			return insert
+		}
+	}
+	return insert
+}
+
+// isColumnList reports whether the parenthesis at tokens[i] opens the column
+// list of an INSERT, rather than a PARTITION list or a parenthesized query.
+func isColumnList(tokens []Token, i int) bool {
+	if tokens[i-1].Is("PARTITION") || tokens[i-1].Is("VALUES", "VALUE", "ROW", "SELECT") {
+		return false
+	}
+	return i+1 < len(tokens) && !tokens[i+1].Is("SELECT", "WITH", "VALUES", "TABLE")
+}
+
+// countRows counts the parenthesized rows of a VALUES list starting at
+// tokens[i], with or without ROW, and returns the index after the list.
+func countRows(tokens []Token, i int) (rows, next int) {
+	depth := 0
+	for ; i < len(tokens); i++ {
+		tok := tokens[i]
+		switch {
+		case tok.Text == "(":
+			if depth == 0 {
+				rows++
+			}
+			depth++
+		case tok.Text == ")":
+			depth--
+		case depth > 0, tok.Text == ",", tok.Is("ROW"):
+		default:
+			return rows, i
+		}
+	}
+	return rows, i
+}
+
+// sessionSetExcluded are the words that make a SET statement reach beyond the
+// session, change how its transactions work, or turn off integrity checks
+// and replication for its writes.
+var sessionSetExcluded = []string{"GLOBAL", "PERSIST", "PERSIST_ONLY", "PASSWORD", "AUTOCOMMIT",
+	"FOREIGN_KEY_CHECKS", "UNIQUE_CHECKS", "SQL_SAFE_UPDATES", "SQL_LOG_BIN"}
+
+// transactionSettings are the words of SET statements that change the
+// characteristics of transactions, which MySQL refuses inside a transaction.
+var transactionSettings = []string{"TRANSACTION", "TRANSACTION_ISOLATION", "TRANSACTION_READ_ONLY", "TX_ISOLATION", "TX_READ_ONLY"}
+
+// sessionTokens returns the significant tokens of sql without a trailing
+// semicolon.
+func sessionTokens(sql string) []Token {
+	tokens := Significant(Tokenize(sql))
+	if len(tokens) > 0 && tokens[len(tokens)-1].Text == ";" {
+		tokens = tokens[:len(tokens)-1]
+	}
+	return tokens
+}
+
+// variableName returns the scope and name of a @@scope.name or @@name system
+// variable.
+func variableName(tok Token) (scope, name Token) {
+	first, second, qualified := strings.Cut(strings.TrimPrefix(tok.Text, "@@"), ".")
+	if !qualified {
+		return Token{}, Token{Kind: Word, Text: first}
+	}
+	return Token{Kind: Word, Text: first}, Token{Kind: Word, Text: second}
+}
+
+// setsTransaction reports whether the tokens of a SET statement change the
+// characteristics of transactions.
+func setsTransaction(tokens []Token) bool {
+	for _, tok := range tokens[1:] {
+		if tok.Is(transactionSettings...) {
+			return true
+		}
+		if tok.Kind == Variable && strings.HasPrefix(tok.Text, "@@") {
+			if _, name := variableName(tok); name.Is(transactionSettings...) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsSessionStatement reports whether sql only changes the state of its own
+// session: SET of user variables and session settings other than
+// autocommit, integrity checks and binary logging, USE, and CREATE or DROP
+// of a TEMPORARY table. SET statements that change transaction
+// characteristics may not contain function calls or subqueries, as they
+// cannot run in a read-only transaction (see EvaluatesExpressions).
+func IsSessionStatement(sql string) bool {
+	tokens := sessionTokens(sql)
+	if len(tokens) < 2 {
+		return false
+	}
+
+	switch {
+	case tokens[0].Is("USE"):
+		return len(tokens) == 2
+	case tokens[0].Is("SET"):
+		// SET DEFAULT ROLE changes the account
+		if len(tokens) > 2 && tokens[1].Is("DEFAULT") && tokens[2].Is("ROLE") {
+			return false
+		}
+		transaction := setsTransaction(tokens)
+		for _, tok := range tokens[1:] {
+			if tok.Is(sessionSetExcluded...) || (transaction && tok.Text == "(") {
+				return false
+			}
+			// @@global.name and @@persist.name, and the excluded settings
+			// in any scope
+			if tok.Kind == Variable && strings.HasPrefix(tok.Text, "@@") {
+				scope, name := variableName(tok)
+				if scope.Is("GLOBAL", "PERSIST", "PERSIST_ONLY") || name.Is(sessionSetExcluded...) {
+					return false
+				}
+			}
+		}
+		return true
+	case tokens[0].Is("CREATE", "DROP"):
+		ddl := ParseDDL(sql)
+		return ddl != nil && ddl.Temporary
+	}
+	return false
+}
+
+// UseDatabase returns the unquoted database of a USE statement, or "" for
+// other statements.
+func UseDatabase(sql string) string {
+	tokens := sessionTokens(sql)
+	if len(tokens) != 2 || !tokens[0].Is("USE") {
+		return ""
+	}
+	_, database := SplitTableName(tokens[1].Text)
+	return database
+}
+
+// EvaluatesExpressions reports whether a session statement evaluates
+// expressions, which may call stored functions that change data: any SET
+// other than of transaction characteristics, and CREATE TEMPORARY TABLE
+// filled by a query. Such statements have to run in a read-only
+// transaction.
+func EvaluatesExpressions(sql string) bool {
+	tokens := sessionTokens(sql)
+	if len(tokens) == 0 {
+		return false
+	}
+
+	switch {
+	case tokens[0].Is("SET"):
+		return !setsTransaction(tokens)
+	case tokens[0].Is("CREATE"):
+		// Past CREATE TEMPORARY TABLE, a query fills the table
+		table := false
+		for _, tok := range tokens[1:] {
+			switch {
+			case !table:
+				table = tok.Is("TABLE")
+			case tok.Is("SELECT", "TABLE", "VALUES", "WITH"):
+				return true
+			}
+		}
+	}
+	return false
+}
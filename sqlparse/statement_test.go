@@ -0,0 +1,319 @@
+package sqlparse
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDML(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		table      string
+		where      string
+		orderBy    string
+		limit      string
+		multiTable bool
+	}{
+		{
+			name:  "UPDATE with WHERE",
+			query: "UPDATE users SET status = 'active' WHERE id = 1",
+			table: "users",
+			where: "id = 1",
+		},
+		{
+			name:    "UPDATE with ORDER BY and LIMIT",
+			query:   "UPDATE LOW_PRIORITY `db`.`users` u SET u.a = 1 WHERE u.b IN (SELECT b FROM t WHERE c = 2) ORDER BY id LIMIT 10;",
+			table:   "`db`.`users`",
+			where:   "u.b IN (SELECT b FROM t WHERE c = 2)",
+			orderBy: "id",
+			limit:   "10",
+		},
+		{
+			name:  "DELETE without WHERE",
+			query: "DELETE FROM orders",
+			table: "orders",
+		},
+		{
+			name:  "DELETE with WHERE keyword in string",
+			query: "DELETE FROM orders WHERE note = 'no WHERE here' LIMIT 5",
+			table: "orders",
+			where: "note = 'no WHERE here'",
+			limit: "5",
+		},
+		{
+			name:       "Multi-table UPDATE",
+			query:      "UPDATE orders o JOIN users u ON o.user_id = u.id SET o.status = 'x' WHERE u.id = 1",
+			where:      "u.id = 1",
+			multiTable: true,
+		},
+		{
+			name:       "Multi-table DELETE",
+			query:      "DELETE o FROM orders o JOIN users u ON o.user_id = u.id WHERE u.id = 1",
+			where:      "u.id = 1",
+			multiTable: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dml, err := ParseDML(tt.query)
+			if err != nil {
+				t.Fatalf("ParseDML(%q) failed: %v", tt.query, err)
+			}
+			if dml.Table != tt.table || dml.Where != tt.where || dml.OrderBy != tt.orderBy ||
+				dml.Limit != tt.limit || dml.MultiTable != tt.multiTable {
+				t.Errorf("ParseDML(%q) = %+v", tt.query, dml)
+			}
+		})
+	}
+
+	if _, err := ParseDML("INSERT INTO t VALUES (1)"); err == nil {
+		t.Error("ParseDML should reject INSERT statements")
+	}
+}
+
+func TestParseDMLWithClause(t *testing.T) {
+	sql := "WITH old (id) AS (SELECT id FROM orders WHERE created < '2020-01-01') DELETE FROM orders WHERE id IN (SELECT id FROM old)"
+	dml, err := ParseDML(sql)
+	if err != nil {
+		t.Fatalf("ParseDML(%q) failed: %v", sql, err)
+	}
+	if dml.With != "WITH old (id) AS (SELECT id FROM orders WHERE created < '2020-01-01')" || dml.Operation != "DELETE" ||
+		dml.Table != "orders" || dml.Where != "id IN (SELECT id FROM old)" {
+		t.Errorf("ParseDML(%q) = %+v", sql, dml)
+	}
+
+	if _, err := ParseDML("WITH x AS (SELECT 1) SELECT * FROM x"); err == nil {
+		t.Error("ParseDML should reject a WITH clause of a SELECT")
+	}
+}
+
+func TestSkipWith(t *testing.T) {
+	tests := map[string]string{
+		"WITH x AS (SELECT 1) DELETE FROM orders":                           "DELETE FROM orders",
+		"WITH a AS (SELECT 1), b AS (SELECT 2) UPDATE t SET c = 1":          "UPDATE t SET c = 1",
+		"WITH RECURSIVE r (n) AS (SELECT 1 UNION SELECT n FROM r) SELECT 1": "SELECT 1",
+		"DELETE FROM orders": "DELETE FROM orders",
+	}
+	for sql, want := range tests {
+		if got := SkipWith(sql); got != want {
+			t.Errorf("SkipWith(%q) = %q, want %q", sql, got, want)
+		}
+	}
+}
+
+func TestIsTautology(t *testing.T) {
+	tests := []struct {
+		condition string
+		expected  bool
+	}{
+		{"1=1", true},
+		{"1 = 1", true},
+		{"TRUE", true},
+		{"1", true},
+		{"'a' = 'A'", true},
+		{"id = id", true},
+		{"(1=1)", true},
+		{"status = 'x' OR 1=1", true},
+		{"1=1 AND 2=2", true},
+		{"NOT 1=0", true},
+		{"name LIKE '%'", true},
+		{"1 <> 0", true},
+		{"id = 1", false},
+		{"1=1 AND id = 5", false},
+		{"id BETWEEN 1 AND 10", false},
+		{"0", false},
+		{"1=0", false},
+		{"a = b", false},
+		{"name LIKE 'a%'", false},
+	}
+
+	for _, tt := range tests {
+		if result := IsTautology(tt.condition); result != tt.expected {
+			t.Errorf("IsTautology(%q) = %v, want %v", tt.condition, result, tt.expected)
+		}
+	}
+}
+
+func TestInsertTarget(t *testing.T) {
+	tests := map[string]string{
+		"INSERT INTO users (name) VALUES ('a')":         "users",
+		"insert ignore into `shop`.`orders` VALUES (1)": "`shop`.`orders`",
+		"REPLACE LOW_PRIORITY INTO t SET a = 1":         "t",
+		"UPDATE users SET name = 'a' WHERE id = 1":      "",
+	}
+
+	for sql, expected := range tests {
+		if table := InsertTarget(sql); table != expected {
+			t.Errorf("InsertTarget(%q) = %q, want %q", sql, table, expected)
+		}
+	}
+}
+
+func TestSplitTableName(t *testing.T) {
+	schema, table := SplitTableName("`shop`.`order``s`")
+	if schema != "shop" || table != "order`s" {
+		t.Errorf("SplitTableName = %q, %q", schema, table)
+	}
+
+	schema, table = SplitTableName("users")
+	if schema != "" || table != "users" {
+		t.Errorf("SplitTableName = %q, %q", schema, table)
+	}
+}
+
+func TestParseCall(t *testing.T) {
+	tests := []struct {
+		sql       string
+		procedure string
+		variables []string
+		wantErr   bool
+	}{
+		{sql: "CALL refresh_stats", procedure: "refresh_stats"},
+		{sql: "call `shop`.close_month(?, @total, @count);", procedure: "`shop`.close_month", variables: []string{"@total", "@count"}},
+		{sql: "CALL p(@a + 1, CONCAT(@b, 'x'), @c, @c)", procedure: "p", variables: []string{"@c"}},
+		{sql: "CALL p(@@session.sql_mode)", procedure: "p"},
+		{sql: "SELECT 1", wantErr: true},
+		{sql: "CALL p(1", wantErr: true},
+		{sql: "CALL p(1); DROP TABLE t", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sql, func(t *testing.T) {
+			call, err := ParseCall(tt.sql)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCall() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if call.Procedure != tt.procedure || strings.Join(call.Variables, ",") != strings.Join(tt.variables, ",") {
+				t.Errorf("ParseCall() = %+v, want procedure %q and variables %v", call, tt.procedure, tt.variables)
+			}
+		})
+	}
+}
+
+func TestParseInsert(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want *Insert
+	}{
+		{sql: "INSERT INTO t (a, `b`) VALUES (1, 'x')", want: &Insert{Rows: 1, Columns: []string{"a", "b"}}},
+		{sql: "insert t values (1, (2)), (3, 4),(5,6)", want: &Insert{Rows: 3}},
+		{sql: "INSERT IGNORE INTO t VALUES (1), (2)", want: &Insert{Ignore: true, Rows: 2}},
+		{sql: "INSERT INTO t VALUES ROW(1, 2), ROW(3, 4)", want: &Insert{Rows: 2}},
+		{sql: "INSERT INTO t SET a = 1, b = 2", want: &Insert{Rows: 1}},
+		{sql: "INSERT INTO t SELECT * FROM u", want: &Insert{Rows: -1}},
+		{sql: "INSERT INTO t PARTITION (p1) (SELECT * FROM u)", want: &Insert{Rows: -1}},
+		{sql: "REPLACE INTO t VALUES (1), (2)", want: &Insert{Replace: true, Rows: 2}},
+		{sql: "INSERT INTO t (a) VALUES (1), (2) AS new ON DUPLICATE KEY UPDATE a = new.a",
+			want: &Insert{Rows: 2, Columns: []string{"a"}, OnDuplicateKeyUpdate: true}},
+		{sql: "INSERT INTO t (a) VALUES (1) ON DUPLICATE KEY UPDATE a = VALUES(a) + 1",
+			want: &Insert{Rows: 1, Columns: []string{"a"}, OnDuplicateKeyUpdate: true}},
+		{sql: "INSERT INTO t (a) SELECT a FROM u ON DUPLICATE KEY UPDATE a = 1",
+			want: &Insert{Rows: -1, Columns: []string{"a"}, OnDuplicateKeyUpdate: true}},
+		{sql: "UPDATE t SET a = 1", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sql, func(t *testing.T) {
+			got := ParseInsert(tt.sql)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseInsert() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsSessionStatement(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want bool
+	}{
+		{"SET @total = (SELECT COUNT(*) FROM orders)", true},
+		{"SET SESSION sql_mode = 'ANSI_QUOTES', @a := 1", true},
+		{"set @@session.time_zone = '+00:00';", true},
+		{"SET NAMES utf8mb4", true},
+		{"SET @@default_storage_engine = MEMORY, sql_mode = DEFAULT", true},
+		{"USE `shop`", true},
+		{"CREATE TEMPORARY TABLE recent AS SELECT * FROM orders WHERE created_at > NOW() - INTERVAL 1 DAY", true},
+		{"CREATE TEMPORARY TABLE IF NOT EXISTS t (id INT)", true},
+		{"DROP TEMPORARY TABLE IF EXISTS recent", true},
+		{"SET GLOBAL max_connections = 10", false},
+		{"SET @@global.max_connections = 10", false},
+		{"SET PERSIST sql_mode = ''", false},
+		{"SET autocommit = 0", false},
+		{"SET @@session.autocommit = 0", false},
+		{"SET PASSWORD = 'secret'", false},
+		{"SET foreign_key_checks = 0", false},
+		{"SET SESSION unique_checks = 0, @a = 1", false},
+		{"SET @@session.sql_safe_updates = 0", false},
+		{"SET @@sql_log_bin = 0", false},
+		{"SET TRANSACTION ISOLATION LEVEL READ COMMITTED", true},
+		{"SET @@session.transaction_isolation = 'READ-COMMITTED'", true},
+		{"SET SESSION TRANSACTION READ ONLY, @a = f()", false},
+		{"SET transaction_read_only = (SELECT f())", false},
+		{"SET DEFAULT ROLE ALL TO 'app'@'%'", false},
+		{"CREATE TABLE t (id INT)", false},
+		{"DROP TABLE recent", false},
+		{"USE shop; DROP TABLE t", false},
+		{"SELECT 1", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsSessionStatement(tt.sql); got != tt.want {
+			t.Errorf("IsSessionStatement(%q) = %v, want %v", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestSetColumns(t *testing.T) {
+	dml, err := ParseDML("UPDATE orders o SET o.`status` = IF(total > 0, 'paid', 'open'), note = CONCAT(note, ',x'), `shop`.o.id = id + 1 WHERE id = 1")
+	if err != nil {
+		t.Fatalf("ParseDML failed: %v", err)
+	}
+	want := []string{"status", "note", "id"}
+	if got := dml.SetColumns(); !reflect.DeepEqual(got, want) {
+		t.Errorf("SetColumns() = %q, want %q", got, want)
+	}
+}
+
+func TestUseDatabase(t *testing.T) {
+	for sql, want := range map[string]string{
+		"USE shop":           "shop",
+		"use `my``db`;":      "my`db",
+		"USE shop; SELECT 1": "",
+		"SELECT 1":           "",
+	} {
+		if got := UseDatabase(sql); got != want {
+			t.Errorf("UseDatabase(%q) = %q, want %q", sql, got, want)
+		}
+	}
+}
+
+func TestEvaluatesExpressions(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want bool
+	}{
+		{"SET @total = (SELECT COUNT(*) FROM orders)", true},
+		{"SET NAMES utf8mb4", true},
+		{"SET TRANSACTION ISOLATION LEVEL READ COMMITTED", false},
+		{"SET @@tx_isolation = 'READ-COMMITTED'", false},
+		{"CREATE TEMPORARY TABLE recent AS SELECT * FROM orders", true},
+		{"CREATE TEMPORARY TABLE copy TABLE orders", true},
+		{"CREATE TEMPORARY TABLE IF NOT EXISTS t (id INT, name VARCHAR(10))", false},
+		{"CREATE TEMPORARY TABLE t LIKE orders", false},
+		{"DROP TEMPORARY TABLE t", false},
+		{"USE shop", false},
+	}
+
+	for _, tt := range tests {
+		if got := EvaluatesExpressions(tt.sql); got != tt.want {
+			t.Errorf("EvaluatesExpressions(%q) = %v, want %v", tt.sql, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package sqlparse
+
+import (
+	"strconv"
+	"strings"
+)
+
+// IsTautology reports whether a WHERE condition is trivially true, so that
+// it does not actually restrict the rows a statement touches: TRUE, 1,
+// 1=1, 'a'='a', id=id, col LIKE '%', or any OR containing one of these.
+func IsTautology(condition string) bool {
+	return isTautology(Significant(Tokenize(condition)))
+}
+
+func isTautology(tokens []Token) bool {
+	tokens = stripParens(tokens)
+	if len(tokens) == 0 {
+		return false
+	}
+
+	if parts := splitTopLevel(tokens, "OR", "||"); len(parts) > 1 {
+		for _, part := range parts {
+			if isTautology(part) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if parts := splitTopLevel(tokens, "AND", "&&"); len(parts) > 1 {
+		for _, part := range parts {
+			if !isTautology(part) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if tokens[0].Is("NOT") || tokens[0].Text == "!" {
+		return isContradiction(tokens[1:])
+	}
+
+	value, known := evaluateAtom(tokens)
+	return known && value
+}
+
+func isContradiction(tokens []Token) bool {
+	tokens = stripParens(tokens)
+	if len(tokens) == 0 {
+		return false
+	}
+	if tokens[0].Is("NOT") || tokens[0].Text == "!" {
+		return isTautology(tokens[1:])
+	}
+	value, known := evaluateAtom(tokens)
+	return known && !value
+}
+
+// evaluateAtom evaluates a condition without AND/OR when its result does not
+// depend on the row. known is false when the result cannot be determined.
+func evaluateAtom(tokens []Token) (value bool, known bool) {
+	if len(tokens) == 1 {
+		tok := tokens[0]
+		switch {
+		case tok.Is("TRUE"):
+			return true, true
+		case tok.Is("FALSE"), tok.Is("NULL"):
+			return false, true
+		case tok.Kind == Number, tok.Kind == String:
+			n, _ := numericValue(tok)
+			return n != 0, true
+		}
+		return false, false
+	}
+
+	// NULL IS NULL
+	if len(tokens) == 3 && tokens[0].Is("NULL") && tokens[1].Is("IS") && tokens[2].Is("NULL") {
+		return true, true
+	}
+
+	depth := 0
+	for i, tok := range tokens {
+		switch tok.Text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		}
+		if depth != 0 {
+			continue
+		}
+		if tok.Is("LIKE") && i+2 == len(tokens) && tokens[i+1].Kind == String && unquote(tokens[i+1].Text) == "%" {
+			return true, true
+		}
+
+		op := tok.Text
+		switch op {
+		case "=", "<=>", "<=", ">=", "<>", "!=", "<", ">":
+		default:
+			continue
+		}
+
+		left, right := stripParens(tokens[:i]), stripParens(tokens[i+1:])
+		if len(left) == 0 || len(right) == 0 {
+			return false, false
+		}
+
+		// Comparing an expression with itself
+		if equalTokens(left, right) {
+			switch op {
+			case "=", "<=>", "<=", ">=":
+				return true, true
+			default:
+				return false, true
+			}
+		}
+
+		if len(left) == 1 && len(right) == 1 && isConstant(left[0]) && isConstant(right[0]) {
+			return compareConstants(left[0], right[0], op), true
+		}
+		return false, false
+	}
+
+	return false, false
+}
+
+func compareConstants(a, b Token, op string) bool {
+	var cmp int
+	if a.Kind == String && b.Kind == String {
+		cmp = strings.Compare(strings.ToLower(unquote(a.Text)), strings.ToLower(unquote(b.Text)))
+	} else {
+		x, _ := numericValue(a)
+		y, _ := numericValue(b)
+		switch {
+		case x < y:
+			cmp = -1
+		case x > y:
+			cmp = 1
+		}
+	}
+
+	switch op {
+	case "=", "<=>":
+		return cmp == 0
+	case "<>", "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case ">":
+		return cmp > 0
+	case "<=":
+		return cmp <= 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+func isConstant(tok Token) bool {
+	return tok.Kind == Number || tok.Kind == String || tok.Is("TRUE", "FALSE")
+}
+
+// numericValue converts a literal the way MySQL does in a numeric context:
+// strings use their leading numeric prefix, or 0.
+func numericValue(tok Token) (float64, bool) {
+	switch {
+	case tok.Is("TRUE"):
+		return 1, true
+	case tok.Is("FALSE"):
+		return 0, true
+	case tok.Kind == Number:
+		if strings.HasPrefix(strings.ToLower(tok.Text), "0x") {
+			n, err := strconv.ParseUint(tok.Text[2:], 16, 64)
+			return float64(n), err == nil
+		}
+		n, err := strconv.ParseFloat(tok.Text, 64)
+		return n, err == nil
+	case tok.Kind == String:
+		text := strings.TrimSpace(unquote(tok.Text))
+		for end := len(text); end > 0; end-- {
+			if n, err := strconv.ParseFloat(text[:end], 64); err == nil {
+				return n, true
+			}
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// unquote strips the quotes (and any charset prefix) from a string literal.
+func unquote(text string) string {
+	start := strings.IndexAny(text, `'"`)
+	if start < 0 || len(text)-start < 2 {
+		return text
+	}
+	quote := text[start]
+	inner := text[start+1 : len(text)-1]
+	inner = strings.ReplaceAll(inner, string(quote)+string(quote), string(quote))
+	return strings.ReplaceAll(inner, `\`+string(quote), string(quote))
+}
+
+// stripParens removes parentheses wrapping the whole expression.
+func stripParens(tokens []Token) []Token {
+	for len(tokens) >= 2 && tokens[0].Text == "(" && tokens[len(tokens)-1].Text == ")" {
+		depth := 0
+		wrapped := true
+		for i, tok := range tokens {
+			switch tok.Text {
+			case "(":
+				depth++
+			case ")":
+				depth--
+			}
+			if depth == 0 && i < len(tokens)-1 {
+				wrapped = false
+				break
+			}
+		}
+		if !wrapped {
+			break
+		}
+		tokens = tokens[1 : len(tokens)-1]
+	}
+	return tokens
+}
+
+// splitTopLevel splits tokens on the given operators outside parentheses.
+// BETWEEN ... AND is not split.
+func splitTopLevel(tokens []Token, operators ...string) [][]Token {
+	var parts [][]Token
+	depth, start := 0, 0
+	inBetween := false
+
+	for i, tok := range tokens {
+		switch {
+		case tok.Text == "(":
+			depth++
+		case tok.Text == ")":
+			depth--
+		case depth != 0:
+		case tok.Is("BETWEEN"):
+			inBetween = true
+		case tok.Is(operators...) || tok.Kind == Punct && contains(operators, tok.Text):
+			if inBetween && tok.Is("AND") {
+				inBetween = false
+				continue
+			}
+			parts = append(parts, tokens[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, tokens[start:])
+}
+
+func equalTokens(a, b []Token) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Kind == Word {
+			if !strings.EqualFold(a[i].Text, b[i].Text) {
+				return false
+			}
+		} else if a[i].Text != b[i].Text {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
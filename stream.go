@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/koh-yoshimoto/mysql-mcp-server/format"
+	"github.com/koh-yoshimoto/mysql-mcp-server/mysql"
+)
+
+const (
+	// tableSampleRows is how many rows the streamed table format reads to
+	// size its columns
+	tableSampleRows = 500
+	// cacheMaxRows is the largest result kept for the query cache
+	cacheMaxRows = 1000
+)
+
+// queryOutput is a query result formatted while it was read.
+type queryOutput struct {
+	Text      string
+	Columns   []mysql.Column
+	Rows      int
+	Truncated bool
+	// Warnings are those of the query; they are not read for truncated
+	// results, as the query was stopped
+	Warnings []mysql.Warning
+	// Results holds the rows when they had to be kept, for the json format
+	// and results small enough for the query cache, and is nil otherwise
+	Results *mysql.ResultSet
+}
+
+// streamQuery runs a query and formats its rows as they are read, stopping
+// after maxRows rows (0 for no limit). The rows themselves are only kept for
+// the json format and for the query cache, up to cacheMaxRows, so large
+// results are formatted without holding them in memory.
+func (s *MCPServer) streamQuery(ctx context.Context, query string, params []interface{}, outputFormat string, maxRows int) (*queryOutput, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	rows, err := s.currentReadClient().QueryStream(ctx, query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	output := &queryOutput{Columns: rows.Columns()}
+	var text strings.Builder
+	writer := newRowWriter(&text, outputFormat)
+	if writer == nil || (s.queryCache != nil && s.session == nil) {
+		output.Results = &mysql.ResultSet{Columns: output.Columns, Rows: [][]interface{}{}}
+	}
+	if writer != nil {
+		writer.WriteHeader((&mysql.ResultSet{Columns: output.Columns}).ColumnNames())
+	}
+
+	for rows.Next() {
+		if maxRows > 0 && output.Rows == maxRows {
+			// Stop the server from sending the rest rather than reading it
+			output.Truncated = true
+			cancel()
+			break
+		}
+		output.Rows++
+		if output.Results != nil {
+			output.Results.Rows = append(output.Results.Rows, rows.Row())
+			if writer != nil && output.Rows > cacheMaxRows {
+				output.Results = nil
+			}
+		}
+		if writer != nil {
+			writer.WriteRow(rows.Row())
+		}
+	}
+	if !output.Truncated {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		if output.Warnings, err = rows.Warnings(); err != nil {
+			return nil, err
+		}
+		if output.Results != nil {
+			output.Results.Warnings = output.Warnings
+		}
+	}
+
+	switch {
+	case output.Rows == 0:
+		output.Text = "No results"
+	case writer != nil:
+		writer.Flush()
+		output.Text = text.String()
+	default:
+		output.Text = s.formatResults(output.Results, outputFormat)
+	}
+	return output, nil
+}
+
+// newRowWriter returns the streaming writer for a format, or nil for json,
+// which is written from the complete result.
+func newRowWriter(w io.Writer, outputFormat string) format.RowWriter {
+	switch outputFormat {
+	case "table":
+		return format.NewTableWriter(w, tableSampleRows)
+	case "csv":
+		return format.NewCSVWriter(w)
+	case "markdown":
+		return format.NewMarkdownWriter(w)
+	default:
+		return nil
+	}
+}
+
+// limitResults returns the first maxRows rows of a result (all of them for
+// 0) and whether any were left out.
+func limitResults(results *mysql.ResultSet, maxRows int) (*mysql.ResultSet, bool) {
+	if maxRows <= 0 || results.Len() <= maxRows {
+		return results, false
+	}
+	return &mysql.ResultSet{Columns: results.Columns, Rows: results.Rows[:maxRows], Warnings: results.Warnings}, true
+}
+
+// rowsReturned describes the number of rows in a query response.
+func rowsReturned(rows int, truncated bool) string {
+	if truncated {
+		return fmt.Sprintf("Only the first %d rows are returned; add conditions or a LIMIT to narrow the query.", rows)
+	}
+	return fmt.Sprintf("%d rows returned.", rows)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultConfirmTokenTTL applies unless overridden with
+// MYSQL_CONFIRM_TOKEN_TTL_SECONDS.
+const defaultConfirmTokenTTL = 5 * time.Minute
+
+var (
+	errTokenInvalid     = errors.New("Invalid or expired confirmation token")
+	errTokenExpired     = errors.New("Confirmation token has expired. Please run with dry_run=true again.")
+	errTokenSQLMismatch = errors.New("SQL does not match the confirmation token")
+	errTokenUsed        = errors.New("Confirmation token has already been used. Please run with dry_run=true again.")
+)
+
+// ConfirmationStore issues and redeems execute confirmation tokens. Each token
+// carries an HMAC over its dry run so it cannot be forged, and it is only
+// accepted for the SQL and connection it was issued for, and only once. The
+// confirmed row count is kept in the store and is only binding because
+// execute checks it before committing (see parseRowCheck). The store is kept
+// in memory and is safe for concurrent use.
+type ConfirmationStore struct {
+	mu            sync.Mutex
+	secret        []byte
+	ttl           time.Duration
+	confirmations map[string]*ExecuteConfirmation
+}
+
+func NewConfirmationStore(secret []byte, ttl time.Duration) *ConfirmationStore {
+	return &ConfirmationStore{
+		secret:        secret,
+		ttl:           ttl,
+		confirmations: make(map[string]*ExecuteConfirmation),
+	}
+}
+
+// loadConfirmationStore reads MYSQL_CONFIRM_TOKEN_SECRET and
+// MYSQL_CONFIRM_TOKEN_TTL_SECONDS. Without a configured secret a random one is
+// generated. Tokens never survive a restart either way, as the confirmations
+// they refer to are only held in memory.
+func loadConfirmationStore() *ConfirmationStore {
+	ttl := defaultConfirmTokenTTL
+	if v, err := strconv.Atoi(os.Getenv("MYSQL_CONFIRM_TOKEN_TTL_SECONDS")); err == nil && v > 0 {
+		ttl = time.Duration(v) * time.Second
+	}
+
+	secret := []byte(os.Getenv("MYSQL_CONFIRM_TOKEN_SECRET"))
+	if len(secret) == 0 {
+		secret = randomBytes(32)
+	}
+
+	return NewConfirmationStore(secret, ttl)
+}
+
+// Issue stores the confirmation and returns its token. CreatedAt defaults to
+// now; the token expires one TTL after it.
+func (c *ConfirmationStore) Issue(confirmation *ExecuteConfirmation) string {
+	if confirmation.CreatedAt.IsZero() {
+		confirmation.CreatedAt = time.Now()
+	}
+	confirmation.ExpiresAt = confirmation.CreatedAt.Add(c.ttl)
+
+	nonce := hex.EncodeToString(randomBytes(8))
+	token := nonce + "." + c.sign(nonce, confirmation.SQL, confirmation.Connection,
+		confirmation.AffectedRows, confirmation.ExpiresAt)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.confirmations[token] = confirmation
+	return token
+}
+
+// Validate checks that the token was issued for this SQL and connection and
+// has not expired, without redeeming it. Expired tokens are removed.
+func (c *ConfirmationStore) Validate(token, sql, connection string) (*ExecuteConfirmation, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	confirmation, exists := c.confirmations[token]
+	if !exists {
+		return nil, errTokenInvalid
+	}
+
+	if time.Now().After(confirmation.ExpiresAt) {
+		delete(c.confirmations, token)
+		return nil, errTokenExpired
+	}
+
+	nonce, _, _ := strings.Cut(token, ".")
+	if !c.verify(token, nonce, sql, connection, confirmation.AffectedRows, confirmation.ExpiresAt) {
+		return nil, errTokenSQLMismatch
+	}
+
+	return confirmation, nil
+}
+
+// Redeem consumes a validated token. It fails if the token was already
+// redeemed, so a token authorizes at most one execution even under concurrent
+// calls.
+func (c *ConfirmationStore) Redeem(token string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.confirmations[token]; !exists {
+		return errTokenUsed
+	}
+	delete(c.confirmations, token)
+	return nil
+}
+
+// Cleanup removes expired confirmations.
+func (c *ConfirmationStore) Cleanup() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for token, confirmation := range c.confirmations {
+		if now.After(confirmation.ExpiresAt) {
+			delete(c.confirmations, token)
+		}
+	}
+}
+
+func (c *ConfirmationStore) TTL() time.Duration {
+	return c.ttl
+}
+
+func (c *ConfirmationStore) sign(nonce, sql, connection string, affectedRows int64, expiresAt time.Time) string {
+	mac := hmac.New(sha256.New, c.secret)
+	// Length-prefix each field so values cannot bleed into one another
+	for _, field := range []string{nonce, sql, connection, strconv.FormatInt(affectedRows, 10), strconv.FormatInt(expiresAt.UnixNano(), 10)} {
+		var length [8]byte
+		binary.BigEndian.PutUint64(length[:], uint64(len(field)))
+		mac.Write(length[:])
+		mac.Write([]byte(field))
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (c *ConfirmationStore) verify(token, nonce, sql, connection string, affectedRows int64, expiresAt time.Time) bool {
+	expected := nonce + "." + c.sign(nonce, sql, connection, affectedRows, expiresAt)
+	return hmac.Equal([]byte(token), []byte(expected))
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return b
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/koh-yoshimoto/mysql-mcp-server/backup"
+	"github.com/koh-yoshimoto/mysql-mcp-server/mysql"
+	"github.com/koh-yoshimoto/mysql-mcp-server/sqlparse"
+	"github.com/tidwall/gjson"
+)
+
+// defaultBackupMaxRows applies unless overridden with MYSQL_BACKUP_MAX_ROWS.
+const defaultBackupMaxRows = 10000
+
+// backupPlan describes how to snapshot the rows of a confirmed UPDATE or
+// DELETE before it commits.
+type backupPlan struct {
+	sql       string
+	operation string
+	table     string
+	key       []string
+	generated []string
+	capture   string
+	// maxRows is the most rows the snapshot may hold
+	maxRows int64
+	// saved is set once the snapshot has been stored
+	saved *backup.Snapshot
+}
+
+// initBackup sets up row snapshots from MYSQL_BACKUP_DIR or
+// MYSQL_BACKUP_TABLE, limited to MYSQL_BACKUP_MAX_ROWS rows per statement.
+// Backups are disabled when neither is set.
+func (s *MCPServer) initBackup() error {
+	s.backupMaxRows = defaultBackupMaxRows
+	if v, err := strconv.ParseInt(os.Getenv("MYSQL_BACKUP_MAX_ROWS"), 10, 64); err == nil && v > 0 {
+		s.backupMaxRows = v
+	}
+
+	dir, table := os.Getenv("MYSQL_BACKUP_DIR"), os.Getenv("MYSQL_BACKUP_TABLE")
+	switch {
+	case dir != "" && table != "":
+		return fmt.Errorf("set only one of MYSQL_BACKUP_DIR and MYSQL_BACKUP_TABLE")
+	case dir != "":
+		store, err := backup.NewFileStore(dir)
+		if err != nil {
+			return fmt.Errorf("failed to initialize backups: %w", err)
+		}
+		s.backups = store
+	case table != "":
+		store, err := backup.NewTableStore(s.writeClient.DB(), table)
+		if err != nil {
+			return fmt.Errorf("failed to initialize backups: %w", err)
+		}
+		s.backups = store
+	}
+	return nil
+}
+
+// planBackup prepares the snapshot of the rows an UPDATE or DELETE affects.
+// It returns nil when backups are disabled or do not apply to the statement,
+// with a note explaining why if the statement could otherwise be undone.
+func (s *MCPServer) planBackup(ctx context.Context, query string, affectedRows int64) (*backupPlan, string) {
+	if s.backups == nil {
+		return nil, ""
+	}
+	operation := detectQueryOperation(query)
+	if operation != "UPDATE" && operation != "DELETE" {
+		return nil, ""
+	}
+
+	dml, err := sqlparse.ParseDML(query)
+	if err != nil {
+		return nil, fmt.Sprintf("the statement could not be parsed: %v", err)
+	}
+	if dml.MultiTable {
+		return nil, "multi-table statements are not backed up"
+	}
+	if affectedRows > s.backupMaxRows {
+		return nil, fmt.Sprintf("it affects more than %d rows (MYSQL_BACKUP_MAX_ROWS)", s.backupMaxRows)
+	}
+
+	pk, err := s.lookupPrimaryKey(ctx, dml.Table)
+	if err != nil {
+		return nil, err.Error()
+	}
+	if len(pk.Columns) == 0 {
+		return nil, "the table has no primary key to restore rows by"
+	}
+	// A restore matches rows by their primary key, so it would re-insert a
+	// row whose key changed next to the changed one
+	if operation == "UPDATE" {
+		for _, column := range dml.SetColumns() {
+			for _, key := range pk.Columns {
+				if strings.EqualFold(column, key) {
+					return nil, fmt.Sprintf("it changes the primary key column %s, which the rows are restored by", key)
+				}
+			}
+		}
+	}
+
+	schema, name := sqlparse.SplitTableName(dml.Table)
+	generated, err := s.currentReadClient().GetGeneratedColumns(ctx, schema, name)
+	if err != nil {
+		return nil, err.Error()
+	}
+
+	// One row over the limit shows that the statement now affects more
+	// rows than its dry run did
+	limit := dml.Limit
+	if limit == "" {
+		limit = strconv.FormatInt(s.backupMaxRows+1, 10)
+	}
+	return &backupPlan{
+		sql:       query,
+		operation: operation,
+		table:     dml.Table,
+		key:       pk.Columns,
+		generated: generated,
+		capture:   selectAffectedRows(dml, limit) + " FOR UPDATE",
+		maxRows:   s.backupMaxRows,
+	}, ""
+}
+
+// save stores the captured rows. Nothing is stored when no rows matched, and
+// it fails when more rows matched than a snapshot may hold.
+func (p *backupPlan) save(store backup.Store, connection string, captured *mysql.ResultSet) error {
+	if captured.Len() == 0 {
+		return nil
+	}
+	if int64(captured.Len()) > p.maxRows {
+		return fmt.Errorf("the statement now affects more than %d rows (MYSQL_BACKUP_MAX_ROWS); run the dry run again", p.maxRows)
+	}
+
+	snapshot := backup.NewSnapshot(p.table, p.key, captured.Maps(), p.generated)
+	snapshot.Connection = connection
+	snapshot.SQL = p.sql
+	snapshot.Operation = p.operation
+
+	if err := store.Save(snapshot); err != nil {
+		return err
+	}
+	p.saved = snapshot
+	return nil
+}
+
+// handleUndoTool restores the rows of a snapshot. The restoring statement
+// goes through the execute tool, so it needs a dry run and a confirm token
+// like any other write.
+func (s *MCPServer) handleUndoTool(id interface{}, args json.RawMessage) *Response {
+	if s.backups == nil {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: "Backups are not enabled. Set MYSQL_BACKUP_DIR or MYSQL_BACKUP_TABLE to back up rows before UPDATE and DELETE statements.",
+			},
+		}
+	}
+
+	snapshotID := gjson.GetBytes(args, "snapshot_id").String()
+	if snapshotID == "" {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: "snapshot_id parameter is required",
+			},
+		}
+	}
+
+	snapshot, err := s.backups.Load(snapshotID)
+	if err != nil {
+		message := fmt.Sprintf("Failed to load snapshot: %v", err)
+		if errors.Is(err, backup.ErrNotFound) {
+			message = fmt.Sprintf("Unknown snapshot: %s", snapshotID)
+		}
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: message,
+			},
+		}
+	}
+
+	if snapshot.Connection != s.connection {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32602,
+				Message: fmt.Sprintf("Snapshot %s was taken on %s, not on this connection (%s)", snapshotID, snapshot.Connection, s.connection),
+			},
+		}
+	}
+
+	restore := snapshot.RestoreSQL()
+	executeArgs := map[string]interface{}{"sql": restore}
+	for _, name := range []string{"dry_run", "confirm_token", "allow_large_operation", "timeout_ms"} {
+		if value := gjson.GetBytes(args, name); value.Exists() {
+			executeArgs[name] = value.Value()
+		}
+	}
+	encoded, err := json.Marshal(executeArgs)
+	if err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: &Error{
+				Code:    -32603,
+				Message: fmt.Sprintf("Failed to encode restore statement: %v", err),
+			},
+		}
+	}
+
+	response := s.handleExecuteTool(id, encoded)
+	result, ok := response.Result.(map[string]interface{})
+	if !ok {
+		return response
+	}
+
+	contentMessages := []map[string]interface{}{
+		{
+			"type": "text",
+			"text": fmt.Sprintf("↩️  Restoring %d rows of %s from snapshot %s, taken %s before: %s",
+				len(snapshot.Rows), snapshot.Table, snapshot.ID, snapshot.CreatedAt.Format("2006-01-02 15:04:05"), snapshot.SQL),
+		},
+	}
+	if content, ok := result["content"].([]map[string]interface{}); ok {
+		contentMessages = append(contentMessages, content...)
+	}
+	if token, ok := result["confirm_token"].(string); ok {
+		contentMessages = append(contentMessages, map[string]interface{}{
+			"type": "text",
+			"text": fmt.Sprintf("Or use the undo tool with snapshot_id='%s', dry_run=false and confirm_token='%s'. "+
+				"Rows changed back by the restore count twice in the affected rows.", snapshot.ID, token),
+		})
+	}
+
+	result["content"] = contentMessages
+	result["snapshot_id"] = snapshot.ID
+	result["restore_sql"] = restore
+	return response
+}
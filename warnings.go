@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/koh-yoshimoto/mysql-mcp-server/mysql"
+)
+
+// warningsMessage lists the warnings MySQL reported for a statement as a
+// content message, or returns nil if there were none.
+func warningsMessage(warnings []mysql.Warning) map[string]interface{} {
+	if len(warnings) == 0 {
+		return nil
+	}
+	lines := make([]string, len(warnings))
+	for i, w := range warnings {
+		lines[i] = "- " + w.String()
+	}
+	return map[string]interface{}{
+		"type": "text",
+		"text": fmt.Sprintf("⚠️  MySQL reported %d warnings:\n%s", len(warnings), strings.Join(lines, "\n")),
+	}
+}
+
+// unreadWarningsMessage explains that the warnings of an applied statement
+// could not be read, or returns nil if they were.
+func unreadWarningsMessage(err error) map[string]interface{} {
+	if err == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"type": "text",
+		"text": fmt.Sprintf("⚠️  The statement was applied, but its warnings could not be read: %v", err),
+	}
+}